@@ -0,0 +1,88 @@
+package mail
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/dsn"
+)
+
+type (
+	// loginAuth implements AUTH LOGIN which net/smtp doesn't provide.
+	loginAuth struct {
+		username, password, host string
+	}
+
+	// xoauth2Auth implements AUTH XOAUTH2, e.g. Gmail and Office365.
+	xoauth2Auth struct {
+		username, token string
+	}
+)
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, xerrors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, xerrors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:", "user name", "username":
+		return []byte(a.username), nil
+	case "password:", "password":
+		return []byte(a.password), nil
+	default:
+		return nil, xerrors.Errorf("unexpected server challenge: %s", fromServer)
+	}
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, xerrors.New("unencrypted connection")
+	}
+
+	resp := fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", a.username, a.token)
+	return "XOAUTH2", []byte(resp), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// Server sends an error detail as JSON, so we have to respond empty
+		// message to finish this exchange and receive an actual error.
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+// smtpAuth returns smtp.Auth which is chosen by dsn, nil means no auth.
+func smtpAuth(mdsn *dsn.MailDSN) (smtp.Auth, error) {
+	switch mdsn.Auth {
+	case dsn.MailAuthNone:
+		return nil, nil
+	case dsn.MailAuthPlain, "":
+		return smtp.PlainAuth("", mdsn.User, mdsn.Password, mdsn.Host), nil
+	case dsn.MailAuthLogin:
+		return &loginAuth{username: mdsn.User, password: mdsn.Password, host: mdsn.Host}, nil
+	case dsn.MailAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(mdsn.User, mdsn.Password), nil
+	case dsn.MailAuthXOAUTH2:
+		return &xoauth2Auth{username: mdsn.User, token: mdsn.Password}, nil
+	default:
+		return nil, xerrors.Errorf("unsupported smtp auth: %s", mdsn.Auth)
+	}
+}
@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"net/smtp"
+	"testing"
+)
+
+func TestLoginAuth(t *testing.T) {
+	t.Helper()
+
+	a := &loginAuth{username: "user", password: "pass", host: "smtp.example.com"}
+
+	if _, _, err := a.Start(&smtp.ServerInfo{Name: "smtp.example.com"}); err == nil {
+		t.Error("login auth must refuse unencrypted connection")
+	}
+	if _, _, err := a.Start(&smtp.ServerInfo{Name: "other.example.com", TLS: true}); err == nil {
+		t.Error("login auth must refuse wrong host name")
+	}
+	proto, resp, err := a.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true})
+	if err != nil || proto != "LOGIN" || resp != nil {
+		t.Errorf("login auth start error: %s %q %s", proto, resp, err)
+	}
+
+	for challenge, want := range map[string]string{
+		"Username:":  "user",
+		"username":   "user",
+		"User Name":  "user",
+		"Password:":  "pass",
+		" password ": "pass",
+	} {
+		if resp, err := a.Next([]byte(challenge), true); err != nil || string(resp) != want {
+			t.Errorf("login auth challenge %q error: %q %s", challenge, resp, err)
+		}
+	}
+	if _, err := a.Next([]byte("Token:"), true); err == nil {
+		t.Error("login auth must fail on unexpected challenge")
+	}
+	if resp, err := a.Next(nil, false); err != nil || resp != nil {
+		t.Errorf("login auth must finish: %q %s", resp, err)
+	}
+}
+
+func TestXOAUTH2Auth(t *testing.T) {
+	t.Helper()
+
+	a := &xoauth2Auth{username: "user@example.com", token: "token"}
+
+	if _, _, err := a.Start(&smtp.ServerInfo{Name: "smtp.example.com"}); err == nil {
+		t.Error("xoauth2 auth must refuse unencrypted connection")
+	}
+	proto, resp, err := a.Start(&smtp.ServerInfo{Name: "localhost"})
+	if err != nil || proto != "XOAUTH2" || string(resp) != "user=user@example.com\x01auth=Bearer token\x01\x01" {
+		t.Errorf("xoauth2 auth start error: %s %q %s", proto, resp, err)
+	}
+
+	// an error detail is answered by an empty response to receive the actual error
+	resp, err = a.Next([]byte(`{"status":"401","schemes":"Bearer"}`), true)
+	if err != nil || resp == nil || len(resp) != 0 {
+		t.Errorf("xoauth2 auth challenge error: %q %s", resp, err)
+	}
+	if resp, err := a.Next(nil, false); err != nil || resp != nil {
+		t.Errorf("xoauth2 auth must finish: %q %s", resp, err)
+	}
+}
@@ -0,0 +1,320 @@
+package mail
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// EventType is a kind of feedback of a sent mail
+type EventType string
+
+// Event types
+const (
+	// EventBounce means a mail couldn't be delivered, see Event.Permanent for hard or soft.
+	EventBounce EventType = "bounce"
+	// EventComplaint means a recipient marked a mail as spam.
+	EventComplaint EventType = "complaint"
+	// EventDelivery means a mail was delivered.
+	EventDelivery EventType = "delivery"
+)
+
+type (
+	// Event is a bounce, complaint or delivery event which is parsed from
+	// DSN (RFC 3464) or provider webhooks.
+	Event struct {
+		Type EventType
+		// Permanent is true when a bounce is hard bounce.
+		Permanent bool
+		Recipient string
+		// Status is an enhanced status code. e.g. 5.1.1
+		Status     string
+		Diagnostic string
+		// MessageID is a Message-ID header of the original mail.
+		MessageID string
+		// ProviderID is a message id which is issued by HTTP API provider.
+		ProviderID string
+		// Feedback is a complaint feedback type. e.g. abuse
+		Feedback  string
+		Timestamp time.Time
+		// Source is one of "dsn", "ses" and "sendgrid".
+		Source string
+	}
+)
+
+// ParseDSN parses a delivery status notification (RFC 3464) message into events.
+func ParseDSN(r io.Reader) ([]*Event, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid dsn message: %w", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, xerrors.Errorf("invalid dsn content type: %w", err)
+	}
+	if mediaType != "multipart/report" || !strings.EqualFold(params["report-type"], "delivery-status") {
+		return nil, xerrors.Errorf("not a delivery status notification: %s", mediaType)
+	}
+
+	timestamp, _ := msg.Header.Date()
+
+	var (
+		recipients []textproto.MIMEHeader
+		messageID  string
+	)
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("invalid dsn part: %w", err)
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "message/delivery-status", "message/global-delivery-status":
+			if recipients, err = parseDeliveryStatus(part); err != nil {
+				return nil, err
+			}
+		case "text/rfc822-headers", "message/rfc822", "message/global-headers":
+			h, err := textproto.NewReader(bufio.NewReader(part)).ReadMIMEHeader()
+			if err != nil && len(h) == 0 {
+				continue
+			}
+			messageID = h.Get("Message-Id")
+		}
+	}
+
+	events := make([]*Event, 0, len(recipients))
+	for _, h := range recipients {
+		e := &Event{
+			Type:       EventBounce,
+			Recipient:  dsnValue(h.Get("Final-Recipient")),
+			Status:     h.Get("Status"),
+			Diagnostic: dsnValue(h.Get("Diagnostic-Code")),
+			MessageID:  messageID,
+			Timestamp:  timestamp,
+			Source:     "dsn",
+		}
+		if e.Recipient == "" {
+			e.Recipient = dsnValue(h.Get("Original-Recipient"))
+		}
+
+		switch strings.ToLower(h.Get("Action")) {
+		case "failed":
+			e.Permanent = !strings.HasPrefix(e.Status, "4")
+		case "delayed":
+		case "delivered", "relayed", "expanded":
+			e.Type = EventDelivery
+		default:
+			continue
+		}
+
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+// parseDeliveryStatus returns per-recipient fields, per-message fields are skipped.
+func parseDeliveryStatus(r io.Reader) ([]textproto.MIMEHeader, error) {
+	tr := textproto.NewReader(bufio.NewReader(r))
+
+	var groups []textproto.MIMEHeader
+	for {
+		h, err := tr.ReadMIMEHeader()
+		if len(h) > 0 {
+			groups = append(groups, h)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("invalid delivery status: %w", err)
+		}
+	}
+	if len(groups) < 2 {
+		return nil, xerrors.New("delivery status hasn't recipient fields")
+	}
+
+	return groups[1:], nil
+}
+
+// dsnValue removes type prefix. e.g. "rfc822; taro@example.com" or "smtp; 550 5.1.1 User unknown"
+func dsnValue(v string) string {
+	if i := strings.Index(v, ";"); i >= 0 {
+		v = v[i+1:]
+	}
+	return strings.TrimSpace(v)
+}
+
+type (
+	snsNotification struct {
+		Type    string `json:"Type"`
+		Message string `json:"Message"`
+	}
+
+	sesRecipient struct {
+		EmailAddress   string `json:"emailAddress"`
+		Status         string `json:"status"`
+		DiagnosticCode string `json:"diagnosticCode"`
+	}
+
+	sesNotification struct {
+		NotificationType string `json:"notificationType"`
+		EventType        string `json:"eventType"`
+		Mail             struct {
+			MessageID     string `json:"messageId"`
+			CommonHeaders struct {
+				MessageID string `json:"messageId"`
+			} `json:"commonHeaders"`
+		} `json:"mail"`
+		Bounce struct {
+			BounceType        string         `json:"bounceType"`
+			BouncedRecipients []sesRecipient `json:"bouncedRecipients"`
+			Timestamp         time.Time      `json:"timestamp"`
+		} `json:"bounce"`
+		Complaint struct {
+			ComplainedRecipients  []sesRecipient `json:"complainedRecipients"`
+			ComplaintFeedbackType string         `json:"complaintFeedbackType"`
+			Timestamp             time.Time      `json:"timestamp"`
+		} `json:"complaint"`
+		Delivery struct {
+			Recipients []string  `json:"recipients"`
+			Timestamp  time.Time `json:"timestamp"`
+		} `json:"delivery"`
+	}
+)
+
+// ParseSES parses Amazon SES notification which is delivered by SNS into events,
+// SNS subscription confirmation returns no events.
+func ParseSES(body []byte) ([]*Event, error) {
+	var sns snsNotification
+	if err := json.Unmarshal(body, &sns); err != nil {
+		return nil, xerrors.Errorf("invalid ses notification: %w", err)
+	}
+
+	// Raw message delivery is enabled when SNS envelope is missing.
+	msg := body
+	switch sns.Type {
+	case "Notification":
+		msg = []byte(sns.Message)
+	case "SubscriptionConfirmation", "UnsubscribeConfirmation":
+		return nil, nil
+	}
+
+	var n sesNotification
+	if err := json.Unmarshal(msg, &n); err != nil {
+		return nil, xerrors.Errorf("invalid ses notification message: %w", err)
+	}
+
+	kind := n.NotificationType
+	if kind == "" {
+		kind = n.EventType
+	}
+
+	base := Event{
+		MessageID:  n.Mail.CommonHeaders.MessageID,
+		ProviderID: n.Mail.MessageID,
+		Source:     "ses",
+	}
+
+	var events []*Event
+	switch kind {
+	case "Bounce":
+		for _, r := range n.Bounce.BouncedRecipients {
+			e := base
+			e.Type = EventBounce
+			e.Permanent = n.Bounce.BounceType == "Permanent"
+			e.Recipient = r.EmailAddress
+			e.Status = r.Status
+			e.Diagnostic = r.DiagnosticCode
+			e.Timestamp = n.Bounce.Timestamp
+			events = append(events, &e)
+		}
+	case "Complaint":
+		for _, r := range n.Complaint.ComplainedRecipients {
+			e := base
+			e.Type = EventComplaint
+			e.Recipient = r.EmailAddress
+			e.Feedback = n.Complaint.ComplaintFeedbackType
+			e.Timestamp = n.Complaint.Timestamp
+			events = append(events, &e)
+		}
+	case "Delivery":
+		for _, r := range n.Delivery.Recipients {
+			e := base
+			e.Type = EventDelivery
+			e.Recipient = r
+			e.Timestamp = n.Delivery.Timestamp
+			events = append(events, &e)
+		}
+	}
+
+	return events, nil
+}
+
+type (
+	sendgridEvent struct {
+		Email       string `json:"email"`
+		Event       string `json:"event"`
+		Type        string `json:"type"`
+		Status      string `json:"status"`
+		Reason      string `json:"reason"`
+		SMTPID      string `json:"smtp-id"`
+		SGMessageID string `json:"sg_message_id"`
+		Timestamp   int64  `json:"timestamp"`
+	}
+)
+
+// ParseSendGrid parses SendGrid event webhook payload into events,
+// events which aren't bounce, complaint or delivery are skipped.
+func ParseSendGrid(body []byte) ([]*Event, error) {
+	var payload []sendgridEvent
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, xerrors.Errorf("invalid sendgrid events: %w", err)
+	}
+
+	var events []*Event
+	for _, p := range payload {
+		e := &Event{
+			Recipient:  p.Email,
+			Status:     p.Status,
+			Diagnostic: p.Reason,
+			MessageID:  p.SMTPID,
+			ProviderID: p.SGMessageID,
+			Timestamp:  time.Unix(p.Timestamp, 0),
+			Source:     "sendgrid",
+		}
+
+		switch p.Event {
+		case "bounce":
+			e.Type = EventBounce
+			e.Permanent = p.Type != "blocked"
+		case "deferred":
+			e.Type = EventBounce
+		case "spamreport":
+			e.Type = EventComplaint
+		case "delivered":
+			e.Type = EventDelivery
+		default:
+			continue
+		}
+
+		events = append(events, e)
+	}
+
+	return events, nil
+}
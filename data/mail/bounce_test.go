@@ -0,0 +1,142 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+)
+
+const dsnMessage = "From: MAILER-DAEMON@mx.example.com\r\n" +
+	"To: noreply@example.com\r\n" +
+	"Subject: Undelivered Mail Returned to Sender\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 +0900\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/report; report-type=delivery-status; boundary=\"BOUNDARY\"\r\n" +
+	"\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"I'm sorry to have to inform you that your message could not be delivered.\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: message/delivery-status\r\n" +
+	"\r\n" +
+	"Reporting-MTA: dns; mx.example.com\r\n" +
+	"Arrival-Date: Mon, 02 Jan 2006 15:04:00 +0900\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; unknown@example.org\r\n" +
+	"Action: failed\r\n" +
+	"Status: 5.1.1\r\n" +
+	"Diagnostic-Code: smtp; 550 5.1.1 User unknown\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; full@example.org\r\n" +
+	"Action: delayed\r\n" +
+	"Status: 4.2.2\r\n" +
+	"Diagnostic-Code: smtp; 452 4.2.2 Mailbox full\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: text/rfc822-headers\r\n" +
+	"\r\n" +
+	"From: noreply@example.com\r\n" +
+	"Message-Id: <01HQ3K5X6Y7Z8A9B0C1D2E3F4G@example.com>\r\n" +
+	"Subject: Hello\r\n" +
+	"--BOUNDARY--\r\n"
+
+func TestParseDSN(t *testing.T) {
+	t.Helper()
+
+	events, err := ParseDSN(strings.NewReader(dsnMessage))
+	if err != nil {
+		t.Fatalf("parse dsn failed: %s", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("parse dsn events error: %d", len(events))
+	}
+
+	hard := events[0]
+	if hard.Type != EventBounce || !hard.Permanent || hard.Recipient != "unknown@example.org" {
+		t.Errorf("parse dsn hard bounce error: %#+v", hard)
+	}
+	if hard.Status != "5.1.1" || hard.Diagnostic != "550 5.1.1 User unknown" {
+		t.Errorf("parse dsn status error: %#+v", hard)
+	}
+	if hard.MessageID != "<01HQ3K5X6Y7Z8A9B0C1D2E3F4G@example.com>" {
+		t.Errorf("parse dsn message id error: %s", hard.MessageID)
+	}
+	if hard.Timestamp.IsZero() {
+		t.Error("parse dsn timestamp is zero")
+	}
+
+	soft := events[1]
+	if soft.Type != EventBounce || soft.Permanent || soft.Recipient != "full@example.org" {
+		t.Errorf("parse dsn soft bounce error: %#+v", soft)
+	}
+
+	if _, err := ParseDSN(strings.NewReader("Subject: Hello\r\nContent-Type: text/plain\r\n\r\nbody")); err == nil {
+		t.Error("parse dsn must be error for plain message")
+	}
+}
+
+func TestParseSES(t *testing.T) {
+	t.Helper()
+
+	body := `{
+  "Type": "Notification",
+  "MessageId": "sns-message-id",
+  "Message": "{\"notificationType\":\"Bounce\",\"bounce\":{\"bounceType\":\"Permanent\",\"bouncedRecipients\":[{\"emailAddress\":\"unknown@example.org\",\"status\":\"5.1.1\",\"diagnosticCode\":\"smtp; 550 5.1.1 user unknown\"}],\"timestamp\":\"2024-01-02T03:04:05.000Z\"},\"mail\":{\"messageId\":\"ses-message-id\",\"commonHeaders\":{\"messageId\":\"<id@example.com>\"}}}"
+}`
+
+	events, err := ParseSES([]byte(body))
+	if err != nil {
+		t.Fatalf("parse ses failed: %s", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("parse ses events error: %d", len(events))
+	}
+	e := events[0]
+	if e.Type != EventBounce || !e.Permanent || e.Recipient != "unknown@example.org" || e.Status != "5.1.1" {
+		t.Errorf("parse ses bounce error: %#+v", e)
+	}
+	if e.MessageID != "<id@example.com>" || e.ProviderID != "ses-message-id" {
+		t.Errorf("parse ses ids error: %#+v", e)
+	}
+
+	raw := `{"eventType":"Complaint","complaint":{"complainedRecipients":[{"emailAddress":"angry@example.org"}],"complaintFeedbackType":"abuse","timestamp":"2024-01-02T03:04:05.000Z"},"mail":{"messageId":"ses-message-id"}}`
+	events, err = ParseSES([]byte(raw))
+	if err != nil {
+		t.Fatalf("parse ses failed: %s", err)
+	}
+	if len(events) != 1 || events[0].Type != EventComplaint || events[0].Feedback != "abuse" {
+		t.Errorf("parse ses complaint error: %#+v", events)
+	}
+
+	events, err = ParseSES([]byte(`{"Type":"SubscriptionConfirmation","SubscribeURL":"https://sns.example.com"}`))
+	if err != nil || len(events) != 0 {
+		t.Errorf("parse ses subscription must be no events: %#+v %v", events, err)
+	}
+}
+
+func TestParseSendGrid(t *testing.T) {
+	t.Helper()
+
+	body := `[
+  {"email":"unknown@example.org","event":"bounce","type":"bounce","status":"5.1.1","reason":"550 5.1.1 User unknown","sg_message_id":"sg-id","smtp-id":"<id@example.com>","timestamp":1700000000},
+  {"email":"blocked@example.org","event":"bounce","type":"blocked","status":"5.7.1","timestamp":1700000000},
+  {"email":"angry@example.org","event":"spamreport","timestamp":1700000000},
+  {"email":"taro@example.org","event":"open","timestamp":1700000000}
+]`
+
+	events, err := ParseSendGrid([]byte(body))
+	if err != nil {
+		t.Fatalf("parse sendgrid failed: %s", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("parse sendgrid events error: %d", len(events))
+	}
+	if !events[0].Permanent || events[0].MessageID != "<id@example.com>" || events[0].ProviderID != "sg-id" {
+		t.Errorf("parse sendgrid bounce error: %#+v", events[0])
+	}
+	if events[1].Permanent {
+		t.Errorf("parse sendgrid blocked must be soft: %#+v", events[1])
+	}
+	if events[2].Type != EventComplaint {
+		t.Errorf("parse sendgrid complaint error: %#+v", events[2])
+	}
+}
@@ -0,0 +1,102 @@
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"strings"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/dsn"
+)
+
+type (
+	// dkimSigner signs a rendered message by DKIM-Signature header.
+	dkimSigner struct {
+		domain, selector string
+		key              crypto.Signer
+	}
+)
+
+// newDKIMSigner returns nil when dsn doesn't have DKIM options.
+func newDKIMSigner(mdsn *dsn.MailDSN) (*dkimSigner, error) {
+	if !mdsn.HasDKIM() {
+		return nil, nil
+	}
+
+	key, err := parseDKIMKey(mdsn.DKIMKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dkimSigner{domain: mdsn.DKIMDomain, selector: mdsn.DKIMSelector, key: key}, nil
+}
+
+// parseDKIMKey accepts PEM encoded key or a file path of it, the key is PKCS#1 RSA or PKCS#8 RSA/Ed25519.
+func parseDKIMKey(key string) (crypto.Signer, error) {
+	data := []byte(key)
+	if !strings.HasPrefix(strings.TrimSpace(key), "-----BEGIN") {
+		b, err := os.ReadFile(key)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read dkim key: %w", err)
+		}
+		data = b
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, xerrors.New("invalid dkim key: no PEM block")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid dkim rsa key: %w", err)
+		}
+		return k, nil
+	case "PRIVATE KEY":
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid dkim key: %w", err)
+		}
+		switch k := k.(type) {
+		case *rsa.PrivateKey:
+			return k, nil
+		case ed25519.PrivateKey:
+			return k, nil
+		default:
+			return nil, xerrors.Errorf("unsupported dkim key: %T", k)
+		}
+	default:
+		return nil, xerrors.Errorf("unsupported dkim key type: %s", block.Type)
+	}
+}
+
+// Sign returns raw message with DKIM-Signature, or raw as is when signer is nil.
+func (s *dkimSigner) Sign(raw []byte) ([]byte, error) {
+	if s == nil {
+		return raw, nil
+	}
+
+	opts := &dkim.SignOptions{
+		Domain:                 s.domain,
+		Selector:               s.selector,
+		Signer:                 s.key,
+		HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+		BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+	}
+
+	var b bytes.Buffer
+	if err := dkim.Sign(&b, bytes.NewReader(raw), opts); err != nil {
+		return nil, xerrors.Errorf("failed to sign dkim: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,101 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+
+	"github.com/eiicon-company/go-core/util/dsn"
+)
+
+func verifyDKIM(t *testing.T, raw []byte, record string) {
+	t.Helper()
+
+	vs, err := dkim.VerifyWithOptions(bytes.NewReader(raw), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			if domain != "s1._domainkey.example.com" {
+				t.Errorf("dkim lookup domain error: %s", domain)
+			}
+			return []string{record}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("dkim verify failed: %s", err)
+	}
+	if len(vs) != 1 || vs[0].Err != nil {
+		t.Fatalf("dkim verification error: %#+v", vs)
+	}
+}
+
+func TestDKIMSignEd25519(t *testing.T) {
+	t.Helper()
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(priv)
+	key := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	signer, err := newDKIMSigner(&dsn.MailDSN{DKIMDomain: "example.com", DKIMSelector: "s1", DKIMKey: key})
+	if err != nil {
+		t.Fatalf("dkim signer failed: %s", err)
+	}
+
+	msg, err := render(&Data{To: []string{"taro@example.com"}, From: "noreply@example.com", Subject: "Hello", Text: []byte("text")})
+	if err != nil {
+		t.Fatalf("render failed: %s", err)
+	}
+	raw, err := signer.Sign(msg.Raw)
+	if err != nil {
+		t.Fatalf("dkim sign failed: %s", err)
+	}
+
+	verifyDKIM(t, raw, "v=DKIM1; k=ed25519; p="+base64.StdEncoding.EncodeToString(pub))
+}
+
+func TestDKIMSignRSAFile(t *testing.T) {
+	t.Helper()
+
+	priv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	path := filepath.Join(t.TempDir(), "private.pem")
+	key := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		t.Fatalf("write key failed: %s", err)
+	}
+
+	signer, err := newDKIMSigner(&dsn.MailDSN{DKIMDomain: "example.com", DKIMSelector: "s1", DKIMKey: path})
+	if err != nil {
+		t.Fatalf("dkim signer failed: %s", err)
+	}
+
+	msg, err := render(&Data{To: []string{"taro@example.com"}, From: "noreply@example.com", Subject: "こんにちは", HTML: []byte("<p>html</p>")})
+	if err != nil {
+		t.Fatalf("render failed: %s", err)
+	}
+	raw, err := signer.Sign(msg.Raw)
+	if err != nil {
+		t.Fatalf("dkim sign failed: %s", err)
+	}
+
+	pub, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	verifyDKIM(t, raw, "v=DKIM1; k=rsa; p="+base64.StdEncoding.EncodeToString(pub))
+}
+
+func TestDKIMSignNil(t *testing.T) {
+	t.Helper()
+
+	signer, err := newDKIMSigner(&dsn.MailDSN{})
+	if err != nil || signer != nil {
+		t.Fatalf("dkim signer must be nil: %#+v %v", signer, err)
+	}
+	if raw, _ := signer.Sign([]byte("raw")); string(raw) != "raw" {
+		t.Errorf("nil dkim signer must return raw: %s", raw)
+	}
+}
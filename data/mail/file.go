@@ -0,0 +1,35 @@
+package mail
+
+import (
+	"github.com/eiicon-company/go-core/util/dsn"
+)
+
+type (
+	// fileMail writes rendered mails into a folder as .eml files instead of sending.
+	fileMail struct {
+		dsn    *dsn.MailDSN
+		dkim   *dkimSigner
+		outbox Outbox
+	}
+)
+
+func (m *fileMail) Send(data *Data) error {
+	_, err := m.Deliver(data)
+	return err
+}
+
+func (m *fileMail) Deliver(data *Data) (*Receipt, error) {
+	msg, err := render(data)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Raw, err = m.dkim.Sign(msg.Raw); err != nil {
+		return nil, err
+	}
+
+	if err := m.outbox.Put(msg.ID, msg.Raw); err != nil {
+		return nil, err
+	}
+
+	return &Receipt{MessageID: msg.ID, Accepted: msg.To}, nil
+}
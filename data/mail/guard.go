@@ -0,0 +1,115 @@
+package mail
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/eiicon-company/go-core/util/logger"
+)
+
+type (
+	// guardMail prevents from sending mails to real customers except production.
+	//
+	// Recipients which don't match allow list are redirected to redirect address,
+	// or dropped when redirect address is blank.
+	guardMail struct {
+		mail     Mail
+		allow    []string
+		redirect string
+	}
+)
+
+// NewGuard wraps a mailer by recipient guard.
+//
+// allow accepts domains (example.com, @example.com) which also match subdomains,
+// and addresses (someone@example.com).
+func NewGuard(m Mail, allow []string, redirect string) Mail {
+	g := &guardMail{mail: m, redirect: strings.TrimSpace(redirect)}
+	for _, a := range allow {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a != "" {
+			g.allow = append(g.allow, a)
+		}
+	}
+	return g
+}
+
+func (g *guardMail) Send(data *Data) error {
+	_, err := g.Deliver(data)
+	return err
+}
+
+func (g *guardMail) Deliver(data *Data) (*Receipt, error) {
+	data, id := prepare(data)
+
+	var rewritten []string
+	seen := map[string]bool{}
+
+	guard := func(addrs []string) []string {
+		var list []string
+		for _, addr := range addrs {
+			if !g.allowed(addr) {
+				rewritten = append(rewritten, addr)
+				if g.redirect == "" {
+					continue
+				}
+				addr = g.redirect
+			}
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			list = append(list, addr)
+		}
+		return list
+	}
+
+	data.To = guard(data.To)
+	data.Cc = guard(data.Cc)
+	data.Bcc = guard(data.Bcc)
+
+	if len(rewritten) == 0 {
+		return Deliver(g.mail, data)
+	}
+
+	original := strings.Join(rewritten, ", ")
+	data.Subject = fmt.Sprintf("[guard: %s] %s", original, data.Subject)
+
+	if len(data.To)+len(data.Cc)+len(data.Bcc) == 0 {
+		msg := "[INFO] mail guard dropped a mail <%s> to <%s>"
+		logger.Printf(msg, id, original)
+
+		return &Receipt{MessageID: id}, nil
+	}
+	msg := "[INFO] mail guard rewrote a mail <%s> recipients <%s> to <%s>"
+	logger.Printf(msg, id, original, g.redirect)
+
+	return Deliver(g.mail, data)
+}
+
+// allowed returns true when address matches allow list.
+func (g *guardMail) allowed(addr string) bool {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return false
+	}
+	address := strings.ToLower(a.Address)
+	domain := address[strings.LastIndex(address, "@")+1:]
+
+	for _, allow := range g.allow {
+		switch {
+		case strings.Contains(strings.TrimPrefix(allow, "@"), "@"):
+			if address == allow {
+				return true
+			}
+		default:
+			allow = strings.TrimPrefix(allow, "@")
+			if domain == allow || strings.HasSuffix(domain, "."+allow) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
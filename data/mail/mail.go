@@ -1,11 +1,26 @@
 package mail
 
 import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ses"
+	"golang.org/x/xerrors"
+
 	"github.com/eiicon-company/go-core/util"
 	"github.com/eiicon-company/go-core/util/dsn"
+	"github.com/eiicon-company/go-core/util/graceful"
 	"github.com/eiicon-company/go-core/util/logger"
 )
 
+var (
+	// ErrRejected is returned when all of recipients were rejected or suppressed,
+	// recipients which were rejected partially are reported by Receipt.Rejected.
+	ErrRejected = xerrors.New("recipients rejected")
+)
+
 type (
 	// Data sends data
 	Data struct {
@@ -17,6 +32,8 @@ type (
 		Text    []byte
 		HTML    []byte
 		Headers map[string][]string
+		// Charset is one of Charset* constants, default is UTF-8. SendGrid supports UTF-8 only.
+		Charset string
 	}
 
 	// Mail provides interface for sends some of kinda E-Mail.
@@ -24,8 +41,48 @@ type (
 		Send(*Data) error
 		// TODO: SendWithAttachment
 	}
+
+	// Receipt has a detail of a sent mail.
+	Receipt struct {
+		// MessageID is a Message-ID header which we generated, or given by Data.Headers.
+		MessageID string
+		// ProviderID is a message id which is issued by HTTP API provider.
+		ProviderID string
+		// Accepted has recipients which server accepted.
+		Accepted []string
+		// Rejected has recipients which server rejected or suppression dropped.
+		Rejected []Rejection
+		// Response is a raw response of server. e.g. "250 2.0.0 Ok: queued as 4Bx..."
+		Response string
+	}
+
+	// Rejection is a recipient which server rejected.
+	Rejection struct {
+		Address string
+		Code    int
+		Message string
+	}
+
+	// Deliverer is implemented by mailers which can report a receipt.
+	Deliverer interface {
+		Deliver(*Data) (*Receipt, error)
+	}
 )
 
+// Deliver sends data and returns a receipt, a receipt only has MessageID
+// when the mailer doesn't implement Deliverer.
+func Deliver(m Mail, data *Data) (*Receipt, error) {
+	if d, ok := m.(Deliverer); ok {
+		return d.Deliver(data)
+	}
+
+	data, id := prepare(data)
+	if err := m.Send(data); err != nil {
+		return nil, err
+	}
+	return &Receipt{MessageID: id}, nil
+}
+
 func newMail(env util.Environment) Mail {
 	mailURI := env.EnvString("MAILURI")
 
@@ -35,17 +92,133 @@ func newMail(env util.Environment) Mail {
 		logger.Panicf(msg, mailURI, err)
 	}
 
+	// MAILDKIMDOMAIN=example.com MAILDKIMSELECTOR=s1 MAILDKIMKEY=<PEM or path>
+	if !mdsn.HasDKIM() && env.EnvString("MAILDKIMKEY") != "" {
+		mdsn.DKIMDomain = env.EnvString("MAILDKIMDOMAIN")
+		mdsn.DKIMSelector = env.EnvString("MAILDKIMSELECTOR")
+		mdsn.DKIMKey = env.EnvString("MAILDKIMKEY")
+	}
+
+	m := selectMail(mailURI, mdsn)
+
+	// MAILSUPPRESSIONURI=redis://127.0.0.1:6379/3
+	if uri := env.EnvString("MAILSUPPRESSIONURI"); uri != "" {
+		pool, err := util.SelectRedisConn(uri)
+		if err != nil {
+			msg := "[PANIC] failed to connect mail suppression <%s>: %s"
+			logger.Panicf(msg, uri, err)
+		}
+
+		m = NewSuppressed(m, NewRedisSuppression(pool))
+	}
+
+	if env.IsProd() || mdsn.StdOut || mdsn.Folder != "" {
+		return m
+	}
+
+	// MAILALLOW=example.com,someone@gmail.com MAILREDIRECT=qa@example.com
+	allow := strings.Split(env.EnvString("MAILALLOW"), ",")
+	redirect := env.EnvString("MAILREDIRECT")
+	if env.EnvString("MAILALLOW") == "" && redirect == "" {
+		logger.Printf("[WARN] A E-Mailer drops all recipients, set MAILALLOW or MAILREDIRECT except production")
+		return NewGuard(m, nil, "")
+	}
+
+	msg := "[INFO] A E-Mailer is guarded recipients allow <%s> redirect <%s>"
+	logger.Printf(msg, env.EnvString("MAILALLOW"), redirect)
+
+	return NewGuard(m, allow, redirect)
+}
+
+// SelectMail can choose mail connection
+func SelectMail(mailURI string) Mail {
+	mdsn, err := dsn.Mail(mailURI)
+	if err != nil {
+		msg := "[PANIC] failed to parse email uri <%s>: %s"
+		logger.Panicf(msg, mailURI, err)
+	}
+
+	return selectMail(mailURI, mdsn)
+}
+
+func selectMail(mailURI string, mdsn *dsn.MailDSN) Mail {
+	signer, err := newDKIMSigner(mdsn)
+	if err != nil {
+		msg := "[PANIC] failed to load dkim key <%s>: %s"
+		logger.Panicf(msg, mdsn.DKIMDomain, err)
+	}
+	if signer != nil {
+		msg := "[INFO] A E-Mailer signs DKIM by domain <%s> selector <%s>"
+		logger.Printf(msg, mdsn.DKIMDomain, mdsn.DKIMSelector)
+	}
+
 	// smtp or file or stdout
-	if mdsn.StdOut {
-		msg := "[INFO] A E-Mailer is chosen stdout by <%s>"
-		logger.Printf(msg, mailURI)
+	if mdsn.StdOut || mdsn.Folder != "" {
+		var outbox Outbox
+		if mdsn.Folder != "" {
+			outbox = NewFolderOutbox(mdsn.Folder)
+		} else if mdsn.Preview != "" {
+			outbox = NewMemoryOutbox(100)
+		}
+
+		if mdsn.Preview != "" {
+			msg := "[INFO] A E-Mailer preview is served on <http://%s>"
+			logger.Printf(msg, mdsn.Preview)
+
+			graceful.PostHook(servePreview(mdsn.Preview, outbox))
+		}
 
-		return &stdoutMail{dsn: mdsn}
+		if mdsn.StdOut {
+			msg := "[INFO] A E-Mailer is chosen stdout by <%s>"
+			logger.Printf(msg, mailURI)
 
+			return &stdoutMail{dsn: mdsn, outbox: outbox}
+		}
+
+		msg := "[INFO] A E-Mailer is chosen file by <%s>"
+		logger.Printf(msg, mdsn.Folder)
+
+		return &fileMail{dsn: mdsn, dkim: signer, outbox: outbox}
+	}
+
+	switch mdsn.Provider {
+	case dsn.MailProviderSES:
+		msg := "[INFO] A E-Mailer is chosen Amazon SES by <%s>"
+		logger.Printf(msg, aws.StringValue(mdsn.Sess.Config.Region))
+
+		return &sesMail{dsn: mdsn, dkim: signer, client: ses.New(mdsn.Sess)}
+	case dsn.MailProviderSendGrid:
+		msg := "[INFO] A E-Mailer is chosen SendGrid by <%s>"
+		logger.Printf(msg, mdsn.Endpoint)
+
+		if signer != nil {
+			logger.Printf("[WARN] SendGrid doesn't accept raw message, configure DKIM in SendGrid domain authentication")
+		}
+
+		return &sendgridMail{dsn: mdsn, client: newHTTPClient()}
+	case dsn.MailProviderMailgun:
+		msg := "[INFO] A E-Mailer is chosen Mailgun by <%s> domain <%s>"
+		logger.Printf(msg, mdsn.Endpoint, mdsn.Domain)
+
+		return &mailgunMail{dsn: mdsn, dkim: signer, client: newHTTPClient()}
+	}
+
+	if mdsn.Pool {
+		msg := "[INFO] A E-Mailer is chosen pooled SMTP Server by <%s> max connections %d"
+		logger.Printf(msg, mdsn.Addr, mdsn.PoolMaxConns)
+
+		p := newSMTPPool(mdsn, signer)
+		graceful.PostHook(func() { _ = p.Close() })
+
+		return p
 	}
 
 	msg := "[INFO] A E-Mailer is chosen SMTP Server by <%s>"
 	logger.Printf(msg, mdsn.Addr)
 
-	return &smtpMail{dsn: mdsn}
+	return &smtpMail{dsn: mdsn, dkim: signer}
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second}
 }
@@ -0,0 +1,92 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/dsn"
+)
+
+type (
+	// mailgunMail sends a raw message through Mailgun v3 messages.mime API.
+	mailgunMail struct {
+		dsn    *dsn.MailDSN
+		dkim   *dkimSigner
+		client *http.Client
+	}
+
+	mailgunResponse struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	}
+)
+
+func (m *mailgunMail) Send(data *Data) error {
+	_, err := m.Deliver(data)
+	return err
+}
+
+func (m *mailgunMail) Deliver(data *Data) (*Receipt, error) {
+	msg, err := render(data)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Raw, err = m.dkim.Sign(msg.Raw); err != nil {
+		return nil, err
+	}
+
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for _, addr := range msg.To {
+		if err := w.WriteField("to", addr); err != nil {
+			return nil, xerrors.Errorf("mailgun request failed: %w", err)
+		}
+	}
+	fw, err := w.CreateFormFile("message", "message.mime")
+	if err != nil {
+		return nil, xerrors.Errorf("mailgun request failed: %w", err)
+	}
+	if _, err := fw.Write(msg.Raw); err != nil {
+		return nil, xerrors.Errorf("mailgun request failed: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, xerrors.Errorf("mailgun request failed: %w", err)
+	}
+
+	uri := m.dsn.Endpoint + "/v3/" + m.dsn.Domain + "/messages.mime"
+	req, err := http.NewRequest(http.MethodPost, uri, body)
+	if err != nil {
+		return nil, xerrors.Errorf("mailgun request failed: %w", err)
+	}
+	req.SetBasicAuth("api", m.dsn.APIKey)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("mailgun send failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 != 2 {
+		return nil, xerrors.Errorf("mailgun send failed: status=%d body=%s", resp.StatusCode, detail)
+	}
+
+	var res mailgunResponse
+	if err := json.Unmarshal(detail, &res); err != nil {
+		return nil, xerrors.Errorf("mailgun response failed: %w", err)
+	}
+
+	receipt := &Receipt{
+		MessageID:  msg.ID,
+		ProviderID: res.ID,
+		Accepted:   msg.To,
+		Response:   res.Message,
+	}
+	return receipt, nil
+}
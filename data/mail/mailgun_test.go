@@ -0,0 +1,61 @@
+package mail
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eiicon-company/go-core/util/dsn"
+)
+
+func TestMailgunDeliver(t *testing.T) {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/mg.example.com/messages.mime" {
+			t.Errorf("mailgun path error: %s", r.URL.Path)
+		}
+		if user, pass, _ := r.BasicAuth(); user != "api" || pass != "key-xxx" {
+			t.Errorf("mailgun auth error: %s:%s", user, pass)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("mailgun form error: %s", err)
+		}
+		if to := r.MultipartForm.Value["to"]; len(to) != 2 {
+			t.Errorf("mailgun to error: %#+v", to)
+		}
+
+		f, _, err := r.FormFile("message")
+		if err != nil {
+			t.Fatalf("mailgun message error: %s", err)
+		}
+		raw, _ := io.ReadAll(f)
+		if !strings.Contains(string(raw), "Subject: Hello") {
+			t.Errorf("mailgun message error: %s", raw)
+		}
+
+		_, _ = w.Write([]byte(`{"id":"<mg-message-id@mg.example.com>","message":"Queued. Thank you."}`))
+	}))
+	defer srv.Close()
+
+	m := &mailgunMail{
+		dsn:    &dsn.MailDSN{Provider: dsn.MailProviderMailgun, APIKey: "key-xxx", Domain: "mg.example.com", Endpoint: srv.URL},
+		client: srv.Client(),
+	}
+
+	receipt, err := m.Deliver(&Data{
+		To:      []string{"taro@example.com"},
+		Cc:      []string{"hanako@example.com"},
+		From:    "noreply@example.com",
+		Subject: "Hello",
+		Text:    []byte("text"),
+	})
+	if err != nil {
+		t.Fatalf("mailgun deliver failed: %s", err)
+	}
+	if receipt.ProviderID != "<mg-message-id@mg.example.com>" {
+		t.Errorf("mailgun provider id error: %s", receipt.ProviderID)
+	}
+}
@@ -0,0 +1,108 @@
+package mail
+
+import (
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/identify"
+)
+
+type (
+	// message is a rendered mail along with SMTP envelope.
+	message struct {
+		ID   string   // Message-ID header
+		From string   // envelope sender
+		To   []string // envelope recipients
+		Raw  []byte
+	}
+)
+
+// NewMessageID returns a Message-ID header value which consists of ULID and sender domain.
+// e.g. <01HQ3K5X6Y7Z8A9B0C1D2E3F4G@example.com>
+func NewMessageID(from string) string {
+	domain := ""
+	if a, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(a.Address, "@"); i >= 0 {
+			domain = a.Address[i+1:]
+		}
+	}
+	if domain == "" {
+		if h, err := os.Hostname(); err == nil {
+			domain = h
+		} else {
+			domain = "localhost.localdomain"
+		}
+	}
+
+	return fmt.Sprintf("<%s@%s>", identify.ULIDNow(), domain)
+}
+
+// prepare returns a copy of data which headers are canonicalized and have Message-ID.
+func prepare(data *Data) (*Data, string) {
+	cp := *data
+	cp.Headers = make(map[string][]string, len(data.Headers)+1)
+	for k, v := range data.Headers {
+		k = textproto.CanonicalMIMEHeaderKey(k)
+		cp.Headers[k] = append(cp.Headers[k], v...)
+	}
+
+	id := textproto.MIMEHeader(cp.Headers).Get("Message-Id")
+	if id == "" {
+		id = NewMessageID(data.From)
+		cp.Headers["Message-Id"] = []string{id}
+	}
+
+	return &cp, id
+}
+
+// render returns envelope and raw message which is built from data.
+func render(data *Data) (*message, error) {
+	data, id := prepare(data)
+
+	from, to, err := envelope(data)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := compose(data)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to build mail: %w", err)
+	}
+
+	return &message{ID: id, From: from, To: to, Raw: raw}, nil
+}
+
+// envelope returns sender and recipients address which are used in SMTP envelope.
+func envelope(data *Data) (string, []string, error) {
+	to := make([]string, 0, len(data.To)+len(data.Cc)+len(data.Bcc))
+	to = append(append(append(to, data.To...), data.Cc...), data.Bcc...)
+	for i := range to {
+		addr, err := parseAddress(to[i])
+		if err != nil {
+			return "", nil, xerrors.Errorf("invalid recipient <%s>: %w", to[i], err)
+		}
+		to[i] = addr
+	}
+
+	from, err := parseAddress(data.From)
+	if err != nil {
+		return "", nil, xerrors.Errorf("invalid sender <%s>: %w", data.From, err)
+	}
+	if len(to) == 0 {
+		return "", nil, xerrors.New("must specify at least one recipient")
+	}
+
+	return from, to, nil
+}
+
+func parseAddress(addr string) (string, error) {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return "", err
+	}
+	return a.Address, nil
+}
@@ -0,0 +1,56 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewMessageID(t *testing.T) {
+	t.Helper()
+
+	id := NewMessageID("Support <support@example.com>")
+	if !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("message id error: %s", id)
+	}
+	if len(id) != len("<01HQ3K5X6Y7Z8A9B0C1D2E3F4G@example.com>") {
+		t.Errorf("message id must have ulid: %s", id)
+	}
+	if id == NewMessageID("support@example.com") {
+		t.Error("message id must be unique")
+	}
+}
+
+func TestRenderMessageID(t *testing.T) {
+	t.Helper()
+
+	data := &Data{
+		To:      []string{"taro@example.com"},
+		From:    "noreply@example.com",
+		Subject: "Hello",
+		Text:    []byte("text"),
+		Headers: map[string][]string{"X-Campaign": {"welcome"}},
+	}
+
+	msg, err := render(data)
+	if err != nil {
+		t.Fatalf("render failed: %s", err)
+	}
+	if !strings.Contains(string(msg.Raw), "Message-Id: "+msg.ID) {
+		t.Errorf("render must have generated message id: %s", msg.Raw)
+	}
+	if _, ok := data.Headers["Message-Id"]; ok {
+		t.Error("render must not modify given headers")
+	}
+
+	data.Headers = map[string][]string{"Message-ID": {"<given@example.com>"}}
+	msg, err = render(data)
+	if err != nil {
+		t.Fatalf("render failed: %s", err)
+	}
+	if msg.ID != "<given@example.com>" {
+		t.Errorf("render must keep given message id: %s", msg.ID)
+	}
+	if strings.Count(string(msg.Raw), "Message-Id:") != 1 {
+		t.Errorf("render must have one message id: %s", msg.Raw)
+	}
+}
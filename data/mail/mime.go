@@ -0,0 +1,365 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/width"
+	"golang.org/x/xerrors"
+)
+
+// Charsets for mail headers and bodies
+const (
+	// CharsetUTF8 is a default charset.
+	CharsetUTF8 = "UTF-8"
+	// CharsetISO2022JP is a legacy charset which is required by some of japanese clients.
+	CharsetISO2022JP = "ISO-2022-JP"
+)
+
+const (
+	// maxLineLen is a recommended line length of RFC 5322 excluding CRLF.
+	maxLineLen = 76
+	// maxWordLen is a max length of an encoded-word of RFC 2047.
+	maxWordLen = 75
+	// max7bitLineLen is a max line length of 7bit body excluding CRLF.
+	max7bitLineLen = 998
+)
+
+type (
+	// charset encodes headers and bodies along with a charset.
+	charset struct {
+		name string
+	}
+)
+
+func newCharset(name string) (*charset, error) {
+	switch strings.ToUpper(name) {
+	case "", CharsetUTF8, "UTF8":
+		return &charset{name: CharsetUTF8}, nil
+	case CharsetISO2022JP:
+		return &charset{name: CharsetISO2022JP}, nil
+	default:
+		return nil, xerrors.Errorf("unsupported charset: %s", name)
+	}
+}
+
+// bytes converts UTF-8 string into the charset.
+func (c *charset) bytes(s string) ([]byte, error) {
+	if c.name == CharsetUTF8 {
+		return []byte(s), nil
+	}
+
+	// halfwidth katakana is escaped by JIS X 0201 which isn't allowed in ISO-2022-JP (RFC 1468).
+	s = strings.Map(func(r rune) rune {
+		if 0xff61 <= r && r <= 0xff9f {
+			if w, _ := utf8.DecodeRuneInString(width.Widen.String(string(r))); w != utf8.RuneError {
+				return w
+			}
+		}
+		return r
+	}, s)
+
+	b, err := japanese.ISO2022JP.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		return nil, xerrors.Errorf("%s can't encode <%s>: %w", c.name, s, err)
+	}
+	return b, nil
+}
+
+// words returns B encoded-words of RFC 2047, each word is self-contained in the charset.
+// The first word is shortened to first length so that it fits after a header name.
+func (c *charset) words(s string, first int) ([]string, error) {
+	prefix := "=?" + c.name + "?B?"
+	rawLen := func(wordLen int) int {
+		return (wordLen - len(prefix) - len("?=")) / 4 * 3
+	}
+	maxRaw := rawLen(min(first, maxWordLen))
+	if maxRaw < 6 {
+		maxRaw = rawLen(maxWordLen)
+	}
+
+	var (
+		words []string
+		chunk []rune
+		last  []byte
+	)
+	for _, r := range s {
+		b, err := c.bytes(string(append(chunk, r)))
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > maxRaw && len(chunk) > 0 {
+			words = append(words, prefix+base64.StdEncoding.EncodeToString(last)+"?=")
+			maxRaw = rawLen(maxWordLen)
+			chunk = chunk[:0]
+			if b, err = c.bytes(string(r)); err != nil {
+				return nil, err
+			}
+		}
+		chunk = append(chunk, r)
+		last = b
+	}
+	if len(chunk) > 0 {
+		words = append(words, prefix+base64.StdEncoding.EncodeToString(last)+"?=")
+	}
+
+	return words, nil
+}
+
+// tokens returns a header value as foldable tokens, non-ASCII value is encoded.
+func (c *charset) tokens(name, s string) ([]string, error) {
+	if isASCII(s) {
+		return strings.Split(s, " "), nil
+	}
+	return c.words(s, maxLineLen-len(name)-len(": "))
+}
+
+// addresses returns address list as foldable tokens with encoded display names.
+func (c *charset) addresses(name string, list []string) ([]string, error) {
+	var tokens []string
+	for i, addr := range list {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid address <%s>: %w", addr, err)
+		}
+
+		var ts []string
+		switch {
+		case a.Name == "":
+			ts = []string{"<" + a.Address + ">"}
+		case isASCII(a.Name):
+			ts = strings.Split(a.String(), " ")
+		default:
+			first := maxWordLen
+			if i == 0 {
+				first = maxLineLen - len(name) - len(": ")
+			}
+			words, err := c.words(a.Name, first)
+			if err != nil {
+				return nil, err
+			}
+			ts = append(words, "<"+a.Address+">")
+		}
+
+		if i < len(list)-1 {
+			ts[len(ts)-1] += ","
+		}
+		tokens = append(tokens, ts...)
+	}
+	return tokens, nil
+}
+
+// body returns encoded body along with Content-Transfer-Encoding.
+func (c *charset) body(b []byte) ([]byte, string, error) {
+	if c.name == CharsetUTF8 {
+		buf := &bytes.Buffer{}
+		w := quotedprintable.NewWriter(buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, "", err
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "quoted-printable", nil
+	}
+
+	enc, err := c.bytes(strings.ReplaceAll(string(b), "\r\n", "\n"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	lines := strings.Split(string(enc), "\n")
+	for _, line := range lines {
+		if len(line) > max7bitLineLen {
+			return []byte(wrapBase64(enc)), "base64", nil
+		}
+	}
+	return []byte(strings.Join(lines, "\r\n")), "7bit", nil
+}
+
+// fold writes a header field which is folded at tokens.
+func fold(buf *bytes.Buffer, name string, tokens []string) {
+	line := name + ":"
+	for _, t := range tokens {
+		if len(line)+1+len(t) > maxLineLen && strings.TrimSpace(line) != name+":" {
+			buf.WriteString(line)
+			buf.WriteString("\r\n")
+			line = ""
+		}
+		line += " " + t
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
+
+// compose builds a raw message from data which is prepared.
+func compose(data *Data) ([]byte, error) {
+	cs, err := newCharset(data.Charset)
+	if err != nil {
+		return nil, err
+	}
+
+	custom := textproto.MIMEHeader(data.Headers)
+	buf := &bytes.Buffer{}
+
+	writeAddresses := func(name string, list []string) error {
+		if vs := custom.Values(name); len(vs) > 0 {
+			list = vs
+		}
+		if len(list) == 0 {
+			return nil
+		}
+		tokens, err := cs.addresses(name, list)
+		if err != nil {
+			return xerrors.Errorf("invalid %s header: %w", name, err)
+		}
+		fold(buf, name, tokens)
+		return nil
+	}
+	writeText := func(name, value string) error {
+		if custom.Get(name) != "" {
+			value = custom.Get(name)
+		}
+		if value == "" {
+			return nil
+		}
+		tokens, err := cs.tokens(name, value)
+		if err != nil {
+			return xerrors.Errorf("invalid %s header: %w", name, err)
+		}
+		fold(buf, name, tokens)
+		return nil
+	}
+
+	if err := writeAddresses("From", []string{data.From}); err != nil {
+		return nil, err
+	}
+	if err := writeAddresses("To", data.To); err != nil {
+		return nil, err
+	}
+	if err := writeAddresses("Cc", data.Cc); err != nil {
+		return nil, err
+	}
+	if err := writeAddresses("Reply-To", nil); err != nil {
+		return nil, err
+	}
+	if err := writeText("Subject", data.Subject); err != nil {
+		return nil, err
+	}
+	if err := writeText("Date", time.Now().Format(time.RFC1123Z)); err != nil {
+		return nil, err
+	}
+	if err := writeText("Message-Id", ""); err != nil {
+		return nil, err
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	keys := make([]string, 0, len(custom))
+	for k := range custom {
+		switch k {
+		case "From", "To", "Cc", "Bcc", "Reply-To", "Subject", "Date", "Message-Id",
+			"Mime-Version", "Content-Type", "Content-Transfer-Encoding":
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range custom[k] {
+			tokens, err := cs.tokens(k, v)
+			if err != nil {
+				return nil, xerrors.Errorf("invalid %s header: %w", k, err)
+			}
+			fold(buf, k, tokens)
+		}
+	}
+
+	if err := composeBody(buf, cs, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func composeBody(buf *bytes.Buffer, cs *charset, data *Data) error {
+	type part struct {
+		mediaType string
+		body      []byte
+	}
+
+	var parts []part
+	if data.Text != nil {
+		parts = append(parts, part{"text/plain", data.Text})
+	}
+	if data.HTML != nil {
+		parts = append(parts, part{"text/html", data.HTML})
+	}
+	if len(parts) == 0 {
+		parts = append(parts, part{"text/plain", nil})
+	}
+
+	if len(parts) == 1 {
+		body, cte, err := cs.body(parts[0].body)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "Content-Type: %s; charset=%s\r\n", parts[0].mediaType, cs.name)
+		fmt.Fprintf(buf, "Content-Transfer-Encoding: %s\r\n\r\n", cte)
+		buf.Write(body)
+		return nil
+	}
+
+	w := multipart.NewWriter(buf)
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative;\r\n boundary=%s\r\n\r\n", w.Boundary())
+
+	for _, p := range parts {
+		body, cte, err := cs.body(p.body)
+		if err != nil {
+			return err
+		}
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {fmt.Sprintf("%s; charset=%s", p.mediaType, cs.name)},
+			"Content-Transfer-Encoding": {cte},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := pw.Write(body); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf || s[i] < ' ' {
+			return false
+		}
+	}
+	return true
+}
+
+func wrapBase64(b []byte) string {
+	s := base64.StdEncoding.EncodeToString(b)
+
+	var sb strings.Builder
+	for len(s) > maxLineLen {
+		sb.WriteString(s[:maxLineLen])
+		sb.WriteString("\r\n")
+		s = s[maxLineLen:]
+	}
+	sb.WriteString(s)
+	return sb.String()
+}
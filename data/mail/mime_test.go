@@ -0,0 +1,126 @@
+package mail
+
+import (
+	"bytes"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+func decodeHeader(t *testing.T, raw []byte, name string) string {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("read message failed: %s", err)
+	}
+
+	v, err := previewDecoder.DecodeHeader(msg.Header.Get(name))
+	if err != nil {
+		t.Fatalf("decode header failed: %s", err)
+	}
+	return v
+}
+
+func assertLineLength(t *testing.T, raw []byte) {
+	t.Helper()
+
+	header := raw[:bytes.Index(raw, []byte("\r\n\r\n"))]
+	for _, line := range strings.Split(string(header), "\r\n") {
+		if len(line) > maxLineLen+2 {
+			t.Errorf("header line is too long %d: %s", len(line), line)
+		}
+	}
+}
+
+func TestComposeISO2022JP(t *testing.T) {
+	t.Helper()
+
+	subject := "【重要】ご登録いただいたアカウント情報の確認とパスワード再設定のお願い ｶﾀｶﾅ"
+	msg, err := render(&Data{
+		To:      []string{"山田 太郎 <taro@example.com>", "hanako@example.com"},
+		From:    "株式会社サンプル サポートセンター <support@example.com>",
+		Subject: subject,
+		Text:    []byte("山田様\nいつもご利用ありがとうございます。\n"),
+		Charset: CharsetISO2022JP,
+	})
+	if err != nil {
+		t.Fatalf("render failed: %s", err)
+	}
+
+	assertLineLength(t, msg.Raw)
+
+	if got := decodeHeader(t, msg.Raw, "Subject"); got != strings.Replace(subject, "ｶﾀｶﾅ", "カタカナ", 1) {
+		t.Errorf("subject error: %s", got)
+	}
+	if got := decodeHeader(t, msg.Raw, "To"); got != "山田 太郎 <taro@example.com>, <hanako@example.com>" {
+		t.Errorf("to error: %s", got)
+	}
+	if got := decodeHeader(t, msg.Raw, "From"); got != "株式会社サンプル サポートセンター <support@example.com>" {
+		t.Errorf("from error: %s", got)
+	}
+
+	raw := string(msg.Raw)
+	if !strings.Contains(raw, "Content-Type: text/plain; charset=ISO-2022-JP\r\n") {
+		t.Errorf("content type error: %s", raw)
+	}
+	if !strings.Contains(raw, "Content-Transfer-Encoding: 7bit\r\n") {
+		t.Errorf("content transfer encoding error: %s", raw)
+	}
+
+	body := msg.Raw[bytes.Index(msg.Raw, []byte("\r\n\r\n"))+4:]
+	text, _ := japanese.ISO2022JP.NewDecoder().Bytes(body)
+	if string(text) != "山田様\r\nいつもご利用ありがとうございます。\r\n" {
+		t.Errorf("body error: %q", text)
+	}
+}
+
+func TestComposeISO2022JPUnsupported(t *testing.T) {
+	t.Helper()
+
+	_, err := render(&Data{
+		To:      []string{"taro@example.com"},
+		From:    "support@example.com",
+		Subject: "絵文字 🎉",
+		Charset: CharsetISO2022JP,
+	})
+	if err == nil {
+		t.Error("emoji can't be encoded by ISO-2022-JP")
+	}
+
+	_, err = render(&Data{To: []string{"taro@example.com"}, From: "support@example.com", Charset: "Shift_JIS"})
+	if err == nil {
+		t.Error("unsupported charset must be error")
+	}
+}
+
+func TestComposeUTF8(t *testing.T) {
+	t.Helper()
+
+	subject := "【重要】ご登録いただいたアカウント情報の確認とパスワード再設定のお願い 🎉"
+	msg, err := render(&Data{
+		To:      []string{"taro@example.com"},
+		From:    "support@example.com",
+		Subject: subject,
+		Text:    []byte("text"),
+		HTML:    []byte("<p>html</p>"),
+		Headers: map[string][]string{"X-Campaign": {"ウェルカム"}},
+	})
+	if err != nil {
+		t.Fatalf("render failed: %s", err)
+	}
+
+	assertLineLength(t, msg.Raw)
+
+	if got := decodeHeader(t, msg.Raw, "Subject"); got != subject {
+		t.Errorf("subject error: %s", got)
+	}
+	if got := decodeHeader(t, msg.Raw, "X-Campaign"); got != "ウェルカム" {
+		t.Errorf("custom header error: %s", got)
+	}
+	if !strings.Contains(string(msg.Raw), "multipart/alternative") {
+		t.Errorf("multipart error: %s", msg.Raw)
+	}
+}
@@ -0,0 +1,169 @@
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// outboxExt is a file extension of mails which are written by folder outbox
+const outboxExt = ".eml"
+
+type (
+	// Outbox keeps raw messages which are captured instead of sending, those are shown by preview server.
+	Outbox interface {
+		// Put stores a raw message by Message-ID.
+		Put(id string, raw []byte) error
+		// List returns keys of messages, newest first.
+		List() ([]string, error)
+		// Get returns a raw message by key.
+		Get(key string) ([]byte, error)
+	}
+
+	// memoryOutbox keeps recent messages in memory.
+	memoryOutbox struct {
+		mu   sync.RWMutex
+		max  int
+		keys []string
+		raws map[string][]byte
+	}
+
+	// folderOutbox writes messages into .eml files in a folder.
+	folderOutbox struct {
+		folder string
+	}
+)
+
+// NewMemoryOutbox returns outbox which keeps max messages at most in memory.
+func NewMemoryOutbox(max int) Outbox {
+	return &memoryOutbox{max: max, raws: map[string][]byte{}}
+}
+
+// NewFolderOutbox returns outbox which writes .eml files into a folder.
+func NewFolderOutbox(folder string) Outbox {
+	return &folderOutbox{folder: folder}
+}
+
+// outboxKey makes a Message-ID safe for file names and URL path.
+// e.g. <01HQ3K5X6Y7Z8A9B0C1D2E3F4G@example.com> => 01HQ3K5X6Y7Z8A9B0C1D2E3F4G@example.com
+func outboxKey(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		case r == '@' || r == '.' || r == '-' || r == '_':
+			return r
+		case r == '<' || r == '>':
+			return -1
+		default:
+			return '_'
+		}
+	}, id)
+}
+
+func (o *memoryOutbox) Put(id string, raw []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	key := outboxKey(id)
+	if _, ok := o.raws[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.raws[key] = raw
+
+	for len(o.keys) > o.max {
+		delete(o.raws, o.keys[0])
+		o.keys = o.keys[1:]
+	}
+	return nil
+}
+
+func (o *memoryOutbox) List() ([]string, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	keys := make([]string, 0, len(o.keys))
+	for i := len(o.keys) - 1; i >= 0; i-- {
+		keys = append(keys, o.keys[i])
+	}
+	return keys, nil
+}
+
+func (o *memoryOutbox) Get(key string) ([]byte, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	raw, ok := o.raws[key]
+	if !ok {
+		return nil, xerrors.Errorf("mail outbox <%s>: %w", key, os.ErrNotExist)
+	}
+	return raw, nil
+}
+
+func (o *folderOutbox) Put(id string, raw []byte) error {
+	if err := os.MkdirAll(o.folder, 0o750); err != nil {
+		return xerrors.Errorf("failed to create mail folder: %w", err)
+	}
+
+	filename := filepath.Join(o.folder, outboxKey(id)+outboxExt)
+	if err := os.WriteFile(filename, raw, 0o600); err != nil {
+		return xerrors.Errorf("failed to write mail <%s>: %w", filename, err)
+	}
+	return nil
+}
+
+func (o *folderOutbox) List() ([]string, error) {
+	entries, err := os.ReadDir(o.folder)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read mail folder: %w", err)
+	}
+
+	type file struct {
+		key   string
+		mtime int64
+	}
+
+	files := make([]file, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != outboxExt {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{key: strings.TrimSuffix(e.Name(), outboxExt), mtime: info.ModTime().UnixNano()})
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].mtime == files[j].mtime {
+			return files[i].key > files[j].key
+		}
+		return files[i].mtime > files[j].mtime
+	})
+
+	keys := make([]string, len(files))
+	for i, f := range files {
+		keys[i] = f.key
+	}
+	return keys, nil
+}
+
+func (o *folderOutbox) Get(key string) ([]byte, error) {
+	if key != outboxKey(key) {
+		return nil, xerrors.Errorf("invalid mail outbox key <%s>: %w", key, os.ErrNotExist)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(o.folder, key+outboxExt))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read mail <%s>: %w", key, err)
+	}
+	return raw, nil
+}
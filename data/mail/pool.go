@@ -0,0 +1,241 @@
+package mail
+
+import (
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/dsn"
+	"github.com/eiicon-company/go-core/util/logger"
+)
+
+// poolHealthCheckAfter checks connection by NOOP when it was idle longer than this.
+const poolHealthCheckAfter = 5 * time.Second
+
+var (
+	// ErrPoolClosed is returned when sends mail after pool was closed.
+	ErrPoolClosed = xerrors.New("smtp pool closed")
+)
+
+type (
+	// smtpPool sends mails through authenticated connections which are reused across sends.
+	smtpPool struct {
+		dsn  *dsn.MailDSN
+		dkim *dkimSigner
+
+		sem  chan struct{} // limits max connections
+		done chan struct{}
+
+		mu     sync.Mutex
+		idle   []*smtpConn
+		closed bool
+	}
+
+	smtpConn struct {
+		*smtp.Client
+		conn  net.Conn
+		sends int
+		used  time.Time
+	}
+)
+
+func newSMTPPool(mdsn *dsn.MailDSN, signer *dkimSigner) *smtpPool {
+	p := &smtpPool{
+		dsn:  mdsn,
+		dkim: signer,
+		sem:  make(chan struct{}, mdsn.PoolMaxConns),
+		done: make(chan struct{}),
+	}
+
+	go p.reap()
+	return p
+}
+
+func (p *smtpPool) Send(data *Data) error {
+	_, err := p.Deliver(data)
+	return err
+}
+
+func (p *smtpPool) Deliver(data *Data) (*Receipt, error) {
+	msg, err := render(data)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Raw, err = p.dkim.Sign(msg.Raw); err != nil {
+		return nil, err
+	}
+
+	conn, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+
+	conn.deadline(smtpTimeout)
+	receipt, err := transmit(conn.Client, msg)
+	if receipt != nil && len(receipt.Accepted) > 0 {
+		conn.sends++
+	}
+
+	// replies are out of step after a transport error. e.g. DATA reply timed out
+	var terr *textproto.Error
+	if err == nil || xerrors.Is(err, ErrRejected) || xerrors.As(err, &terr) {
+		p.put(conn)
+	} else {
+		p.discard(conn)
+		<-p.sem
+	}
+	return receipt, err
+}
+
+// Close closes all of idle connections, the pool can't be used after this.
+func (p *smtpPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	for _, conn := range idle {
+		p.discard(conn)
+	}
+
+	return nil
+}
+
+// get returns an idle connection which is healthy or a new one.
+func (p *smtpPool) get() (*smtpConn, error) {
+	select {
+	case <-p.done:
+		return nil, ErrPoolClosed
+	default:
+	}
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-p.done:
+		return nil, ErrPoolClosed
+	}
+
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			<-p.sem
+			return nil, ErrPoolClosed
+		}
+
+		n := len(p.idle)
+		if n == 0 {
+			p.mu.Unlock()
+			break
+		}
+		conn := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+
+		idle := time.Since(conn.used)
+		if idle > p.dsn.PoolIdleTimeout {
+			p.discard(conn)
+			continue
+		}
+		if idle > poolHealthCheckAfter {
+			conn.deadline(smtpCheckTimeout)
+			if err := conn.Noop(); err != nil {
+				logger.Debugf("[DEBUG] smtp pool drops broken connection: %s", err)
+				p.discard(conn)
+				continue
+			}
+		}
+
+		return conn, nil
+	}
+
+	c, conn, err := dialSMTP(p.dsn)
+	if err != nil {
+		<-p.sem
+		return nil, err
+	}
+
+	return &smtpConn{Client: c, conn: conn}, nil
+}
+
+// put gives a connection back to pool when the connection is still reusable.
+func (p *smtpPool) put(conn *smtpConn) {
+	defer func() { <-p.sem }()
+
+	if conn.sends >= p.dsn.PoolMaxSends {
+		p.discard(conn)
+		return
+	}
+	conn.deadline(smtpCheckTimeout)
+	if conn.Reset() != nil {
+		p.discard(conn)
+		return
+	}
+
+	p.mu.Lock()
+	if !p.closed {
+		conn.used = time.Now()
+		p.idle = append(p.idle, conn)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+
+	p.discard(conn)
+}
+
+func (p *smtpPool) discard(conn *smtpConn) {
+	conn.deadline(smtpCheckTimeout)
+	if err := conn.Quit(); err != nil {
+		conn.Close()
+	}
+}
+
+// deadline limits following commands on the connection by d.
+func (c *smtpConn) deadline(d time.Duration) {
+	_ = c.conn.SetDeadline(time.Now().Add(d))
+}
+
+// reap closes idle connections which have been idle longer than idle timeout.
+func (p *smtpPool) reap() {
+	// MailDSN may be built without the parser, so ticker never gets zero
+	ticker := time.NewTicker(max(p.dsn.PoolIdleTimeout/2, dsn.MailPoolMinIdleTimeout/2))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		var stale []*smtpConn
+
+		p.mu.Lock()
+		alive := p.idle[:0]
+		for _, conn := range p.idle {
+			if time.Since(conn.used) > p.dsn.PoolIdleTimeout {
+				stale = append(stale, conn)
+			} else {
+				alive = append(alive, conn)
+			}
+		}
+		p.idle = alive
+		p.mu.Unlock()
+
+		for _, conn := range stale {
+			p.discard(conn)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/logger"
+)
+
+type (
+	// preview is a captured mail which is decoded for browsers.
+	preview struct {
+		Key, ID, From, To, Cc, Subject string
+		Date                           time.Time
+		Headers                        []previewHeader
+		Text, HTML                     string
+		Size                           int
+	}
+
+	previewHeader struct {
+		Name, Value string
+	}
+
+	// previewServer shows mails in outbox like letter_opener.
+	previewServer struct {
+		outbox Outbox
+	}
+)
+
+var previewDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// charsetReader decodes charsets which are produced by compose.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToUpper(charset) {
+	case "", CharsetUTF8, "UTF8", "US-ASCII":
+		return input, nil
+	case CharsetISO2022JP:
+		return japanese.ISO2022JP.NewDecoder().Reader(input), nil
+	default:
+		return nil, xerrors.Errorf("unsupported charset: %s", charset)
+	}
+}
+
+// NewPreview returns http handler which lists captured mails and renders HTML, text and headers.
+//
+//	GET /                    list of mails
+//	GET /messages/{key}      headers, text and HTML of a mail
+//	GET /messages/{key}/html HTML part which is sandboxed
+//	GET /messages/{key}/raw  raw message
+func NewPreview(outbox Outbox) http.Handler {
+	s := &previewServer{outbox: outbox}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.list)
+	mux.HandleFunc("GET /messages/{key}", s.show)
+	mux.HandleFunc("GET /messages/{key}/html", s.html)
+	mux.HandleFunc("GET /messages/{key}/raw", s.raw)
+	return mux
+}
+
+// servePreview starts preview server in background, the server is closed by returned function.
+func servePreview(addr string, outbox Outbox) func() {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           NewPreview(outbox),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Printf("[ERROR] mail preview server failed <%s>: %s", addr, err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}
+}
+
+func (s *previewServer) load(w http.ResponseWriter, r *http.Request) (*preview, []byte, bool) {
+	key := r.PathValue("key")
+
+	raw, err := s.outbox.Get(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+
+	p, err := parsePreview(key, raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return nil, nil, false
+	}
+	return p, raw, true
+}
+
+func (s *previewServer) list(w http.ResponseWriter, _ *http.Request) {
+	keys, err := s.outbox.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list := make([]*preview, 0, len(keys))
+	for _, key := range keys {
+		raw, err := s.outbox.Get(key)
+		if err != nil {
+			continue
+		}
+		p, err := parsePreview(key, raw)
+		if err != nil {
+			p = &preview{Key: key, Subject: "(broken) " + err.Error(), Size: len(raw)}
+		}
+		list = append(list, p)
+	}
+
+	s.render(w, previewListTmpl, list)
+}
+
+func (s *previewServer) show(w http.ResponseWriter, r *http.Request) {
+	if p, _, ok := s.load(w, r); ok {
+		s.render(w, previewShowTmpl, p)
+	}
+}
+
+func (s *previewServer) html(w http.ResponseWriter, r *http.Request) {
+	p, _, ok := s.load(w, r)
+	if !ok {
+		return
+	}
+
+	// scripts in mails mustn't run on the preview origin
+	w.Header().Set("Content-Security-Policy", "sandbox; script-src 'none'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = io.WriteString(w, p.HTML)
+}
+
+func (s *previewServer) raw(w http.ResponseWriter, r *http.Request) {
+	_, raw, ok := s.load(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(raw)
+}
+
+func (s *previewServer) render(w http.ResponseWriter, tmpl *template.Template, data interface{}) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
+
+// parsePreview decodes headers and text/HTML parts of a raw message.
+func parsePreview(key string, raw []byte) (*preview, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, xerrors.Errorf("invalid mail <%s>: %w", key, err)
+	}
+
+	decode := func(v string) string {
+		if d, err := previewDecoder.DecodeHeader(v); err == nil {
+			return d
+		}
+		return v
+	}
+
+	p := &preview{
+		Key:     key,
+		ID:      msg.Header.Get("Message-Id"),
+		From:    decode(msg.Header.Get("From")),
+		To:      decode(msg.Header.Get("To")),
+		Cc:      decode(msg.Header.Get("Cc")),
+		Subject: decode(msg.Header.Get("Subject")),
+		Size:    len(raw),
+	}
+	p.Date, _ = msg.Header.Date()
+
+	for name, values := range msg.Header {
+		for _, v := range values {
+			p.Headers = append(p.Headers, previewHeader{Name: name, Value: decode(v)})
+		}
+	}
+	sort.SliceStable(p.Headers, func(i, j int) bool { return p.Headers[i].Name < p.Headers[j].Name })
+
+	if err := p.walk(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body); err != nil {
+		return nil, xerrors.Errorf("invalid mail body <%s>: %w", key, err)
+	}
+
+	return p, nil
+}
+
+// walk collects the first text/plain and text/html parts.
+func (p *preview) walk(contentType, cte string, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := p.walk(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(cte) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	r, err := charsetReader(params["charset"], body)
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case mediaType == "text/plain" && p.Text == "":
+		p.Text = string(b)
+	case mediaType == "text/html" && p.HTML == "":
+		p.HTML = string(b)
+	}
+	return nil
+}
+
+const previewStyle = `<style>
+body{font-family:-apple-system,"Hiragino Sans",Meiryo,sans-serif;margin:0;color:#222}
+header{background:#333;color:#fff;padding:8px 16px}header a{color:#fff;text-decoration:none}
+main{padding:16px}table{border-collapse:collapse;width:100%}
+th,td{border-bottom:1px solid #ddd;padding:6px 8px;text-align:left;vertical-align:top;font-size:14px}
+th{white-space:nowrap;background:#f6f6f6}pre{white-space:pre-wrap;background:#f6f6f6;padding:12px}
+iframe{width:100%;height:70vh;border:1px solid #ddd}nav a{margin-right:12px}
+</style>`
+
+var previewListTmpl = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Mail Preview</title>` + previewStyle + `</head>
+<body><header><a href="/">Mail Preview</a></header><main>
+<table>
+<tr><th>Date</th><th>From</th><th>To</th><th>Subject</th><th>Size</th></tr>
+{{range .}}<tr>
+<td>{{if not .Date.IsZero}}{{.Date.Format "2006-01-02 15:04:05"}}{{end}}</td>
+<td>{{.From}}</td><td>{{.To}}</td>
+<td><a href="/messages/{{.Key}}">{{if .Subject}}{{.Subject}}{{else}}(no subject){{end}}</a></td>
+<td>{{.Size}}</td>
+</tr>{{else}}<tr><td colspan="5">No mails</td></tr>{{end}}
+</table>
+</main></body></html>`))
+
+var previewShowTmpl = template.Must(template.New("show").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Subject}}</title>` + previewStyle + `</head>
+<body><header><a href="/">Mail Preview</a></header><main>
+<h2>{{.Subject}}</h2>
+<nav>{{if .HTML}}<a href="#html">HTML</a>{{end}}{{if .Text}}<a href="#text">Text</a>{{end}}<a href="#headers">Headers</a><a href="/messages/{{.Key}}/raw">Raw</a></nav>
+{{if .HTML}}<h3 id="html">HTML</h3><iframe sandbox src="/messages/{{.Key}}/html"></iframe>{{end}}
+{{if .Text}}<h3 id="text">Text</h3><pre>{{.Text}}</pre>{{end}}
+<h3 id="headers">Headers</h3>
+<table>{{range .Headers}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>{{end}}</table>
+</main></body></html>`))
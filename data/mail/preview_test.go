@@ -0,0 +1,118 @@
+package mail
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eiicon-company/go-core/util/dsn"
+)
+
+func getPreview(t *testing.T, srv *httptest.Server, path string) (*http.Response, string) {
+	t.Helper()
+
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatalf("preview request failed: %s", err)
+	}
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(resp.Body)
+	return resp, string(b)
+}
+
+func TestPreviewStdout(t *testing.T) {
+	t.Helper()
+
+	outbox := NewMemoryOutbox(1)
+	m := &stdoutMail{dsn: &dsn.MailDSN{StdOut: true}, outbox: outbox}
+
+	if err := m.Send(&Data{To: []string{"old@example.com"}, From: "noreply@example.com", Subject: "Old"}); err != nil {
+		t.Fatalf("stdout send failed: %s", err)
+	}
+	receipt, err := m.Deliver(&Data{
+		To:      []string{"山田 太郎 <taro@example.com>"},
+		From:    "noreply@example.com",
+		Subject: "ニュースレター",
+		Text:    []byte("テキスト"),
+		HTML:    []byte(`<p>HTML本文</p><script>alert(1)</script>`),
+		Charset: CharsetISO2022JP,
+	})
+	if err != nil {
+		t.Fatalf("stdout deliver failed: %s", err)
+	}
+
+	srv := httptest.NewServer(NewPreview(outbox))
+	defer srv.Close()
+
+	_, body := getPreview(t, srv, "/")
+	if strings.Contains(body, "Old") {
+		t.Errorf("preview must drop old mails over max: %s", body)
+	}
+	key := outboxKey(receipt.MessageID)
+	if !strings.Contains(body, "ニュースレター") || !strings.Contains(body, "/messages/"+key) {
+		t.Errorf("preview list error: %s", body)
+	}
+
+	_, body = getPreview(t, srv, "/messages/"+key)
+	if !strings.Contains(body, "テキスト") || !strings.Contains(body, "山田 太郎") {
+		t.Errorf("preview show error: %s", body)
+	}
+	if !strings.Contains(body, `<iframe sandbox src="/messages/`+key+`/html">`) {
+		t.Errorf("preview show must sandbox html: %s", body)
+	}
+
+	resp, body := getPreview(t, srv, "/messages/"+key+"/html")
+	if !strings.Contains(body, "<p>HTML本文</p>") {
+		t.Errorf("preview html error: %s", body)
+	}
+	if !strings.Contains(resp.Header.Get("Content-Security-Policy"), "sandbox") {
+		t.Errorf("preview html must be sandboxed: %#+v", resp.Header)
+	}
+
+	if resp, _ := getPreview(t, srv, "/messages/unknown"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("preview unknown mail must be not found: %d", resp.StatusCode)
+	}
+}
+
+func TestPreviewFile(t *testing.T) {
+	t.Helper()
+
+	m := &fileMail{dsn: &dsn.MailDSN{}, outbox: NewFolderOutbox(t.TempDir())}
+
+	receipt, err := m.Deliver(&Data{
+		To:      []string{"taro@example.com"},
+		From:    "noreply@example.com",
+		Subject: "File mail",
+		Text:    []byte("quoted-printable = text"),
+	})
+	if err != nil {
+		t.Fatalf("file deliver failed: %s", err)
+	}
+	if strings.Join(receipt.Accepted, ",") != "taro@example.com" {
+		t.Errorf("file receipt error: %#+v", receipt)
+	}
+
+	keys, err := m.outbox.List()
+	if err != nil || len(keys) != 1 || keys[0] != outboxKey(receipt.MessageID) {
+		t.Fatalf("file outbox list error: %#+v %v", keys, err)
+	}
+	if _, err := m.outbox.Get("../" + keys[0]); err == nil {
+		t.Error("file outbox must reject path traversal")
+	}
+
+	srv := httptest.NewServer(NewPreview(m.outbox))
+	defer srv.Close()
+
+	_, body := getPreview(t, srv, "/messages/"+keys[0])
+	if !strings.Contains(body, "quoted-printable = text") || !strings.Contains(body, "File mail") {
+		t.Errorf("preview show error: %s", body)
+	}
+
+	_, body = getPreview(t, srv, "/messages/"+keys[0]+"/raw")
+	if !strings.Contains(body, "Message-Id: "+receipt.MessageID) {
+		t.Errorf("preview raw error: %s", body)
+	}
+}
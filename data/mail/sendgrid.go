@@ -0,0 +1,173 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/dsn"
+)
+
+type (
+	// sendgridMail sends mail through SendGrid v3 mail send API.
+	sendgridMail struct {
+		dsn    *dsn.MailDSN
+		client *http.Client
+	}
+
+	sendgridAddress struct {
+		Email string `json:"email"`
+		Name  string `json:"name,omitempty"`
+	}
+
+	sendgridPersonalization struct {
+		To  []sendgridAddress `json:"to"`
+		Cc  []sendgridAddress `json:"cc,omitempty"`
+		Bcc []sendgridAddress `json:"bcc,omitempty"`
+	}
+
+	sendgridContent struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+
+	sendgridRequest struct {
+		Personalizations []sendgridPersonalization `json:"personalizations"`
+		From             sendgridAddress           `json:"from"`
+		Subject          string                    `json:"subject"`
+		Content          []sendgridContent         `json:"content"`
+		Headers          map[string]string         `json:"headers,omitempty"`
+	}
+)
+
+func (m *sendgridMail) Send(data *Data) error {
+	_, err := m.Deliver(data)
+	return err
+}
+
+func (m *sendgridMail) Deliver(data *Data) (*Receipt, error) {
+	data, id := prepare(data)
+
+	r, err := m.request(data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, xerrors.Errorf("sendgrid request failed: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.dsn.Endpoint+"/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return nil, xerrors.Errorf("sendgrid request failed: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+m.dsn.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("sendgrid send failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, xerrors.Errorf("sendgrid send failed: status=%d body=%s", resp.StatusCode, detail)
+	}
+
+	receipt := &Receipt{
+		MessageID:  id,
+		ProviderID: resp.Header.Get("X-Message-Id"),
+		Response:   resp.Status,
+	}
+	for _, p := range r.Personalizations {
+		for _, list := range [][]sendgridAddress{p.To, p.Cc, p.Bcc} {
+			for _, a := range list {
+				receipt.Accepted = append(receipt.Accepted, a.Email)
+			}
+		}
+	}
+	return receipt, nil
+}
+
+func (m *sendgridMail) request(data *Data) (*sendgridRequest, error) {
+	// SendGrid encodes a message by itself and it's always UTF-8
+	cs, err := newCharset(data.Charset)
+	if err != nil {
+		return nil, err
+	}
+	if cs.name != CharsetUTF8 {
+		return nil, xerrors.Errorf("sendgrid doesn't support charset: %s", cs.name)
+	}
+
+	from, err := sendgridAddresses([]string{data.From})
+	if err != nil {
+		return nil, xerrors.Errorf("invalid sender <%s>: %w", data.From, err)
+	}
+
+	p := sendgridPersonalization{}
+	if p.To, err = sendgridAddresses(data.To); err != nil {
+		return nil, xerrors.Errorf("invalid recipient: %w", err)
+	}
+	if p.Cc, err = sendgridAddresses(data.Cc); err != nil {
+		return nil, xerrors.Errorf("invalid recipient: %w", err)
+	}
+	if p.Bcc, err = sendgridAddresses(data.Bcc); err != nil {
+		return nil, xerrors.Errorf("invalid recipient: %w", err)
+	}
+
+	r := &sendgridRequest{
+		From:    from[0],
+		Subject: data.Subject,
+	}
+
+	// SendGrid requires To in a personalization, Cc is visible anyway so it's used as To,
+	// and Bcc recipients get their own copies so that they aren't exposed to each other.
+	switch {
+	case len(p.To) > 0:
+		r.Personalizations = []sendgridPersonalization{p}
+	case len(p.Cc) > 0:
+		p.To, p.Cc = p.Cc, nil
+		r.Personalizations = []sendgridPersonalization{p}
+	default:
+		for _, bcc := range p.Bcc {
+			r.Personalizations = append(r.Personalizations, sendgridPersonalization{To: []sendgridAddress{bcc}})
+		}
+	}
+	if len(r.Personalizations) == 0 {
+		return nil, xerrors.New("must specify at least one recipient")
+	}
+
+	// text/plain must be first
+	if data.Text != nil {
+		r.Content = append(r.Content, sendgridContent{Type: "text/plain", Value: string(data.Text)})
+	}
+	if data.HTML != nil {
+		r.Content = append(r.Content, sendgridContent{Type: "text/html", Value: string(data.HTML)})
+	}
+	if len(data.Headers) > 0 {
+		r.Headers = map[string]string{}
+		for k, v := range data.Headers {
+			r.Headers[k] = strings.Join(v, ", ")
+		}
+	}
+
+	return r, nil
+}
+
+func sendgridAddresses(addrs []string) ([]sendgridAddress, error) {
+	var list []sendgridAddress
+	for _, addr := range addrs {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return nil, xerrors.Errorf("<%s>: %w", addr, err)
+		}
+		list = append(list, sendgridAddress{Email: a.Address, Name: a.Name})
+	}
+	return list, nil
+}
@@ -0,0 +1,135 @@
+package mail
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eiicon-company/go-core/util/dsn"
+)
+
+func TestSendGridDeliver(t *testing.T) {
+	t.Helper()
+
+	var got sendgridRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/mail/send" {
+			t.Errorf("sendgrid path error: %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer SG.key" {
+			t.Errorf("sendgrid auth error: %s", r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("sendgrid body error: %s", err)
+		}
+
+		w.Header().Set("X-Message-Id", "sg-message-id")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	m := &sendgridMail{
+		dsn:    &dsn.MailDSN{Provider: dsn.MailProviderSendGrid, APIKey: "SG.key", Endpoint: srv.URL},
+		client: srv.Client(),
+	}
+
+	receipt, err := m.Deliver(&Data{
+		To:      []string{"Taro <taro@example.com>"},
+		Bcc:     []string{"audit@example.com"},
+		From:    "noreply@example.com",
+		Subject: "Hello",
+		Text:    []byte("text"),
+		HTML:    []byte("<p>html</p>"),
+	})
+	if err != nil {
+		t.Fatalf("sendgrid deliver failed: %s", err)
+	}
+	if receipt.ProviderID != "sg-message-id" {
+		t.Errorf("sendgrid provider id error: %s", receipt.ProviderID)
+	}
+	if receipt.MessageID == "" || got.Headers["Message-Id"] != receipt.MessageID {
+		t.Errorf("sendgrid message id error: %s %#+v", receipt.MessageID, got.Headers)
+	}
+	if len(receipt.Accepted) != 2 {
+		t.Errorf("sendgrid accepted error: %#+v", receipt.Accepted)
+	}
+
+	p := got.Personalizations[0]
+	if p.To[0].Email != "taro@example.com" || p.To[0].Name != "Taro" {
+		t.Errorf("sendgrid to error: %#+v", p.To)
+	}
+	if len(p.Bcc) != 1 || p.Bcc[0].Email != "audit@example.com" {
+		t.Errorf("sendgrid bcc error: %#+v", p.Bcc)
+	}
+	if len(got.Content) != 2 || got.Content[0].Type != "text/plain" {
+		t.Errorf("sendgrid content error: %#+v", got.Content)
+	}
+}
+
+func TestSendGridDeliverError(t *testing.T) {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"errors":[{"message":"invalid api key"}]}`))
+	}))
+	defer srv.Close()
+
+	m := &sendgridMail{
+		dsn:    &dsn.MailDSN{Provider: dsn.MailProviderSendGrid, APIKey: "SG.key", Endpoint: srv.URL},
+		client: srv.Client(),
+	}
+
+	if err := m.Send(&Data{To: []string{"taro@example.com"}, From: "noreply@example.com"}); err == nil {
+		t.Error("sendgrid unauthorized must be error")
+	}
+}
+
+func TestSendGridRequestWithoutTo(t *testing.T) {
+	t.Helper()
+
+	m := &sendgridMail{dsn: &dsn.MailDSN{Provider: dsn.MailProviderSendGrid}}
+
+	r, err := m.request(&Data{Bcc: []string{"a@example.com", "b@example.com"}, From: "noreply@example.com"})
+	if err != nil {
+		t.Fatalf("sendgrid request failed: %s", err)
+	}
+	if len(r.Personalizations) != 2 {
+		t.Fatalf("bcc must be sent as own copies: %#+v", r.Personalizations)
+	}
+	for i, want := range []string{"a@example.com", "b@example.com"} {
+		if p := r.Personalizations[i]; len(p.To) != 1 || p.To[0].Email != want || len(p.Bcc) != 0 {
+			t.Errorf("bcc personalization error: %#+v", p)
+		}
+	}
+
+	r, err = m.request(&Data{Cc: []string{"c@example.com"}, Bcc: []string{"a@example.com"}, From: "noreply@example.com"})
+	if err != nil {
+		t.Fatalf("sendgrid request failed: %s", err)
+	}
+	if p := r.Personalizations; len(p) != 1 || p[0].To[0].Email != "c@example.com" || p[0].Bcc[0].Email != "a@example.com" {
+		t.Errorf("cc personalization error: %#+v", p)
+	}
+
+	if _, err := m.request(&Data{From: "noreply@example.com"}); err == nil {
+		t.Error("sendgrid request must have a recipient")
+	}
+}
+
+func TestSendGridRequestCharset(t *testing.T) {
+	t.Helper()
+
+	m := &sendgridMail{dsn: &dsn.MailDSN{Provider: dsn.MailProviderSendGrid}}
+
+	for _, cs := range []string{"", CharsetUTF8, "utf8"} {
+		if _, err := m.request(&Data{To: []string{"taro@example.com"}, From: "noreply@example.com", Charset: cs}); err != nil {
+			t.Errorf("sendgrid request with %q failed: %s", cs, err)
+		}
+	}
+	for _, cs := range []string{CharsetISO2022JP, "Shift_JIS"} {
+		if _, err := m.request(&Data{To: []string{"taro@example.com"}, From: "noreply@example.com", Charset: cs}); err == nil {
+			t.Errorf("sendgrid request must reject %q", cs)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ses"
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/dsn"
+)
+
+type (
+	// sesMail sends a raw message through Amazon SES SendRawEmail API.
+	sesMail struct {
+		dsn    *dsn.MailDSN
+		dkim   *dkimSigner
+		client *ses.SES
+	}
+)
+
+func (m *sesMail) Send(data *Data) error {
+	_, err := m.Deliver(data)
+	return err
+}
+
+func (m *sesMail) Deliver(data *Data) (*Receipt, error) {
+	msg, err := render(data)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Raw, err = m.dkim.Sign(msg.Raw); err != nil {
+		return nil, err
+	}
+
+	input := &ses.SendRawEmailInput{
+		Source:       aws.String(msg.From),
+		Destinations: aws.StringSlice(msg.To),
+		RawMessage:   &ses.RawMessage{Data: msg.Raw},
+	}
+	if m.dsn.ConfigSet != "" {
+		input.ConfigurationSetName = aws.String(m.dsn.ConfigSet)
+	}
+
+	out, err := m.client.SendRawEmail(input)
+	if err != nil {
+		return nil, xerrors.Errorf("ses send raw email failed: %w", err)
+	}
+
+	receipt := &Receipt{
+		MessageID:  msg.ID,
+		ProviderID: aws.StringValue(out.MessageId),
+		Accepted:   msg.To,
+		Response:   out.String(),
+	}
+	return receipt, nil
+}
@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ses"
+
+	"github.com/eiicon-company/go-core/util/dsn"
+)
+
+func TestSESDeliver(t *testing.T) {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ses form error: %s", err)
+		}
+		if r.Form.Get("Action") != "SendRawEmail" {
+			t.Errorf("ses action error: %s", r.Form.Get("Action"))
+		}
+		if r.Form.Get("ConfigurationSetName") != "tracking" {
+			t.Errorf("ses configset error: %s", r.Form.Get("ConfigurationSetName"))
+		}
+		if r.Form.Get("Destinations.member.1") != "taro@example.com" {
+			t.Errorf("ses destinations error: %s", r.Form.Get("Destinations.member.1"))
+		}
+
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(`<SendRawEmailResponse xmlns="http://ses.amazonaws.com/doc/2010-12-01/">
+  <SendRawEmailResult><MessageId>ses-message-id</MessageId></SendRawEmailResult>
+  <ResponseMetadata><RequestId>request-id</RequestId></ResponseMetadata>
+</SendRawEmailResponse>`))
+	}))
+	defer srv.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("ap-northeast-1"),
+		Endpoint:    aws.String(srv.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	if err != nil {
+		t.Fatalf("ses session failed: %s", err)
+	}
+
+	m := &sesMail{dsn: &dsn.MailDSN{Provider: dsn.MailProviderSES, ConfigSet: "tracking", Sess: sess}, client: ses.New(sess)}
+
+	receipt, err := m.Deliver(&Data{
+		To:      []string{"taro@example.com"},
+		From:    "noreply@example.com",
+		Subject: "Hello",
+		Text:    []byte("text"),
+	})
+	if err != nil {
+		t.Fatalf("ses deliver failed: %s", err)
+	}
+	if receipt.ProviderID != "ses-message-id" {
+		t.Errorf("ses provider id error: %s", receipt.ProviderID)
+	}
+}
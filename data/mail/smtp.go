@@ -2,45 +2,193 @@ package mail
 
 import (
 	"crypto/tls"
+	"fmt"
+	"net"
 	"net/smtp"
+	"net/textproto"
+	"time"
 
-	"github.com/jordan-wright/email"
+	"golang.org/x/xerrors"
 
 	"github.com/eiicon-company/go-core/util/dsn"
+	"github.com/eiicon-company/go-core/util/logger"
+)
+
+var (
+	// smtpDialTimeout limits connecting to smtp server.
+	smtpDialTimeout = 30 * time.Second
+	// smtpTimeout limits a handshake or a transaction of a mail on a connection.
+	smtpTimeout = 2 * time.Minute
+	// smtpCheckTimeout limits NOOP, RSET and QUIT of a pooled connection.
+	smtpCheckTimeout = 10 * time.Second
 )
 
 type (
 	smtpMail struct {
-		dsn *dsn.MailDSN
+		dsn  *dsn.MailDSN
+		dkim *dkimSigner
 	}
 )
 
 func (m *smtpMail) Send(data *Data) error {
-	e := email.NewEmail()
-	e.To = data.To
-	e.Bcc = data.Bcc
-	e.Cc = data.Cc
-	e.From = data.From
-	e.Subject = data.Subject
-	e.Headers = data.Headers
-	if data.Text != nil {
-		e.Text = data.Text
-	}
-	if data.HTML != nil {
-		e.HTML = data.HTML
-	}
-
-	auth := smtp.PlainAuth("",
-		m.dsn.User, m.dsn.Password, m.dsn.Host,
-	)
+	_, err := m.Deliver(data)
+	return err
+}
 
-	if !m.dsn.TLS {
-		return e.Send(m.dsn.Addr, auth)
+func (m *smtpMail) Deliver(data *Data) (*Receipt, error) {
+	msg, err := render(data)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Raw, err = m.dkim.Sign(msg.Raw); err != nil {
+		return nil, err
 	}
 
+	c, conn, err := dialSMTP(m.dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(smtpTimeout))
+	receipt, err := transmit(c, msg)
+	if receipt == nil || len(receipt.Accepted) == 0 {
+		return receipt, err
+	}
+	if qerr := c.Quit(); qerr != nil && err == nil {
+		return receipt, xerrors.Errorf("smtp QUIT failed: %w", qerr)
+	}
+	return receipt, err
+}
+
+// dialSMTP returns an authenticated client which is secured along with tls mode,
+// and its connection which is used to set deadlines.
+func dialSMTP(mdsn *dsn.MailDSN) (*smtp.Client, net.Conn, error) {
 	cfg := &tls.Config{
-		InsecureSkipVerify: true, //#nosec G402
-		ServerName:         m.dsn.TLSServer,
+		ServerName: mdsn.TLSServer,
+		MinVersion: tls.VersionTLS12,
+	}
+	if mdsn.Insecure {
+		cfg.InsecureSkipVerify = true //#nosec G402
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+	if mdsn.TLSMode == dsn.MailTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", mdsn.Addr, cfg)
+	} else {
+		conn, err = dialer.Dial("tcp", mdsn.Addr)
+	}
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to connect smtp server <%s>: %w", mdsn.Addr, err)
+	}
+	// a deadline of the raw connection also applies to STARTTLS connection
+	_ = conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	c, err := smtp.NewClient(conn, mdsn.TLSServer)
+	if err != nil {
+		conn.Close()
+		return nil, nil, xerrors.Errorf("failed to greet smtp server <%s>: %w", mdsn.Addr, err)
+	}
+	if err := c.Hello("localhost"); err != nil {
+		c.Close()
+		return nil, nil, xerrors.Errorf("failed to hello smtp server <%s>: %w", mdsn.Addr, err)
+	}
+
+	switch mdsn.TLSMode {
+	case dsn.MailTLSStartTLS, dsn.MailTLSOpportunistic, "":
+		ok, _ := c.Extension("STARTTLS")
+		if !ok && mdsn.TLSMode == dsn.MailTLSStartTLS {
+			c.Close()
+			return nil, nil, xerrors.Errorf("smtp server <%s> doesn't support STARTTLS", mdsn.Addr)
+		}
+		if ok {
+			if err := c.StartTLS(cfg); err != nil {
+				c.Close()
+				return nil, nil, xerrors.Errorf("failed to starttls smtp server <%s>: %w", mdsn.Addr, err)
+			}
+		}
 	}
-	return e.SendWithTLS(m.dsn.Addr, auth, cfg)
+
+	auth, err := smtpAuth(mdsn)
+	if err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			c.Close()
+			return nil, nil, xerrors.Errorf("smtp server <%s> doesn't support AUTH", mdsn.Addr)
+		}
+		if err := c.Auth(auth); err != nil {
+			c.Close()
+			return nil, nil, xerrors.Errorf("failed to authenticate smtp server <%s>: %w", mdsn.Addr, err)
+		}
+	}
+
+	return c, conn, nil
+}
+
+// transmit sends a raw message through established client.
+//
+// It keeps going when some of recipients were rejected and reports them by
+// the receipt, ErrRejected is returned only when all of them were rejected.
+func transmit(c *smtp.Client, msg *message) (*Receipt, error) {
+	if err := c.Mail(msg.From); err != nil {
+		return nil, xerrors.Errorf("smtp MAIL FROM <%s> failed: %w", msg.From, err)
+	}
+
+	receipt := &Receipt{MessageID: msg.ID}
+	for _, addr := range msg.To {
+		if err := c.Rcpt(addr); err != nil {
+			var terr *textproto.Error
+			if !xerrors.As(err, &terr) {
+				return nil, xerrors.Errorf("smtp RCPT TO <%s> failed: %w", addr, err)
+			}
+
+			receipt.Rejected = append(receipt.Rejected, Rejection{
+				Address: addr, Code: terr.Code, Message: terr.Msg,
+			})
+			continue
+		}
+		receipt.Accepted = append(receipt.Accepted, addr)
+	}
+	if len(receipt.Accepted) == 0 {
+		return receipt, xerrors.Errorf("smtp all of recipients: %w", ErrRejected)
+	}
+
+	// net/smtp doesn't expose DATA response which has a queue id
+	id, err := c.Text.Cmd("DATA")
+	if err != nil {
+		return nil, xerrors.Errorf("smtp DATA failed: %w", err)
+	}
+	c.Text.StartResponse(id)
+	_, _, err = c.Text.ReadResponse(354)
+	c.Text.EndResponse(id)
+	if err != nil {
+		return nil, xerrors.Errorf("smtp DATA failed: %w", err)
+	}
+
+	w := c.Text.DotWriter()
+	if _, err := w.Write(msg.Raw); err != nil {
+		return nil, xerrors.Errorf("smtp DATA write failed: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, xerrors.Errorf("smtp DATA close failed: %w", err)
+	}
+	code, resp, err := c.Text.ReadResponse(250)
+	if err != nil {
+		return nil, xerrors.Errorf("smtp DATA close failed: %w", err)
+	}
+	receipt.Response = fmt.Sprintf("%d %s", code, resp)
+
+	if len(receipt.Rejected) > 0 {
+		format := "[WARN] smtp server rejected %d of %d recipients of a mail <%s>"
+		logger.Printf(format, len(receipt.Rejected), len(msg.To), msg.ID)
+	}
+
+	return receipt, nil
 }
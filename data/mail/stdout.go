@@ -10,11 +10,29 @@ import (
 type (
 	stdoutMail struct {
 		dsn *dsn.MailDSN
+		// outbox is given when preview server is enabled
+		outbox Outbox
 	}
 )
 
 func (m *stdoutMail) Send(data *Data) error {
+	_, err := m.Deliver(data)
+	return err
+}
+
+func (m *stdoutMail) Deliver(data *Data) (*Receipt, error) {
+	data, id := prepare(data)
+
+	// make sure that the mail can be encoded along with charset as well as other mailers
+	msg, err := render(data)
+	if err != nil {
+		return nil, err
+	}
+	cs, _ := newCharset(data.Charset)
+
 	fmt.Printf("**************************************************\n")
+	fmt.Printf("Message-ID:%s\n", id)
+	fmt.Printf("Charset:%s\n", cs.name)
 	fmt.Printf("TO:%s\n", strings.Join(data.To, ","))
 	fmt.Printf("CC:%s\n", strings.Join(data.Cc, ","))
 	fmt.Printf("BCC:%s\n", strings.Join(data.Bcc, ","))
@@ -28,5 +46,16 @@ func (m *stdoutMail) Send(data *Data) error {
 		fmt.Println(string(data.HTML))
 	}
 	fmt.Println("**************************************************")
-	return nil
+
+	if m.outbox != nil {
+		if err := m.outbox.Put(id, msg.Raw); err != nil {
+			return nil, err
+		}
+	}
+
+	receipt := &Receipt{MessageID: id}
+	receipt.Accepted = append(receipt.Accepted, data.To...)
+	receipt.Accepted = append(receipt.Accepted, data.Cc...)
+	receipt.Accepted = append(receipt.Accepted, data.Bcc...)
+	return receipt, nil
 }
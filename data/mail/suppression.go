@@ -0,0 +1,204 @@
+package mail
+
+import (
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	radix "github.com/mediocregopher/radix/v3"
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/logger"
+)
+
+// suppressionPrefix is a redis key prefix of suppressed addresses
+const suppressionPrefix = "mail:suppression:"
+
+type (
+	// Suppression is a list of addresses which mustn't receive mails anymore.
+	Suppression interface {
+		// Add suppresses an address, ttl 0 means forever.
+		Add(addr, reason string, ttl time.Duration) error
+		// Has returns true when the address is suppressed.
+		Has(addr string) (bool, error)
+		// Remove unsuppresses an address.
+		Remove(addr string) error
+	}
+
+	// redisSuppression stores suppressed addresses into redis.
+	redisSuppression struct {
+		pool *radix.Pool
+	}
+
+	// memorySuppression stores suppressed addresses into memory.
+	memorySuppression struct {
+		mu    sync.RWMutex
+		addrs map[string]time.Time // expires, zero means forever
+	}
+
+	// suppressMail drops recipients which are in suppression list before sending.
+	suppressMail struct {
+		mail Mail
+		list Suppression
+	}
+)
+
+// NewRedisSuppression returns suppression list on redis, the pool is given by util.RedisConn.
+func NewRedisSuppression(pool *radix.Pool) Suppression {
+	return &redisSuppression{pool: pool}
+}
+
+// NewMemorySuppression returns suppression list on memory.
+func NewMemorySuppression() Suppression {
+	return &memorySuppression{addrs: map[string]time.Time{}}
+}
+
+// NewSuppressed wraps a mailer which consults suppression list before sending.
+func NewSuppressed(m Mail, list Suppression) Mail {
+	return &suppressMail{mail: m, list: list}
+}
+
+// Suppress adds addresses of hard bounces and complaints into suppression list.
+func Suppress(list Suppression, events []*Event) error {
+	for _, e := range events {
+		switch {
+		case e.Type == EventComplaint:
+		case e.Type == EventBounce && e.Permanent:
+		default:
+			continue
+		}
+
+		reason := string(e.Type)
+		if e.Status != "" {
+			reason += " " + e.Status
+		}
+		if err := list.Add(e.Recipient, reason, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// suppressionKey normalizes an address.
+func suppressionKey(addr string) string {
+	if a, err := mail.ParseAddress(addr); err == nil {
+		addr = a.Address
+	}
+	return strings.ToLower(strings.TrimSpace(addr))
+}
+
+func (s *redisSuppression) Add(addr, reason string, ttl time.Duration) error {
+	key := suppressionPrefix + suppressionKey(addr)
+
+	cmd := radix.Cmd(nil, "SET", key, reason)
+	if ttl > 0 {
+		cmd = radix.FlatCmd(nil, "SET", key, reason, "EX", int(ttl.Seconds()))
+	}
+	if err := s.pool.Do(cmd); err != nil {
+		return xerrors.Errorf("failed to add suppression <%s>: %w", addr, err)
+	}
+	return nil
+}
+
+func (s *redisSuppression) Has(addr string) (bool, error) {
+	var n int
+	if err := s.pool.Do(radix.Cmd(&n, "EXISTS", suppressionPrefix+suppressionKey(addr))); err != nil {
+		return false, xerrors.Errorf("failed to check suppression <%s>: %w", addr, err)
+	}
+	return n > 0, nil
+}
+
+func (s *redisSuppression) Remove(addr string) error {
+	if err := s.pool.Do(radix.Cmd(nil, "DEL", suppressionPrefix+suppressionKey(addr))); err != nil {
+		return xerrors.Errorf("failed to remove suppression <%s>: %w", addr, err)
+	}
+	return nil
+}
+
+func (s *memorySuppression) Add(addr, _ string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	s.addrs[suppressionKey(addr)] = expires
+	return nil
+}
+
+func (s *memorySuppression) Has(addr string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expires, ok := s.addrs[suppressionKey(addr)]
+	if !ok {
+		return false, nil
+	}
+	return expires.IsZero() || time.Now().Before(expires), nil
+}
+
+func (s *memorySuppression) Remove(addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.addrs, suppressionKey(addr))
+	return nil
+}
+
+func (m *suppressMail) Send(data *Data) error {
+	_, err := m.Deliver(data)
+	return err
+}
+
+func (m *suppressMail) Deliver(data *Data) (*Receipt, error) {
+	data, id := prepare(data)
+
+	var suppressed []Rejection
+	filter := func(addrs []string) ([]string, error) {
+		var list []string
+		for _, addr := range addrs {
+			ok, err := m.list.Has(addr)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				suppressed = append(suppressed, Rejection{Address: addr, Message: "suppressed"})
+				continue
+			}
+			list = append(list, addr)
+		}
+		return list, nil
+	}
+
+	var err error
+	if data.To, err = filter(data.To); err != nil {
+		return nil, err
+	}
+	if data.Cc, err = filter(data.Cc); err != nil {
+		return nil, err
+	}
+	if data.Bcc, err = filter(data.Bcc); err != nil {
+		return nil, err
+	}
+
+	if len(suppressed) == 0 {
+		return Deliver(m.mail, data)
+	}
+
+	msg := "[INFO] mail suppression dropped %d recipients from a mail <%s>"
+	logger.Printf(msg, len(suppressed), id)
+
+	if len(data.To)+len(data.Cc)+len(data.Bcc) == 0 {
+		receipt := &Receipt{MessageID: id, Rejected: suppressed}
+		return receipt, xerrors.Errorf("suppressed all of recipients: %w", ErrRejected)
+	}
+	receipt, err := Deliver(m.mail, data)
+	if receipt == nil {
+		return nil, err
+	}
+	receipt.Rejected = append(receipt.Rejected, suppressed...)
+
+	return receipt, err
+}
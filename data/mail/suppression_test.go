@@ -0,0 +1,124 @@
+package mail
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestMemorySuppression(t *testing.T) {
+	t.Helper()
+
+	list := NewMemorySuppression()
+	if err := list.Add("Taro <TARO@example.com>", "bounce", 0); err != nil {
+		t.Fatalf("suppression add failed: %s", err)
+	}
+	if ok, _ := list.Has("taro@example.com"); !ok {
+		t.Error("suppression must have an address")
+	}
+
+	_ = list.Add("soft@example.com", "bounce", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if ok, _ := list.Has("soft@example.com"); ok {
+		t.Error("suppression must be expired")
+	}
+
+	_ = list.Remove("taro@example.com")
+	if ok, _ := list.Has("taro@example.com"); ok {
+		t.Error("suppression must be removed")
+	}
+}
+
+func TestSuppress(t *testing.T) {
+	t.Helper()
+
+	list := NewMemorySuppression()
+	err := Suppress(list, []*Event{
+		{Type: EventBounce, Permanent: true, Recipient: "hard@example.com"},
+		{Type: EventBounce, Recipient: "soft@example.com"},
+		{Type: EventComplaint, Recipient: "angry@example.com"},
+		{Type: EventDelivery, Recipient: "taro@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("suppress failed: %s", err)
+	}
+
+	for addr, want := range map[string]bool{
+		"hard@example.com": true, "soft@example.com": false,
+		"angry@example.com": true, "taro@example.com": false,
+	} {
+		if ok, _ := list.Has(addr); ok != want {
+			t.Errorf("suppress <%s> must be %v", addr, want)
+		}
+	}
+}
+
+func TestSuppressedMail(t *testing.T) {
+	t.Helper()
+
+	list := NewMemorySuppression()
+	_ = list.Add("hard@example.com", "bounce", 0)
+
+	rec := &recordMail{}
+	m := NewSuppressed(rec, list)
+
+	receipt, err := Deliver(m, &Data{
+		To:   []string{"hard@example.com", "taro@example.com"},
+		From: "noreply@example.com",
+	})
+	if err != nil {
+		t.Fatalf("suppressed deliver must succeed for the rest: %v", err)
+	}
+	if len(receipt.Rejected) != 1 || receipt.Rejected[0].Address != "hard@example.com" {
+		t.Errorf("suppressed rejected error: %#+v", receipt.Rejected)
+	}
+	if len(rec.sent) != 1 || len(rec.sent[0].To) != 1 || rec.sent[0].To[0] != "taro@example.com" {
+		t.Errorf("suppressed sent error: %#+v", rec.sent)
+	}
+
+	if err := m.Send(&Data{To: []string{"hard@example.com", "taro@example.com"}, From: "noreply@example.com"}); err != nil {
+		t.Errorf("suppressed send must succeed for the rest: %v", err)
+	}
+	if err := m.Send(&Data{To: []string{"hard@example.com"}, From: "noreply@example.com"}); !xerrors.Is(err, ErrRejected) {
+		t.Errorf("suppressed send must be rejected: %v", err)
+	}
+	if len(rec.sent) != 2 {
+		t.Errorf("suppressed send must not send: %#+v", rec.sent)
+	}
+}
+
+func TestSuppressedMailBcc(t *testing.T) {
+	t.Helper()
+
+	list := NewMemorySuppression()
+	_ = list.Add("hard@example.com", "bounce", 0)
+
+	rec := &recordMail{}
+	m := NewSuppressed(rec, list)
+
+	if err := m.Send(&Data{
+		To:   []string{"hard@example.com"},
+		Bcc:  []string{"audit@example.com", "staff@example.com"},
+		From: "noreply@example.com",
+	}); err != nil {
+		t.Fatalf("suppressed send failed: %s", err)
+	}
+	if len(rec.sent) != 1 || len(rec.sent[0].To) != 0 || len(rec.sent[0].Bcc) != 2 {
+		t.Fatalf("bcc must be kept as it is: %#+v", rec.sent)
+	}
+
+	msg, err := render(rec.sent[0])
+	if err != nil {
+		t.Fatalf("render failed: %s", err)
+	}
+	header := string(msg.Raw[:bytes.Index(msg.Raw, []byte("\r\n\r\n"))])
+	if strings.Contains(header, "audit@example.com") || strings.Contains(header, "staff@example.com") {
+		t.Errorf("bcc must not be exposed in headers: %s", header)
+	}
+	if len(msg.To) != 2 {
+		t.Errorf("bcc must be envelope recipients: %#+v", msg.To)
+	}
+}
@@ -0,0 +1,347 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util"
+	"github.com/eiicon-company/go-core/util/graceful"
+	"github.com/eiicon-company/go-core/util/logger"
+)
+
+type (
+	// BulkFailureFunc is called with a request which finally failed after retries,
+	// item is nil when a whole bulk request failed.
+	BulkFailureFunc func(req elastic.BulkableRequest, item *elastic.BulkResponseItem, err error)
+
+	// BulkOptions configures a BulkIndexer.
+	BulkOptions struct {
+		// Name is shown in logs.
+		Name string
+		// Workers is a number of concurrent bulk requests, default 2.
+		Workers int
+		// Actions flushes when this many requests are queued, default 1000.
+		Actions int
+		// Size flushes when queued requests exceed this many bytes, default 5MB.
+		Size int
+		// Interval flushes queued requests periodically, default 1s.
+		Interval time.Duration
+		// MaxBackoff is a max wait of retries on 429 or 503, default 30s.
+		MaxBackoff time.Duration
+		// OnFailure is called for each failed request, failures are logged when it's nil.
+		OnFailure BulkFailureFunc
+	}
+
+	// BulkIndexer queues documents and flushes them in background by size, count and interval.
+	BulkIndexer struct {
+		proc    *elastic.BulkProcessor
+		cmd     Command
+		client  *elastic.Client
+		ctx     context.Context
+		backoff elastic.Backoff
+		opts    BulkOptions
+		failed  int64
+		flushed int64
+	}
+
+	// bulkRequest has an operation and an id of a request which are used to match response items.
+	bulkRequest struct {
+		elastic.BulkableRequest
+		op, id string
+	}
+)
+
+// bulkRetryStatus is item statuses which are retried with a backoff
+var bulkRetryStatus = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusServiceUnavailable: true,
+}
+
+// NewBulkIndexer starts a bulk processor on client, Close must be called to flush pending requests.
+// Retries of items are sent through cmd, and they're given up when ctx is done.
+func NewBulkIndexer(ctx context.Context, cmd Command, client *elastic.Client, opts BulkOptions) (*BulkIndexer, error) {
+	if opts.Name == "" {
+		opts.Name = "bulk-indexer"
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 2
+	}
+	if opts.Actions <= 0 {
+		opts.Actions = 1000
+	}
+	if opts.Size <= 0 {
+		opts.Size = 5 << 20
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+
+	b := &BulkIndexer{
+		cmd:     cmd,
+		client:  client,
+		ctx:     ctx,
+		backoff: elastic.NewExponentialBackoff(100*time.Millisecond, opts.MaxBackoff),
+		opts:    opts,
+	}
+
+	// items of 429 or 503 are retried by after, the processor retries only failed requests
+	// because it reports just the last attempt of retried items.
+	proc, err := client.BulkProcessor().
+		Name(opts.Name).
+		Workers(opts.Workers).
+		BulkActions(opts.Actions).
+		BulkSize(opts.Size).
+		FlushInterval(opts.Interval).
+		Backoff(b.backoff).
+		RetryItemStatusCodes().
+		After(b.after).
+		Stats(true).
+		Do(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to start bulk indexer <%s>: %w", opts.Name, err)
+	}
+
+	b.proc = proc
+	return b, nil
+}
+
+// Add queues a request. e.g. elastic.NewBulkIndexRequest().Index(name).Id(id).Doc(doc)
+func (b *BulkIndexer) Add(req elastic.BulkableRequest) {
+	b.proc.Add(req)
+}
+
+// Index queues a document which is created or replaced.
+func (b *BulkIndexer) Index(index, id string, doc interface{}) {
+	req := elastic.NewBulkIndexRequest().Index(index).Id(id).Doc(doc)
+	b.proc.Add(&bulkRequest{BulkableRequest: req, op: "index", id: id})
+}
+
+// Update queues partial fields which are merged into a document, it's created when missing.
+func (b *BulkIndexer) Update(index, id string, partial interface{}) {
+	req := elastic.NewBulkUpdateRequest().Index(index).Id(id).Doc(partial).DocAsUpsert(true)
+	b.proc.Add(&bulkRequest{BulkableRequest: req, op: "update", id: id})
+}
+
+// Delete queues a document which is deleted.
+func (b *BulkIndexer) Delete(index, id string) {
+	req := elastic.NewBulkDeleteRequest().Index(index).Id(id)
+	b.proc.Add(&bulkRequest{BulkableRequest: req, op: "delete", id: id})
+}
+
+// Flush sends queued requests and waits for them.
+func (b *BulkIndexer) Flush() error {
+	return b.proc.Flush()
+}
+
+// Failed returns a number of requests which finally failed.
+func (b *BulkIndexer) Failed() int64 {
+	return atomic.LoadInt64(&b.failed)
+}
+
+// Flushed returns a number of requests which were sent successfully.
+func (b *BulkIndexer) Flushed() int64 {
+	return atomic.LoadInt64(&b.flushed)
+}
+
+// Stats returns statistics of the bulk processor.
+func (b *BulkIndexer) Stats() elastic.BulkProcessorStats {
+	return b.proc.Stats()
+}
+
+// Close flushes pending requests and stops workers.
+func (b *BulkIndexer) Close() error {
+	if err := b.proc.Close(); err != nil {
+		return xerrors.Errorf("failed to close bulk indexer <%s>: %w", b.opts.Name, err)
+	}
+
+	msg := "[INFO] bulk indexer <%s> closed, flushed %d failed %d"
+	logger.Printf(msg, b.opts.Name, b.Flushed(), b.Failed())
+	return nil
+}
+
+func (b *BulkIndexer) after(_ int64, reqs []elastic.BulkableRequest, res *elastic.BulkResponse, err error) {
+	if err != nil {
+		atomic.AddInt64(&b.failed, int64(len(reqs)))
+		for _, req := range reqs {
+			b.fail(req, nil, err)
+		}
+		return
+	}
+	if res == nil {
+		return
+	}
+
+	items := b.retry(reqs, matchBulkItems(reqs, res.Items))
+
+	var failed int64
+	for i, req := range reqs {
+		item := items[i]
+		switch {
+		case item == nil:
+			failed++
+			b.fail(req, nil, xerrors.New("bulk item has no response"))
+		case item.Status >= 200 && item.Status <= 299:
+		case item.Status == http.StatusNotFound && isBulkDelete(req):
+			// a missing document on deleting is fine
+		default:
+			failed++
+			reason := ""
+			if item.Error != nil {
+				reason = item.Error.Type + ": " + item.Error.Reason
+			}
+			b.fail(req, item, xerrors.Errorf("bulk item <%s/%s> failed %d: %s", item.Index, item.Id, item.Status, reason))
+		}
+	}
+
+	atomic.AddInt64(&b.failed, failed)
+	atomic.AddInt64(&b.flushed, int64(len(reqs))-failed)
+}
+
+// retry sends requests which items are 429 or 503 again until the backoff gives up or
+// the context is done, it returns the last items in order of reqs.
+func (b *BulkIndexer) retry(reqs []elastic.BulkableRequest, items []*elastic.BulkResponseItem) []*elastic.BulkResponseItem {
+	for n := 0; ; n++ {
+		var again []int
+		for i, item := range items {
+			if item != nil && bulkRetryStatus[item.Status] {
+				again = append(again, i)
+			}
+		}
+		if len(again) == 0 {
+			return items
+		}
+
+		wait, ok := b.backoff.Next(n)
+		if !ok {
+			return items
+		}
+		select {
+		case <-time.After(wait):
+		case <-b.ctx.Done():
+			return items
+		}
+
+		sub := make([]elastic.BulkableRequest, len(again))
+		for j, i := range again {
+			sub[j] = reqs[i]
+		}
+		res, err := b.cmd.Bulk(b.ctx, b.client.Bulk().Add(sub...))
+		if err != nil {
+			logger.Printf("[WARN] bulk indexer <%s> failed to retry %d items: %s", b.opts.Name, len(sub), err)
+			return items
+		}
+		br, ok := res.Res.(*elastic.BulkResponse)
+		if !ok {
+			return items
+		}
+		for j, item := range matchBulkItems(sub, br.Items) {
+			if item != nil {
+				items[again[j]] = item
+			}
+		}
+	}
+}
+
+// matchBulkItems returns response items in order of reqs, they're matched by an operation and
+// an id because _index of an item is a concrete index of an alias. Requests without an id
+// take items of generated ids in order.
+func matchBulkItems(reqs []elastic.BulkableRequest, items []map[string]*elastic.BulkResponseItem) []*elastic.BulkResponseItem {
+	type key struct{ op, id string }
+
+	pending := map[key][]int{}
+	for i, req := range reqs {
+		op, id := bulkAction(req)
+		pending[key{op, id}] = append(pending[key{op, id}], i)
+	}
+
+	matched := make([]*elastic.BulkResponseItem, len(reqs))
+	for _, m := range items {
+		for op, item := range m {
+			k := key{op, item.Id}
+			if len(pending[k]) == 0 {
+				k.id = ""
+			}
+			if idx := pending[k]; len(idx) > 0 {
+				matched[idx[0]] = item
+				pending[k] = idx[1:]
+			}
+		}
+	}
+	return matched
+}
+
+// bulkAction returns an operation and an id of a request. e.g. index, 1
+//
+// Requests which were given by Add don't have them, so they're read from the action line
+// which elastic has cached on sending, a document isn't serialized again.
+func bulkAction(req elastic.BulkableRequest) (string, string) {
+	if r, ok := req.(*bulkRequest); ok {
+		return r.op, r.id
+	}
+
+	lines, err := req.Source()
+	if err != nil || len(lines) == 0 {
+		return "", ""
+	}
+
+	var action map[string]struct {
+		ID string `json:"_id"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &action); err != nil {
+		return "", ""
+	}
+	for op, meta := range action {
+		return op, meta.ID
+	}
+	return "", ""
+}
+
+func isBulkDelete(req elastic.BulkableRequest) bool {
+	if r, ok := req.(*bulkRequest); ok {
+		return r.op == "delete"
+	}
+	_, ok := req.(*elastic.BulkDeleteRequest)
+	return ok
+}
+
+func (b *BulkIndexer) fail(req elastic.BulkableRequest, item *elastic.BulkResponseItem, err error) {
+	if r, ok := req.(*bulkRequest); ok {
+		req = r.BulkableRequest
+	}
+	if b.opts.OnFailure != nil {
+		b.opts.OnFailure(req, item, err)
+		return
+	}
+
+	logger.Printf("[WARN] bulk indexer <%s>: %s", b.opts.Name, err)
+}
+
+// newBulkIndexer injects BulkIndexer which connects by util.ESBulkConn and is flushed on graceful shutdown.
+func newBulkIndexer(env util.Environment, cmd Command) (*BulkIndexer, error) {
+	client, err := util.ESBulkConn(env)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := NewBulkIndexer(context.Background(), cmd, client, BulkOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	graceful.PostHook(func() {
+		if err := b.Close(); err != nil {
+			logger.Printf("[WARN] %s", err)
+		}
+	})
+
+	return b, nil
+}
@@ -0,0 +1,214 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// fakeBulk responds 400 to documents which id starts with "bad", 429 to the first
+// attempt of documents which id starts with "busy" and 429 always to "full".
+func fakeBulk(t *testing.T) (*elastic.Client, func() int) {
+	t.Helper()
+
+	var (
+		mu   sync.Mutex
+		docs int
+		busy = map[string]bool{}
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/_bulk") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var items []string
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			var action map[string]map[string]string
+			if err := json.Unmarshal(sc.Bytes(), &action); err != nil {
+				continue
+			}
+			meta, ok := action["index"]
+			if !ok {
+				continue
+			}
+			sc.Scan() // source
+
+			mu.Lock()
+			status, errorBody := 201, ""
+			switch id := meta["_id"]; {
+			case strings.HasPrefix(id, "bad"):
+				status, errorBody = 400, `,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}`
+			case strings.HasPrefix(id, "busy") && !busy[id]:
+				busy[id] = true
+				status, errorBody = 429, `,"error":{"type":"es_rejected_execution_exception","reason":"rejected"}`
+			case strings.HasPrefix(id, "full"):
+				status, errorBody = 429, `,"error":{"type":"es_rejected_execution_exception","reason":"rejected"}`
+			}
+			docs++
+			mu.Unlock()
+
+			items = append(items, fmt.Sprintf(`{"index":{"_index":%q,"_id":%q,"status":%d%s}}`, meta["_index"], meta["_id"], status, errorBody))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"took":1,"errors":true,"items":[%s]}`, strings.Join(items, ","))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := elastic.NewClient(elastic.SetURL(srv.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return docs
+	}
+}
+
+func TestBulkIndexer(t *testing.T) {
+	t.Helper()
+
+	client, docs := fakeBulk(t)
+
+	var (
+		mu       sync.Mutex
+		failures []string
+	)
+	b, err := NewBulkIndexer(context.Background(), newCommand(testEnv{}, nil), client, BulkOptions{
+		Actions: 2,
+		OnFailure: func(_ elastic.BulkableRequest, item *elastic.BulkResponseItem, _ error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failures = append(failures, item.Id)
+		},
+	})
+	if err != nil {
+		t.Fatalf("bulk indexer failed: %s", err)
+	}
+
+	b.Index("companies", "1", map[string]string{"name": "a"})
+	b.Index("companies", "bad-2", map[string]string{"name": "b"})
+	b.Index("companies", "3", map[string]string{"name": "c"})
+
+	if err := b.Close(); err != nil {
+		t.Fatalf("bulk indexer close failed: %s", err)
+	}
+
+	if docs() != 3 {
+		t.Errorf("bulk indexer must flush pending documents on close: %d", docs())
+	}
+	if b.Flushed() != 2 || b.Failed() != 1 {
+		t.Errorf("bulk indexer stats error: flushed %d failed %d", b.Flushed(), b.Failed())
+	}
+	if len(failures) != 1 || failures[0] != "bad-2" {
+		t.Errorf("bulk indexer failure callback error: %#+v", failures)
+	}
+}
+
+func TestBulkIndexerRetryItems(t *testing.T) {
+	t.Helper()
+
+	client, docs := fakeBulk(t)
+
+	var (
+		mu       sync.Mutex
+		failures []string
+	)
+	tracer := NewTracer(0)
+	b, err := NewBulkIndexer(context.Background(), newCommand(testEnv{}, tracer), client, BulkOptions{
+		Actions: 4,
+		OnFailure: func(req elastic.BulkableRequest, _ *elastic.BulkResponseItem, _ error) {
+			mu.Lock()
+			defer mu.Unlock()
+			_, id := bulkAction(req)
+			failures = append(failures, id)
+		},
+	})
+	if err != nil {
+		t.Fatalf("bulk indexer failed: %s", err)
+	}
+
+	b.Index("companies", "1", map[string]string{"name": "a"})
+	b.Index("companies", "busy-2", map[string]string{"name": "b"})
+	b.Index("companies", "bad-3", map[string]string{"name": "c"})
+	b.Index("companies", "4", map[string]string{"name": "d"})
+
+	if err := b.Close(); err != nil {
+		t.Fatalf("bulk indexer close failed: %s", err)
+	}
+
+	if docs() != 5 {
+		t.Errorf("only the busy item must be retried: %d", docs())
+	}
+	if b.Flushed() != 3 || b.Failed() != 1 {
+		t.Errorf("bulk indexer stats error: flushed %d failed %d", b.Flushed(), b.Failed())
+	}
+	if len(failures) != 1 || failures[0] != "bad-3" {
+		t.Errorf("failure must receive its request: %#+v", failures)
+	}
+	if tm := tracer.Timings()["_all"]; tm.Count != 1 {
+		t.Errorf("retry must be sent through command: %#+v", tracer.Timings())
+	}
+}
+
+func TestBulkIndexerRetryCanceled(t *testing.T) {
+	t.Helper()
+
+	client, _ := fakeBulk(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b, err := NewBulkIndexer(ctx, newCommand(testEnv{}, nil), client, BulkOptions{MaxBackoff: time.Minute})
+	if err != nil {
+		t.Fatalf("bulk indexer failed: %s", err)
+	}
+
+	b.Index("companies", "full-1", map[string]string{"name": "a"})
+	time.AfterFunc(300*time.Millisecond, cancel)
+
+	start := time.Now()
+	_ = b.Flush()
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("retry must give up when the context is done: %s", took)
+	}
+	if b.Failed() != 1 {
+		t.Errorf("given up item must fail: %d", b.Failed())
+	}
+	_ = b.Close()
+}
+
+func TestMatchBulkItems(t *testing.T) {
+	t.Helper()
+
+	reqs := []elastic.BulkableRequest{
+		elastic.NewBulkIndexRequest().Index("companies").Id("1").Doc(map[string]string{}),
+		elastic.NewBulkDeleteRequest().Index("companies").Id("1"),
+		elastic.NewBulkIndexRequest().Index("companies").Doc(map[string]string{}),
+		// a document which can't be serialized proves it's matched by metadata
+		&bulkRequest{BulkableRequest: elastic.NewBulkIndexRequest().Index("companies").Id("2").Doc(make(chan int)), op: "index", id: "2"},
+	}
+	items := []map[string]*elastic.BulkResponseItem{
+		{"delete": {Index: "companies_1", Id: "1", Status: 200}},
+		{"index": {Index: "companies_1", Id: "2", Status: 201}},
+		{"index": {Index: "companies_1", Id: "generated", Status: 201}},
+		{"index": {Index: "companies_1", Id: "1", Status: 200}},
+	}
+
+	got := matchBulkItems(reqs, items)
+	if got[0] != items[3]["index"] || got[1] != items[0]["delete"] || got[2] != items[2]["index"] || got[3] != items[1]["index"] {
+		t.Errorf("match bulk items error: %#+v", got)
+	}
+}
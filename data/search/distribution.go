@@ -0,0 +1,56 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+)
+
+// Products of a cluster
+const (
+	// ProductElasticsearch is Elasticsearch.
+	ProductElasticsearch = "elasticsearch"
+	// ProductOpenSearch is OpenSearch which is forked from Elasticsearch 7.10.
+	ProductOpenSearch = "opensearch"
+)
+
+type (
+	// Distribution is a product and version of a cluster.
+	Distribution struct {
+		Product string
+		Version string
+	}
+)
+
+// IsOpenSearch returns true when a cluster is OpenSearch.
+func (d *Distribution) IsOpenSearch() bool {
+	return d.Product == ProductOpenSearch
+}
+
+// GetDistribution tells Elasticsearch and OpenSearch apart by version.distribution of the root endpoint,
+// which elastic.PingService drops.
+func GetDistribution(ctx context.Context, client *elastic.Client) (*Distribution, error) {
+	res, err := client.PerformRequest(ctx, elastic.PerformRequestOptions{Method: http.MethodGet, Path: "/"})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get distribution: %w", err)
+	}
+
+	var root struct {
+		Version struct {
+			Number       string `json:"number"`
+			Distribution string `json:"distribution"`
+		} `json:"version"`
+	}
+	if err := json.Unmarshal(res.Body, &root); err != nil {
+		return nil, xerrors.Errorf("invalid distribution: %w", err)
+	}
+
+	d := &Distribution{Product: ProductElasticsearch, Version: root.Version.Number}
+	if root.Version.Distribution == ProductOpenSearch {
+		d.Product = ProductOpenSearch
+	}
+	return d, nil
+}
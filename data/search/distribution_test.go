@@ -0,0 +1,39 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func TestGetDistribution(t *testing.T) {
+	t.Helper()
+
+	for body, want := range map[string]string{
+		`{"version":{"number":"7.17.9","build_flavor":"default"}}`:    ProductElasticsearch,
+		`{"version":{"number":"2.11.0","distribution":"opensearch"}}`: ProductOpenSearch,
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, body)
+		}))
+
+		client, err := elastic.NewClient(elastic.SetURL(srv.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := GetDistribution(context.Background(), client)
+		if err != nil {
+			t.Fatalf("distribution failed: %s", err)
+		}
+		if d.Product != want || d.IsOpenSearch() != (want == ProductOpenSearch) {
+			t.Errorf("distribution error: %#+v", d)
+		}
+		srv.Close()
+	}
+}
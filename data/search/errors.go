@@ -0,0 +1,124 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+)
+
+// Error is a failed request of Command, it has details of an elasticsearch error
+// and wraps the original error which is *elastic.Error or a transport error.
+//
+//	var e *search.Error
+//	if xerrors.As(err, &e) && e.Type == "version_conflict_engine_exception" { ... }
+type Error struct {
+	// Op is an operation name of Command. e.g. search
+	Op string
+	// Index is a target index or alias, it's blank when a request targets a cluster.
+	Index string
+	// Status is a http status code, zero when a request didn't get a response.
+	Status int
+	// Type is an elasticsearch error type. e.g. index_not_found_exception
+	Type string
+	// Reason is a message of the error type.
+	Reason string
+	// RootCause is root causes in "type: reason" form.
+	RootCause []string
+
+	err error
+}
+
+// newError wraps an error of op into Error, nil is returned as it is.
+func newError(op, index string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if xerrors.As(err, &e) {
+		return err
+	}
+
+	e = &Error{Op: op, Index: index, err: err}
+
+	var ee *elastic.Error
+	if !xerrors.As(err, &ee) {
+		return e
+	}
+
+	e.Status = ee.Status
+	if ee.Details == nil {
+		return e
+	}
+
+	e.Type, e.Reason = ee.Details.Type, ee.Details.Reason
+	if e.Index == "" {
+		e.Index = ee.Details.Index
+	}
+	for _, c := range ee.Details.RootCause {
+		if c != nil {
+			e.RootCause = append(e.RootCause, c.Type+": "+c.Reason)
+		}
+	}
+	return e
+}
+
+// Error returns a message. e.g. es search <companies>: 404 index_not_found_exception: no such index
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "es %s", e.Op)
+	if e.Index != "" {
+		fmt.Fprintf(&b, " <%s>", e.Index)
+	}
+
+	switch {
+	case e.Type != "":
+		fmt.Fprintf(&b, ": %d %s: %s", e.Status, e.Type, e.Reason)
+		if len(e.RootCause) > 0 && e.RootCause[0] != e.Type+": "+e.Reason {
+			fmt.Fprintf(&b, " (root cause %s)", e.RootCause[0])
+		}
+	case e.Status != 0:
+		fmt.Fprintf(&b, ": %d %s", e.Status, http.StatusText(e.Status))
+	default:
+		fmt.Fprintf(&b, ": %s", e.err)
+	}
+	return b.String()
+}
+
+// Unwrap returns the original error.
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Temporary reports whether the request may succeed by retrying.
+func (e *Error) Temporary() bool {
+	switch {
+	case xerrors.Is(e.err, context.Canceled):
+		return false
+	case e.Status == 0, e.Status == http.StatusTooManyRequests, e.Status >= http.StatusInternalServerError:
+		return true
+	}
+	return false
+}
+
+// IsStatus reports whether err is an elasticsearch error of the http status code.
+func IsStatus(err error, code int) bool {
+	var e *Error
+	if xerrors.As(err, &e) {
+		return e.Status == code
+	}
+	var ee *elastic.Error
+	if xerrors.As(err, &ee) {
+		return ee.Status == code
+	}
+	return false
+}
+
+// IsNotFound reports whether err is 404 such as a missing index or alias.
+func IsNotFound(err error) bool {
+	return IsStatus(err, http.StatusNotFound)
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/data/search/searchtest"
+)
+
+func TestCommandError(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	client := srv.Client()
+	cmd := newCommand(testEnv{}, NewTracer(0))
+	ctx := context.Background()
+
+	res, err := cmd.Search(ctx, client.Search("companies").Query(elastic.NewMatchAllQuery()))
+	if res != nil {
+		t.Errorf("result must be nil on error: %v", res)
+	}
+
+	var e *Error
+	if !xerrors.As(err, &e) {
+		t.Fatalf("error must be *Error: %#+v", err)
+	}
+	if e.Op != "search" || e.Status != http.StatusNotFound || e.Type != "index_not_found_exception" || len(e.RootCause) != 1 {
+		t.Errorf("error detail error: %#+v", e)
+	}
+	if e.Index != "companies" || !strings.Contains(e.Error(), "index_not_found_exception") || e.Temporary() {
+		t.Errorf("error message error: %s", e)
+	}
+	if !IsNotFound(err) || IsStatus(err, http.StatusBadRequest) {
+		t.Errorf("not found error: %s", err)
+	}
+
+	var ee *elastic.Error
+	if !xerrors.As(err, &ee) || ee.Status != http.StatusNotFound {
+		t.Errorf("error must unwrap elastic error: %#+v", ee)
+	}
+}
+
+func TestCommandCanceled(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	cmd := newCommand(testEnv{}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := cmd.CreateIndex(ctx, srv.Client(), "companies_1700000000000000000", "")
+	var e *Error
+	if !xerrors.As(err, &e) || e.Status != 0 || !xerrors.Is(err, context.Canceled) || e.Temporary() {
+		t.Fatalf("canceled error: %#+v", err)
+	}
+	if len(srv.Indices()) != 0 {
+		t.Errorf("canceled request must not reach the server: %v", srv.Indices())
+	}
+}
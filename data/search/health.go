@@ -0,0 +1,111 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+)
+
+// Health statuses of a cluster and indices
+const (
+	HealthGreen  = "green"
+	HealthYellow = "yellow"
+	HealthRed    = "red"
+)
+
+type (
+	// Readiness checks that a cluster is reachable and aliases point at available indices,
+	// it's an http.Handler which responds 503 when the check fails.
+	//
+	//	mux.Handle("/readyz", search.NewReadiness(cmd, client, "companies", "users"))
+	Readiness struct {
+		cmd     Command
+		client  *elastic.Client
+		aliases []string
+
+		// Timeout is a limit of a check, default 3s.
+		Timeout time.Duration
+	}
+
+	// readinessBody is a response of Readiness
+	readinessBody struct {
+		Status string            `json:"status"`
+		Error  string            `json:"error,omitempty"`
+		Checks map[string]string `json:"checks,omitempty"`
+	}
+)
+
+// NewReadiness returns a readiness check of aliases, no aliases checks that the cluster isn't red.
+func NewReadiness(cmd Command, client *elastic.Client, aliases ...string) *Readiness {
+	return &Readiness{cmd: cmd, client: client, aliases: aliases, Timeout: 3 * time.Second}
+}
+
+// Check returns statuses by alias, it fails when an alias is missing or points at a red index.
+func (r *Readiness) Check(ctx context.Context) (map[string]string, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	checks := map[string]string{}
+	if len(r.aliases) == 0 {
+		res, err := r.cmd.Health(ctx, r.client)
+		if err != nil {
+			return checks, xerrors.Errorf("failed to get cluster health: %w", err)
+		}
+
+		checks["_cluster"] = res.Status("")
+		if checks["_cluster"] == HealthRed {
+			return checks, xerrors.New("cluster is red")
+		}
+		return checks, nil
+	}
+
+	for _, alias := range r.aliases {
+		res, err := r.cmd.Aliases(ctx, r.client, alias)
+		if err != nil {
+			return checks, xerrors.Errorf("failed to get alias <%s>: %w", alias, err)
+		}
+		indices := res.Indices(alias)
+		if len(indices) == 0 {
+			return checks, xerrors.Errorf("alias <%s> points at no index", alias)
+		}
+
+		health, err := r.cmd.Health(ctx, r.client, indices...)
+		if err != nil {
+			return checks, xerrors.Errorf("failed to get health of <%s>: %w", alias, err)
+		}
+
+		checks[alias] = HealthGreen
+		for _, ix := range indices {
+			switch status := health.Status(ix); status {
+			case HealthRed, "":
+				checks[alias] = HealthRed
+				return checks, xerrors.Errorf("alias <%s> points at %s index <%s>", alias, HealthRed, ix)
+			case HealthYellow:
+				checks[alias] = status
+			}
+		}
+	}
+	return checks, nil
+}
+
+// ServeHTTP responds 200 when it's ready, otherwise 503 with a reason.
+func (r *Readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	checks, err := r.Check(req.Context())
+
+	status, body := http.StatusOK, readinessBody{Status: "ok", Checks: checks}
+	if err != nil {
+		status, body = http.StatusServiceUnavailable, readinessBody{Status: "unavailable", Error: err.Error(), Checks: checks}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
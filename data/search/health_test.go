@@ -0,0 +1,110 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+
+	"github.com/eiicon-company/go-core/data/search/searchtest"
+)
+
+func TestHealthCommands(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	client := srv.Client()
+	tracer := NewTracer(0)
+	cmd := newCommand(testEnv{}, tracer)
+	ctx := context.Background()
+
+	const ix = "companies_1700000000000000000"
+	if _, err := cmd.CreateIndex(ctx, client, ix, ""); err != nil {
+		t.Fatal(err)
+	}
+	for i, tags := range [][]string{{"hr"}, {"it"}, {"hr", "it"}} {
+		doc, _ := json.Marshal(testCompany{Tags: tags})
+		if _, err := cmd.PostDocument(ctx, client, ix, i+1, string(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	health, err := cmd.Health(ctx, client)
+	if err != nil || health.Status("") != HealthGreen || health.Status(ix) != HealthGreen {
+		t.Errorf("health error: %v %s", health, err)
+	}
+	tracer.Reset()
+	if _, err := cmd.Health(ctx, client, ix); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cmd.Health(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	if timings := tracer.Timings(); timings[ix].Count != 1 || timings["_all"].Count != 1 {
+		t.Errorf("health must be traced by indices: %#+v", timings)
+	}
+
+	stats, err := cmd.Stats(ctx, client, ix)
+	if err != nil || stats.DocCounts()[ix] != 3 {
+		t.Errorf("stats error: %v %s", stats.DocCounts(), err)
+	}
+
+	if n, err := cmd.Count(ctx, client, ix, nil); err != nil || n != 3 {
+		t.Errorf("count error: %d %s", n, err)
+	}
+	if n, err := cmd.Count(ctx, client, ix, elastic.NewTermQuery("tags", "hr")); err != nil || n != 2 {
+		t.Errorf("count by query error: %d %s", n, err)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	client := srv.Client()
+	cmd := newCommand(testEnv{}, nil)
+	ctx := context.Background()
+
+	serve := func(r *Readiness) (int, readinessBody) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var body readinessBody
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, body
+	}
+
+	ready := NewReadiness(cmd, client, "companies")
+	if code, body := serve(ready); code != http.StatusServiceUnavailable || body.Error == "" {
+		t.Errorf("missing alias must be unavailable: %d %+v", code, body)
+	}
+
+	const ix = "companies_1700000000000000000"
+	if _, err := cmd.CreateIndex(ctx, client, ix, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cmd.PutAlias(ctx, client, ix, "companies"); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := serve(ready); code != http.StatusOK || body.Checks["companies"] != HealthGreen {
+		t.Errorf("alias must be ready: %d %+v", code, body)
+	}
+
+	srv.SetHealth(ix, HealthYellow)
+	if code, body := serve(ready); code != http.StatusOK || body.Checks["companies"] != HealthYellow {
+		t.Errorf("yellow must be ready: %d %+v", code, body)
+	}
+
+	srv.SetHealth(ix, HealthRed)
+	if code, body := serve(ready); code != http.StatusServiceUnavailable || body.Checks["companies"] != HealthRed {
+		t.Errorf("red must be unavailable: %d %+v", code, body)
+	}
+	if code, body := serve(NewReadiness(cmd, client)); code != http.StatusServiceUnavailable || body.Checks["_cluster"] != HealthRed {
+		t.Errorf("red cluster must be unavailable: %d %+v", code, body)
+	}
+}
@@ -0,0 +1,202 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+)
+
+var (
+	// ErrNotFound is returned when a document doesn't exist.
+	ErrNotFound = xerrors.New("document not found")
+)
+
+type (
+	// Index is a typed repository of documents T in an index or alias.
+	Index[T any] struct {
+		cmd    Command
+		client *elastic.Client
+		name   string
+	}
+
+	// Hit is a typed document which was found.
+	Hit[T any] struct {
+		ID        string
+		Index     string
+		Score     *float64
+		Source    T
+		Highlight map[string][]string
+		Sort      []interface{}
+	}
+
+	// Hits is a typed search result.
+	Hits[T any] struct {
+		Total        int64
+		MaxScore     *float64
+		Hits         []*Hit[T]
+		Aggregations elastic.Aggregations
+		// Raw is an original response for the rest of fields. e.g. suggest, pit id
+		Raw *elastic.SearchResult
+	}
+)
+
+// NewIndex returns a typed repository, name is an index or alias name.
+func NewIndex[T any](cmd Command, client *elastic.Client, name string) *Index[T] {
+	return &Index[T]{cmd: cmd, client: client, name: name}
+}
+
+// Name returns an index or alias name.
+func (ix *Index[T]) Name() string {
+	return ix.name
+}
+
+// Get returns a document, ErrNotFound is returned when it doesn't exist.
+func (ix *Index[T]) Get(ctx context.Context, id string) (*T, error) {
+	res, err := ix.cmd.Get(ctx, ix.client.Get().Index(ix.name).Id(id))
+	if IsNotFound(err) {
+		return nil, xerrors.Errorf("<%s/%s>: %w", ix.name, id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get <%s/%s>: %w", ix.name, id, err)
+	}
+
+	gr, ok := res.Res.(*elastic.GetResult)
+	if !ok {
+		return nil, xerrors.Errorf("unexpected get result <%s/%s>: %T", ix.name, id, res.Res)
+	}
+	if !gr.Found {
+		return nil, xerrors.Errorf("<%s/%s>: %w", ix.name, id, ErrNotFound)
+	}
+
+	var doc T
+	if err := json.Unmarshal(gr.Source, &doc); err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal <%s/%s>: %w", ix.name, id, err)
+	}
+	return &doc, nil
+}
+
+// MGet returns documents which were found in the order of ids, missing ones are skipped.
+func (ix *Index[T]) MGet(ctx context.Context, ids ...string) ([]*Hit[T], error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	svc := ix.client.Mget()
+	for _, id := range ids {
+		svc = svc.Add(elastic.NewMultiGetItem().Index(ix.name).Id(id))
+	}
+
+	res, err := ix.cmd.MultiGet(ctx, svc)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to mget <%s>: %w", ix.name, err)
+	}
+
+	mr, ok := res.Res.(*elastic.MgetResponse)
+	if !ok {
+		return nil, xerrors.Errorf("unexpected mget result <%s>: %T", ix.name, res.Res)
+	}
+
+	hits := make([]*Hit[T], 0, len(mr.Docs))
+	for _, d := range mr.Docs {
+		if !d.Found {
+			continue
+		}
+
+		hit := &Hit[T]{ID: d.Id, Index: d.Index}
+		if err := json.Unmarshal(d.Source, &hit.Source); err != nil {
+			return nil, xerrors.Errorf("failed to unmarshal <%s/%s>: %w", d.Index, d.Id, err)
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// Index creates or replaces a document.
+func (ix *Index[T]) Index(ctx context.Context, id string, doc T) error {
+	if _, err := ix.cmd.Index(ctx, ix.client.Index().Index(ix.name).Id(id).BodyJson(doc)); err != nil {
+		return xerrors.Errorf("failed to index <%s/%s>: %w", ix.name, id, err)
+	}
+	return nil
+}
+
+// Update merges partial fields into a document, partial is a struct or map which has
+// only changed fields, ErrNotFound is returned when it doesn't exist.
+func (ix *Index[T]) Update(ctx context.Context, id string, partial interface{}) error {
+	_, err := ix.cmd.Update(ctx, ix.client.Update().Index(ix.name).Id(id).Doc(partial))
+	if IsNotFound(err) {
+		return xerrors.Errorf("<%s/%s>: %w", ix.name, id, ErrNotFound)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to update <%s/%s>: %w", ix.name, id, err)
+	}
+	return nil
+}
+
+// Delete removes a document, ErrNotFound is returned when it doesn't exist.
+func (ix *Index[T]) Delete(ctx context.Context, id string) error {
+	_, err := ix.cmd.Delete(ctx, ix.client.Delete().Index(ix.name).Id(id))
+	if IsNotFound(err) {
+		return xerrors.Errorf("<%s/%s>: %w", ix.name, id, ErrNotFound)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to delete <%s/%s>: %w", ix.name, id, err)
+	}
+	return nil
+}
+
+// Search runs a search which is built by fn on the index and returns typed hits.
+//
+//	hits, err := ix.Search(ctx, func(s *elastic.SearchService) *elastic.SearchService {
+//		return s.Query(elastic.NewMatchQuery("name", "eiicon")).Highlight(elastic.NewHighlight().Field("name"))
+//	})
+func (ix *Index[T]) Search(ctx context.Context, fn func(*elastic.SearchService) *elastic.SearchService) (*Hits[T], error) {
+	svc := ix.client.Search(ix.name)
+	if fn != nil {
+		svc = fn(svc)
+	}
+
+	res, err := ix.cmd.Search(ctx, svc)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to search <%s>: %w", ix.name, err)
+	}
+
+	sr, ok := res.Res.(*elastic.SearchResult)
+	if !ok {
+		return nil, xerrors.Errorf("unexpected search result <%s>: %T", ix.name, res.Res)
+	}
+	return NewHits[T](sr)
+}
+
+// NewHits converts a search result into typed hits.
+func NewHits[T any](sr *elastic.SearchResult) (*Hits[T], error) {
+	hits := &Hits[T]{Aggregations: sr.Aggregations, Raw: sr}
+	if sr.Hits == nil {
+		return hits, nil
+	}
+
+	if sr.Hits.TotalHits != nil {
+		hits.Total = sr.Hits.TotalHits.Value
+	}
+	hits.MaxScore = sr.Hits.MaxScore
+	hits.Hits = make([]*Hit[T], 0, len(sr.Hits.Hits))
+
+	for _, h := range sr.Hits.Hits {
+		hit := &Hit[T]{
+			ID:        h.Id,
+			Index:     h.Index,
+			Score:     h.Score,
+			Highlight: h.Highlight,
+			Sort:      h.Sort,
+		}
+		if len(h.Source) > 0 {
+			if err := json.Unmarshal(h.Source, &hit.Source); err != nil {
+				return nil, xerrors.Errorf("failed to unmarshal <%s/%s>: %w", h.Index, h.Id, err)
+			}
+		}
+		hits.Hits = append(hits.Hits, hit)
+	}
+
+	return hits, nil
+}
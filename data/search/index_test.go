@@ -0,0 +1,122 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/data/search/searchtest"
+)
+
+type testCompany struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+func TestNewHits(t *testing.T) {
+	t.Helper()
+
+	body := `{
+		"hits": {
+			"total": {"value": 2, "relation": "eq"},
+			"max_score": 1.5,
+			"hits": [
+				{"_index": "companies_1", "_id": "c-1", "_score": 1.5, "_source": {"name": "eiicon", "tags": ["hr"]},
+				 "highlight": {"name": ["<em>eiicon</em>"]}, "sort": [1.5, "c-1"]},
+				{"_index": "companies_1", "_id": "c-2", "_score": 0.5, "_source": {"name": "other"}}
+			]
+		}
+	}`
+
+	var sr elastic.SearchResult
+	if err := json.Unmarshal([]byte(body), &sr); err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err := NewHits[testCompany](&sr)
+	if err != nil {
+		t.Fatalf("new hits failed: %s", err)
+	}
+	if hits.Total != 2 || *hits.MaxScore != 1.5 || len(hits.Hits) != 2 {
+		t.Fatalf("hits error: %#+v", hits)
+	}
+
+	hit := hits.Hits[0]
+	if hit.ID != "c-1" || hit.Source.Name != "eiicon" || hit.Source.Tags[0] != "hr" {
+		t.Errorf("hit source error: %#+v", hit)
+	}
+	if hit.Highlight["name"][0] != "<em>eiicon</em>" {
+		t.Errorf("hit highlight error: %#+v", hit.Highlight)
+	}
+	if len(hit.Sort) != 2 || hit.Sort[1] != "c-1" {
+		t.Errorf("hit sort error: %#+v", hit.Sort)
+	}
+}
+
+func TestIndexCRUD(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	tracer := NewTracer(0)
+	ix := NewIndex[testCompany](newCommand(testEnv{}, tracer), srv.Client(), "companies")
+	ctx := context.Background()
+
+	if err := ix.Index(ctx, "c-1", testCompany{Name: "eiicon", Tags: []string{"hr"}}); err != nil {
+		t.Fatalf("index failed: %s", err)
+	}
+	if err := ix.Index(ctx, "c-2", testCompany{Name: "other"}); err != nil {
+		t.Fatalf("index failed: %s", err)
+	}
+
+	doc, err := ix.Get(ctx, "c-1")
+	if err != nil || doc.Name != "eiicon" || doc.Tags[0] != "hr" {
+		t.Fatalf("get error: %#+v %s", doc, err)
+	}
+
+	if _, err := ix.Get(ctx, "c-9"); !xerrors.Is(err, ErrNotFound) {
+		t.Errorf("missing get must be not found: %#+v", err)
+	}
+
+	hits, err := ix.MGet(ctx, "c-2", "c-9", "c-1")
+	if err != nil || len(hits) != 2 || hits[0].ID != "c-2" || hits[1].Source.Name != "eiicon" {
+		t.Errorf("mget error: %#+v %s", hits, err)
+	}
+
+	if err := ix.Update(ctx, "c-1", map[string]interface{}{"name": "eiicon company"}); err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+	if doc, err := ix.Get(ctx, "c-1"); err != nil || doc.Name != "eiicon company" || len(doc.Tags) != 1 {
+		t.Errorf("updated document error: %#+v %s", doc, err)
+	}
+	if err := ix.Update(ctx, "c-9", map[string]interface{}{"name": "missing"}); !xerrors.Is(err, ErrNotFound) {
+		t.Errorf("missing update must be not found: %#+v", err)
+	}
+
+	if err := ix.Delete(ctx, "c-2"); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	if err := ix.Delete(ctx, "c-2"); !xerrors.Is(err, ErrNotFound) {
+		t.Errorf("missing delete must be not found: %#+v", err)
+	}
+	if srv.Source("companies", "c-2") != nil {
+		t.Error("document must be deleted")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	var e *Error
+	if _, err := ix.Get(canceled, "c-1"); xerrors.Is(err, ErrNotFound) || !xerrors.As(err, &e) || e.Op != "get" {
+		t.Errorf("failed get must be *Error: %#+v", err)
+	}
+
+	var count, errs int64
+	for _, tm := range tracer.Timings() {
+		count, errs = count+tm.Count, errs+tm.Errors
+	}
+	if count != 11 || errs != 4 {
+		t.Errorf("crud must be traced: %d requests %d errors", count, errs)
+	}
+}
@@ -0,0 +1,207 @@
+package search
+
+import (
+	"context"
+	"io"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/logger"
+)
+
+type (
+	// IterateOptions configures an Iterator.
+	IterateOptions struct {
+		// Size is a number of hits in a page, default 1000.
+		Size int
+		// KeepAlive keeps a point in time or scroll context between pages, default 1m.
+		KeepAlive string
+		// Sort is a sort order of hits, default _shard_doc which is the fastest for point in time.
+		// Sort must be unique when Scroll is false, add a tiebreaker. e.g. id field
+		Sort []elastic.Sorter
+		// Scroll uses scroll api instead of point in time, set it for OpenSearch which has
+		// another point in time api, otherwise iterator falls back to scroll after a failure.
+		Scroll bool
+	}
+
+	// Iterator yields all of hits which match a query lazily, by point in time with search_after,
+	// or scroll when point in time isn't supported by a cluster.
+	//
+	//	it := search.NewIterator[Company](client, query, search.IterateOptions{}, "companies")
+	//	defer it.Close(ctx)
+	//	for it.Next(ctx) {
+	//		hit := it.Hit()
+	//	}
+	//	if err := it.Err(); err != nil {
+	//		...
+	//	}
+	Iterator[T any] struct {
+		client  *elastic.Client
+		query   elastic.Query
+		indices []string
+		opts    IterateOptions
+
+		pit    string
+		scroll *elastic.ScrollService
+		after  []interface{}
+
+		started bool
+		done    bool
+		buf     []*Hit[T]
+		hit     *Hit[T]
+		err     error
+	}
+)
+
+// NewIterator returns an iterator over indices, query is nil for all of documents.
+func NewIterator[T any](client *elastic.Client, query elastic.Query, opts IterateOptions, indices ...string) *Iterator[T] {
+	if opts.Size <= 0 {
+		opts.Size = 1000
+	}
+	if opts.KeepAlive == "" {
+		opts.KeepAlive = "1m"
+	}
+	if query == nil {
+		query = elastic.NewMatchAllQuery()
+	}
+
+	return &Iterator[T]{client: client, query: query, indices: indices, opts: opts}
+}
+
+// Next advances to the next hit, it returns false when hits are exhausted or an error occurs.
+func (it *Iterator[T]) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	if err := ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+
+	for len(it.buf) == 0 {
+		if it.done {
+			it.hit = nil
+			return false
+		}
+		if err := it.fetch(ctx); err != nil {
+			it.err = err
+			return false
+		}
+	}
+
+	it.hit, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Hit returns a current hit.
+func (it *Iterator[T]) Hit() *Hit[T] {
+	return it.hit
+}
+
+// Err returns an error which stopped iteration.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// Close releases a point in time or scroll context on the cluster.
+func (it *Iterator[T]) Close(ctx context.Context) error {
+	it.done = true
+	it.buf = nil
+
+	switch {
+	case it.pit != "":
+		pit := it.pit
+		it.pit = ""
+		if _, err := it.client.ClosePointInTime(pit).Do(ctx); err != nil {
+			return xerrors.Errorf("failed to close point in time: %w", err)
+		}
+	case it.scroll != nil:
+		scroll := it.scroll
+		it.scroll = nil
+		if err := scroll.Clear(ctx); err != nil {
+			return xerrors.Errorf("failed to clear scroll: %w", err)
+		}
+	}
+	return nil
+}
+
+func (it *Iterator[T]) fetch(ctx context.Context) error {
+	if !it.started {
+		it.started = true
+		if !it.opts.Scroll {
+			res, err := it.client.OpenPointInTime(it.indices...).KeepAlive(it.opts.KeepAlive).Do(ctx)
+			if err == nil {
+				it.pit = res.Id
+			} else {
+				msg := "[WARN] point in time isn't available on <%v>, fallback to scroll: %s"
+				logger.Printf(msg, it.indices, err)
+			}
+		}
+		if it.pit == "" {
+			it.scroll = it.client.Scroll(it.indices...).
+				Query(it.query).Size(it.opts.Size).KeepAlive(it.opts.KeepAlive)
+			if len(it.opts.Sort) > 0 {
+				it.scroll = it.scroll.SortBy(it.opts.Sort...)
+			}
+		}
+	}
+
+	if it.scroll != nil {
+		return it.fetchScroll(ctx)
+	}
+	return it.fetchPIT(ctx)
+}
+
+func (it *Iterator[T]) fetchPIT(ctx context.Context) error {
+	svc := it.client.Search().
+		PointInTime(elastic.NewPointInTimeWithKeepAlive(it.pit, it.opts.KeepAlive)).
+		Query(it.query).Size(it.opts.Size).TrackTotalHits(false)
+	if len(it.opts.Sort) > 0 {
+		svc = svc.SortBy(it.opts.Sort...)
+	} else {
+		svc = svc.Sort("_shard_doc", true)
+	}
+	if it.after != nil {
+		svc = svc.SearchAfter(it.after...)
+	}
+
+	sr, err := svc.Do(ctx)
+	if err != nil {
+		return xerrors.Errorf("failed to search after <%v>: %w", it.indices, err)
+	}
+	if sr.PitId != "" {
+		it.pit = sr.PitId
+	}
+
+	return it.fill(sr)
+}
+
+func (it *Iterator[T]) fetchScroll(ctx context.Context) error {
+	sr, err := it.scroll.Do(ctx)
+	if err == io.EOF {
+		it.done = true
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to scroll <%v>: %w", it.indices, err)
+	}
+
+	return it.fill(sr)
+}
+
+func (it *Iterator[T]) fill(sr *elastic.SearchResult) error {
+	hits, err := NewHits[T](sr)
+	if err != nil {
+		return err
+	}
+
+	it.buf = hits.Hits
+	if len(hits.Hits) < it.opts.Size {
+		it.done = true
+	}
+	if len(hits.Hits) > 0 {
+		it.after = hits.Hits[len(hits.Hits)-1].Sort
+	}
+	return nil
+}
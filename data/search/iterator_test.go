@@ -0,0 +1,133 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func fakeSearchHits(ids ...int) string {
+	hits := make([]string, len(ids))
+	for i, id := range ids {
+		hits[i] = fmt.Sprintf(`{"_index":"companies_1","_id":"%d","_source":{"name":"c%d"},"sort":[%d]}`, id, id, id)
+	}
+	return fmt.Sprintf(`{"_scroll_id":"scroll1","pit_id":"pit2","hits":{"hits":[%s]}}`, strings.Join(hits, ","))
+}
+
+func fakeIterate(t *testing.T, pit bool) (*elastic.Client, *[]string) {
+	t.Helper()
+
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+
+		body, _ := io.ReadAll(r.Body)
+		var req map[string]interface{}
+		_ = json.Unmarshal(body, &req)
+
+		switch {
+		case r.URL.Path == "/companies/_pit" && pit:
+			fmt.Fprint(w, `{"id":"pit1"}`)
+		case r.URL.Path == "/_search":
+			if req["search_after"] == nil {
+				fmt.Fprint(w, fakeSearchHits(1, 2))
+			} else {
+				fmt.Fprint(w, fakeSearchHits(3))
+			}
+		case r.URL.Path == "/_pit" && r.Method == http.MethodDelete:
+			fmt.Fprint(w, `{"succeeded":true,"num_freed":1}`)
+		case r.URL.Path == "/companies/_search":
+			fmt.Fprint(w, fakeSearchHits(1, 2))
+		case r.URL.Path == "/_search/scroll" && r.Method == http.MethodPost:
+			fmt.Fprint(w, fakeSearchHits(3))
+		case r.URL.Path == "/_search/scroll" && r.Method == http.MethodDelete:
+			fmt.Fprint(w, `{"succeeded":true,"num_freed":1}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"type":"not_found","reason":"not found"},"status":404}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := elastic.NewClient(elastic.SetURL(srv.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, &calls
+}
+
+func iterateAll(t *testing.T, it *Iterator[testCompany]) []string {
+	t.Helper()
+
+	ctx := context.Background()
+	defer func() {
+		if err := it.Close(ctx); err != nil {
+			t.Errorf("iterator close failed: %s", err)
+		}
+	}()
+
+	var names []string
+	for it.Next(ctx) {
+		names = append(names, it.Hit().Source.Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("iterator failed: %s", err)
+	}
+	return names
+}
+
+func TestIteratorPointInTime(t *testing.T) {
+	t.Helper()
+
+	client, calls := fakeIterate(t, true)
+	it := NewIterator[testCompany](client, nil, IterateOptions{Size: 2}, "companies")
+
+	if names := iterateAll(t, it); strings.Join(names, ",") != "c1,c2,c3" {
+		t.Errorf("iterator hits error: %#+v", names)
+	}
+	if strings.Join(*calls, ",") != "POST /companies/_pit,POST /_search,POST /_search,DELETE /_pit" {
+		t.Errorf("iterator calls error: %#+v", *calls)
+	}
+	if it.after[0] != float64(3) {
+		t.Errorf("iterator search after error: %#+v", it.after)
+	}
+}
+
+func TestIteratorScrollFallback(t *testing.T) {
+	t.Helper()
+
+	client, calls := fakeIterate(t, false)
+	it := NewIterator[testCompany](client, elastic.NewTermQuery("name", "c"), IterateOptions{Size: 2}, "companies")
+
+	if names := iterateAll(t, it); strings.Join(names, ",") != "c1,c2,c3" {
+		t.Errorf("iterator hits error: %#+v", names)
+	}
+	if !strings.HasSuffix(strings.Join(*calls, ","), "DELETE /_search/scroll") {
+		t.Errorf("iterator must clear scroll: %#+v", *calls)
+	}
+}
+
+func TestIteratorCanceled(t *testing.T) {
+	t.Helper()
+
+	client, _ := fakeIterate(t, true)
+	it := NewIterator[testCompany](client, nil, IterateOptions{Size: 2}, "companies")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if it.Next(ctx) {
+		t.Error("iterator must stop by canceled context")
+	}
+	if it.Err() != context.Canceled {
+		t.Errorf("iterator error must be canceled: %v", it.Err())
+	}
+}
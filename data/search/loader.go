@@ -10,7 +10,9 @@ import (
 func Inject(di *dig.Container) {
 	// Injects
 	var deps = []interface{}{
+		newTracer,
 		newCommand,
+		newBulkIndexer,
 	}
 
 	for _, dep := range deps {
@@ -0,0 +1,486 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/logger"
+)
+
+// MigrationAction is what Migrate does for an alias
+type MigrationAction string
+
+// Migration actions
+const (
+	// MigrationNone means the live index is up to date.
+	MigrationNone MigrationAction = "none"
+	// MigrationCreate creates the first index of the alias.
+	MigrationCreate MigrationAction = "create"
+	// MigrationUpdate applies compatible changes to the live index in place.
+	MigrationUpdate MigrationAction = "update"
+	// MigrationReindex builds a new index because of breaking changes.
+	MigrationReindex MigrationAction = "reindex"
+)
+
+// staticSettings are index settings which can't be changed on an open index, keys which end
+// with a dot are prefixes.
+var staticSettings = []string{
+	"number_of_shards",
+	"number_of_routing_shards",
+	"routing_partition_size",
+	"codec",
+	"soft_deletes.enabled",
+	"load_fixed_bitset_filters_eagerly",
+	"shard.check_on_startup",
+	"store.",
+	"sort.",
+	"analysis.",
+	"similarity.",
+}
+
+// updatableParams are mapping parameters which can be changed on an existing field
+var updatableParams = map[string]bool{
+	"ignore_above":          true,
+	"search_analyzer":       true,
+	"search_quote_analyzer": true,
+	"ignore_malformed":      true,
+	"meta":                  true,
+}
+
+type (
+	// Mapping is settings and mappings of an alias, which is the body of CreateIndex.
+	Mapping struct {
+		Alias    string                 `json:"-"`
+		Settings map[string]interface{} `json:"settings,omitempty"`
+		Mappings map[string]interface{} `json:"mappings,omitempty"`
+	}
+
+	// MigrationPlan is a difference between a registered mapping and the live index.
+	MigrationPlan struct {
+		Alias  string
+		Action MigrationAction
+		// Index is the live index which the alias points to.
+		Index string
+		// Version is _meta.version of the registered and live mappings.
+		Version, LiveVersion string
+		// Added is field paths which are added in place.
+		Added []string
+		// Breaking is field paths and settings which need a reindex.
+		Breaking []string
+		// Removed is field paths which only exist in the live index, they're left as they are.
+		Removed []string
+		// Settings is dynamic settings which are updated in place.
+		Settings map[string]interface{}
+	}
+
+	// MappingRegistry keeps versioned mappings and templates, and migrates live indices to them.
+	MappingRegistry struct {
+		cmd    Command
+		client *elastic.Client
+
+		mappings   map[string]*Mapping
+		components map[string]string
+		templates  map[string]string
+	}
+)
+
+// NewMappingRegistry returns an empty registry.
+func NewMappingRegistry(cmd Command, client *elastic.Client) *MappingRegistry {
+	return &MappingRegistry{
+		cmd:        cmd,
+		client:     client,
+		mappings:   map[string]*Mapping{},
+		components: map[string]string{},
+		templates:  map[string]string{},
+	}
+}
+
+// Register adds a mapping of alias, body is {"settings": {...}, "mappings": {...}}.
+func (r *MappingRegistry) Register(alias string, body []byte) error {
+	m := &Mapping{Alias: alias}
+	if err := json.Unmarshal(body, m); err != nil {
+		return xerrors.Errorf("invalid mapping <%s>: %w", alias, err)
+	}
+	if m.Mappings == nil {
+		m.Mappings = map[string]interface{}{}
+	}
+	r.mappings[alias] = m
+	return nil
+}
+
+// RegisterComponentTemplate adds a component template.
+func (r *MappingRegistry) RegisterComponentTemplate(name, body string) {
+	r.components[name] = body
+}
+
+// RegisterIndexTemplate adds a composable index template.
+func (r *MappingRegistry) RegisterIndexTemplate(name, body string) {
+	r.templates[name] = body
+}
+
+// LoadDir registers json files in a folder, a file name is an alias or template name.
+//
+//	mappings/companies.json
+//	mappings/component_templates/ja_analysis.json
+//	mappings/index_templates/logs.json
+func (r *MappingRegistry) LoadDir(dir string) error {
+	load := func(sub string, fn func(name string, body []byte) error) error {
+		files, err := filepath.Glob(filepath.Join(dir, sub, "*.json"))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			body, err := os.ReadFile(file) //#nosec G304
+			if err != nil {
+				return xerrors.Errorf("failed to read mapping: %w", err)
+			}
+			if err := fn(strings.TrimSuffix(filepath.Base(file), ".json"), body); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := load("", r.Register); err != nil {
+		return err
+	}
+	if err := load("component_templates", func(name string, body []byte) error {
+		r.RegisterComponentTemplate(name, string(body))
+		return nil
+	}); err != nil {
+		return err
+	}
+	return load("index_templates", func(name string, body []byte) error {
+		r.RegisterIndexTemplate(name, string(body))
+		return nil
+	})
+}
+
+// Mapping returns a registered mapping.
+func (r *MappingRegistry) Mapping(alias string) (*Mapping, error) {
+	m, ok := r.mappings[alias]
+	if !ok {
+		return nil, xerrors.Errorf("mapping isn't registered: %s", alias)
+	}
+	return m, nil
+}
+
+// Aliases returns registered aliases in order.
+func (r *MappingRegistry) Aliases() []string {
+	aliases := make([]string, 0, len(r.mappings))
+	for alias := range r.mappings {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// Body returns settings and mappings as a string for CreateIndex and ReindexOptions.
+func (m *Mapping) Body() string {
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// setting returns a value of settings by a key without the "index." prefix.
+func (m *Mapping) setting(key string) (string, bool) {
+	settings := flatten("", m.Settings)
+	for _, k := range []string{key, "index." + key} {
+		if v, ok := settings[k]; ok && v != nil {
+			return fmt.Sprint(v), true
+		}
+	}
+	return "", false
+}
+
+// Version returns mappings._meta.version, which is blank when it isn't set.
+func (m *Mapping) Version() string {
+	return metaVersion(m.Mappings)
+}
+
+// ApplyTemplates puts component templates and then index templates which use them.
+func (r *MappingRegistry) ApplyTemplates(ctx context.Context) error {
+	for _, name := range sortedKeys(r.components) {
+		if _, err := r.cmd.PutComponentTemplate(ctx, r.client, name, r.components[name]); err != nil {
+			return xerrors.Errorf("failed to put component template <%s>: %w", name, err)
+		}
+	}
+	for _, name := range sortedKeys(r.templates) {
+		if _, err := r.cmd.PutIndexTemplate(ctx, r.client, name, r.templates[name]); err != nil {
+			return xerrors.Errorf("failed to put index template <%s>: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Plan compares a registered mapping with the live index of alias.
+func (r *MappingRegistry) Plan(ctx context.Context, alias string) (*MigrationPlan, error) {
+	m, err := r.Mapping(alias)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &MigrationPlan{Alias: alias, Action: MigrationCreate, Version: m.Version(), Settings: map[string]interface{}{}}
+
+	mr, err := r.cmd.GetMapping(ctx, r.client, alias)
+	if IsNotFound(err) {
+		return plan, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get mapping <%s>: %w", alias, err)
+	}
+	res, _ := mr.Res.(map[string]interface{})
+	if len(res) != 1 {
+		return nil, xerrors.Errorf("alias <%s> points to %d indices", alias, len(res))
+	}
+
+	var live map[string]interface{}
+	for index, v := range res {
+		plan.Index = index
+		if v, ok := v.(map[string]interface{}); ok {
+			live, _ = v["mappings"].(map[string]interface{})
+		}
+	}
+	plan.LiveVersion = metaVersion(live)
+
+	diffProperties("", properties(live), properties(m.Mappings), plan)
+
+	sr, err := r.cmd.GetSettings(ctx, r.client, plan.Index)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get settings <%s>: %w", plan.Index, err)
+	}
+	settings, _ := sr.Res.(map[string]*elastic.IndicesGetSettingsResponse)
+	if s, ok := settings[plan.Index]; ok {
+		diffSettings(flatten("", s.Settings), flatten("", m.Settings), plan)
+	}
+
+	switch {
+	case len(plan.Breaking) > 0:
+		plan.Action = MigrationReindex
+	case len(plan.Added) > 0 || len(plan.Settings) > 0 || plan.Version != plan.LiveVersion ||
+		!reflect.DeepEqual(normalize(live["dynamic"]), normalize(m.Mappings["dynamic"])):
+		plan.Action = MigrationUpdate
+	default:
+		plan.Action = MigrationNone
+	}
+
+	return plan, nil
+}
+
+// Migrate brings the live index of alias up to the registered mapping, source loads documents
+// when the alias is created or reindexed, nil source creates an empty index and refuses reindex.
+func (r *MappingRegistry) Migrate(ctx context.Context, alias string, source DocumentSource, opts ReindexOptions) (*MigrationPlan, error) {
+	plan, err := r.Plan(ctx, alias)
+	if err != nil {
+		return nil, err
+	}
+	m, _ := r.Mapping(alias)
+
+	switch plan.Action {
+	case MigrationNone:
+		return plan, nil
+
+	case MigrationUpdate:
+		if _, err := r.cmd.PutMapping(ctx, r.client, plan.Index, m.Mappings); err != nil {
+			return plan, xerrors.Errorf("failed to put mapping <%s>: %w", plan.Index, err)
+		}
+		if len(plan.Settings) > 0 {
+			if _, err := r.cmd.PutSettings(ctx, r.client, plan.Index, plan.Settings); err != nil {
+				return plan, xerrors.Errorf("failed to put settings <%s>: %w", plan.Index, err)
+			}
+		}
+
+	case MigrationCreate, MigrationReindex:
+		if source == nil {
+			if plan.Action == MigrationReindex {
+				return plan, xerrors.Errorf("mapping <%s> has breaking changes %v, reindex needs a document source", alias, plan.Breaking)
+			}
+
+			index := MakeIndexName(alias)
+			if _, err := r.cmd.CreateIndex(ctx, r.client, index, m.Body()); err != nil {
+				return plan, xerrors.Errorf("failed to create index <%s>: %w", index, err)
+			}
+			if _, err := r.cmd.PutAlias(ctx, r.client, index, alias); err != nil {
+				return plan, xerrors.Errorf("failed to put alias <%s>: %w", alias, err)
+			}
+			plan.Index = index
+			break
+		}
+
+		// a reindex restores replicas and refresh of the registered settings
+		opts.Alias, opts.Body = alias, m.Body()
+		if v, ok := m.setting("number_of_replicas"); ok && opts.Replicas == nil {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return plan, xerrors.Errorf("invalid number_of_replicas <%s>: %w", alias, err)
+			}
+			opts.Replicas = Int(n)
+		}
+		if v, ok := m.setting("refresh_interval"); ok && opts.RefreshInterval == "" {
+			opts.RefreshInterval = v
+		}
+
+		res, err := NewReindexer(r.cmd, r.client, opts).Run(ctx, source)
+		if err != nil {
+			return plan, err
+		}
+		plan.Index = res.Index
+	}
+
+	msg := "[INFO] mapping <%s> migrated by %s into <%s> version <%s>"
+	logger.Printf(msg, alias, plan.Action, plan.Index, plan.Version)
+
+	return plan, nil
+}
+
+// diffProperties compares field definitions recursively along with object properties and multi-fields,
+// parameters which were changed are breaking unless they are updatable, removed ones are always breaking.
+func diffProperties(prefix string, live, want map[string]interface{}, plan *MigrationPlan) {
+	for _, name := range sortedKeys(want) {
+		path := prefix + name
+		w, _ := want[name].(map[string]interface{})
+
+		l, ok := live[name].(map[string]interface{})
+		if !ok {
+			plan.Added = append(plan.Added, path)
+			continue
+		}
+
+		for _, k := range sortedKeys(w) {
+			switch k {
+			case "properties", "fields":
+				continue
+			}
+			if updatableParams[k] {
+				if !reflect.DeepEqual(normalize(l[k]), normalize(w[k])) {
+					plan.Added = append(plan.Added, path+"."+k)
+				}
+				continue
+			}
+			if !reflect.DeepEqual(normalize(l[k]), normalize(w[k])) {
+				plan.Breaking = append(plan.Breaking, fmt.Sprintf("%s.%s: %v => %v", path, k, l[k], w[k]))
+			}
+		}
+		// a parameter can't be removed by put mapping, the live index keeps it
+		for _, k := range sortedKeys(l) {
+			switch k {
+			case "properties", "fields", "type":
+				continue
+			}
+			if _, ok := w[k]; !ok {
+				plan.Breaking = append(plan.Breaking, fmt.Sprintf("%s.%s: %v => removed", path, k, l[k]))
+			}
+		}
+		// "type": "object" is omitted by elasticsearch
+		if _, ok := w["type"]; !ok {
+			if t, ok := l["type"]; ok && t != "object" {
+				plan.Breaking = append(plan.Breaking, fmt.Sprintf("%s.type: %v => object", path, t))
+			}
+		}
+
+		diffProperties(path+".", properties(l), properties(w), plan)
+		wf, _ := w["fields"].(map[string]interface{})
+		lf, _ := l["fields"].(map[string]interface{})
+		diffProperties(path+".", lf, wf, plan)
+	}
+
+	for _, name := range sortedKeys(live) {
+		if _, ok := want[name]; !ok {
+			plan.Removed = append(plan.Removed, prefix+name)
+		}
+	}
+}
+
+// diffSettings treats static settings such as shards, codec and analysis as breaking changes.
+func diffSettings(live, want map[string]interface{}, plan *MigrationPlan) {
+	for _, k := range sortedKeys(want) {
+		key := strings.TrimPrefix(k, "index.")
+		lv, ok := live["index."+key]
+		if ok && fmt.Sprint(lv) == fmt.Sprint(want[k]) {
+			continue
+		}
+
+		if isStaticSetting(key) {
+			plan.Breaking = append(plan.Breaking, fmt.Sprintf("settings.%s: %v => %v", key, lv, want[k]))
+			continue
+		}
+		plan.Settings["index."+key] = want[k]
+	}
+}
+
+func isStaticSetting(key string) bool {
+	for _, s := range staticSettings {
+		if key == s || (strings.HasSuffix(s, ".") && strings.HasPrefix(key, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+func properties(m map[string]interface{}) map[string]interface{} {
+	p, _ := m["properties"].(map[string]interface{})
+	return p
+}
+
+func metaVersion(mappings map[string]interface{}) string {
+	meta, _ := mappings["_meta"].(map[string]interface{})
+	if v, ok := meta["version"]; ok {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// flatten turns nested settings into dotted keys, values become strings as elasticsearch returns.
+func flatten(prefix string, v interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	switch v := v.(type) {
+	case nil:
+	case map[string]interface{}:
+		for k, vv := range v {
+			for fk, fv := range flatten(prefix+k+".", vv) {
+				out[fk] = fv
+			}
+		}
+	default:
+		out[strings.TrimSuffix(prefix, ".")] = normalize(v)
+	}
+	return out
+}
+
+// normalize makes values comparable between json numbers, booleans and strings which elasticsearch returns,
+// slices of any type such as []string in Go are joined like []interface{} which is decoded from json.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		return flatten("", v)
+	}
+
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		out := make([]string, rv.Len())
+		for i := range out {
+			out[i] = fmt.Sprint(rv.Index(i).Interface())
+		}
+		return strings.Join(out, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
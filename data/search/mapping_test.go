@@ -0,0 +1,200 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/data/search/searchtest"
+)
+
+func TestMappingDiff(t *testing.T) {
+	t.Helper()
+
+	live := map[string]interface{}{}
+	_ = json.Unmarshal([]byte(`{
+		"_meta": {"version": 1},
+		"properties": {
+			"name": {"type": "text", "analyzer": "kuromoji", "fields": {"raw": {"type": "keyword"}}},
+			"employees": {"type": "integer"},
+			"address": {"properties": {"city": {"type": "keyword", "normalizer": "lowercase"}}},
+			"legacy": {"type": "keyword", "ignore_above": 256}
+		}
+	}`), &live)
+
+	r := NewMappingRegistry(nil, nil)
+	if err := r.Register("companies", []byte(`{
+		"settings": {"number_of_shards": 1, "number_of_replicas": 2, "analysis": {"analyzer": {"ja": {"type": "kuromoji"}}}},
+		"mappings": {
+			"_meta": {"version": 2},
+			"properties": {
+				"name": {"type": "text", "analyzer": "kuromoji", "fields": {"raw": {"type": "keyword"}, "ngram": {"type": "text"}}},
+				"employees": {"type": "long"},
+				"address": {"properties": {"city": {"type": "keyword"}, "zip": {"type": "keyword"}}},
+				"tags": {"type": "keyword", "ignore_above": 128}
+			}
+		}
+	}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	m, _ := r.Mapping("companies")
+	if m.Version() != "2" || metaVersion(live) != "1" {
+		t.Errorf("mapping version error: %s", m.Version())
+	}
+	if !strings.HasPrefix(m.Body(), `{"settings":`) || !strings.Contains(m.Body(), `"mappings":{"_meta"`) {
+		t.Errorf("mapping body error: %s", m.Body())
+	}
+
+	plan := &MigrationPlan{Settings: map[string]interface{}{}}
+	diffProperties("", properties(live), properties(m.Mappings), plan)
+
+	if !reflect.DeepEqual(plan.Added, []string{"address.zip", "name.ngram", "tags"}) {
+		t.Errorf("mapping added error: %#+v", plan.Added)
+	}
+	if !reflect.DeepEqual(plan.Breaking, []string{"address.city.normalizer: lowercase => removed", "employees.type: integer => long"}) {
+		t.Errorf("mapping breaking error: %#+v", plan.Breaking)
+	}
+	if !reflect.DeepEqual(plan.Removed, []string{"legacy"}) {
+		t.Errorf("mapping removed error: %#+v", plan.Removed)
+	}
+
+	liveSettings := map[string]interface{}{}
+	_ = json.Unmarshal([]byte(`{"index": {"number_of_shards": "1", "number_of_replicas": "1", "analysis": {"analyzer": {"ja": {"type": "kuromoji"}}}}}`), &liveSettings)
+
+	plan = &MigrationPlan{Settings: map[string]interface{}{}}
+	diffSettings(flatten("", liveSettings), flatten("", m.Settings), plan)
+	if len(plan.Breaking) != 0 || len(plan.Settings) != 1 || plan.Settings["index.number_of_replicas"] != "2" {
+		t.Errorf("settings diff error: %#+v", plan)
+	}
+
+	m.Settings["analysis"] = map[string]interface{}{"analyzer": map[string]interface{}{"ja": map[string]interface{}{"type": "standard"}}}
+	plan = &MigrationPlan{Settings: map[string]interface{}{}}
+	diffSettings(flatten("", liveSettings), flatten("", m.Settings), plan)
+	if len(plan.Breaking) != 1 || !strings.HasPrefix(plan.Breaking[0], "settings.analysis.analyzer.ja.type") {
+		t.Errorf("settings analysis must be breaking: %#+v", plan.Breaking)
+	}
+}
+
+func TestMappingPlanSuggest(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	ctx := context.Background()
+
+	r := NewMappingRegistry(newCommand(testEnv{}, nil), srv.Client())
+	if err := r.Register("companies", []byte(`{"mappings": {"_meta": {"version": 1}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := r.Mapping("companies")
+	m.Settings = map[string]interface{}{"analysis": SuggestAnalysis()}
+	m.Mappings["properties"] = map[string]interface{}{"name": SuggestProperty()}
+
+	plan, err := r.Migrate(ctx, "companies", nil, ReindexOptions{})
+	if err != nil || plan.Action != MigrationCreate {
+		t.Fatalf("migrate error: %+v %s", plan, err)
+	}
+
+	// live settings come back as strings and arrays of json
+	plan, err = r.Plan(ctx, "companies")
+	if err != nil || plan.Action != MigrationNone || len(plan.Breaking) != 0 {
+		t.Errorf("plan must be up to date after the round trip: %+v %s", plan, err)
+	}
+}
+
+func TestMappingMigrate(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	ctx := context.Background()
+	source := func(ctx context.Context, add func(id string, doc interface{}) error) error {
+		return add("1", testCompany{Name: "eiicon"})
+	}
+
+	r := NewMappingRegistry(newCommand(testEnv{}, nil), srv.Client())
+	register := func(body string) {
+		t.Helper()
+		if err := r.Register("companies", []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	migrate := func(want MigrationAction) *MigrationPlan {
+		t.Helper()
+		plan, err := r.Migrate(ctx, "companies", source, ReindexOptions{})
+		if err != nil || plan.Action != want {
+			t.Fatalf("migrate must %s: %+v %s", want, plan, err)
+		}
+		if plan, err := r.Plan(ctx, "companies"); err != nil || plan.Action != MigrationNone {
+			t.Fatalf("plan must be up to date after %s: %+v %s", want, plan, err)
+		}
+		return plan
+	}
+
+	register(`{
+		"settings": {"number_of_replicas": 0, "refresh_interval": "5s"},
+		"mappings": {"properties": {"name": {"type": "text"}}}
+	}`)
+	first := migrate(MigrationCreate)
+
+	register(`{
+		"settings": {"number_of_replicas": 1, "refresh_interval": "5s"},
+		"mappings": {"properties": {"name": {"type": "text"}, "tags": {"type": "keyword"}}}
+	}`)
+	plan, err := r.Plan(ctx, "companies")
+	if err != nil || !reflect.DeepEqual(plan.Added, []string{"tags"}) || plan.Settings["index.number_of_replicas"] != "1" {
+		t.Errorf("update plan error: %+v %s", plan, err)
+	}
+	if migrate(MigrationUpdate).Index != first.Index {
+		t.Error("update must keep the index")
+	}
+
+	register(`{
+		"settings": {"number_of_replicas": 1, "refresh_interval": "5s", "codec": "best_compression"},
+		"mappings": {"properties": {"name": {"type": "text"}, "tags": {"type": "keyword"}}}
+	}`)
+	plan, err = r.Plan(ctx, "companies")
+	if err != nil || len(plan.Breaking) != 1 || !strings.HasPrefix(plan.Breaking[0], "settings.codec") || len(plan.Settings) != 0 {
+		t.Errorf("static settings must be breaking: %+v %s", plan, err)
+	}
+	if migrate(MigrationReindex).Index == first.Index {
+		t.Error("reindex must swap the index")
+	}
+}
+
+func TestMappingTemplates(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	tracer := NewTracer(0)
+	ctx := context.Background()
+
+	r := NewMappingRegistry(newCommand(testEnv{}, tracer), srv.Client())
+	r.RegisterComponentTemplate("ja_analysis", `{"template": {"settings": {"analysis": {"analyzer": {"ja": {"type": "kuromoji"}}}}}}`)
+	r.RegisterIndexTemplate("logs", `{"index_patterns": ["logs-*"], "composed_of": ["ja_analysis"]}`)
+
+	if err := r.ApplyTemplates(ctx); err != nil {
+		t.Fatalf("apply templates failed: %s", err)
+	}
+	if srv.Template("_component_template", "ja_analysis") == nil || srv.Template("_index_template", "logs") == nil {
+		t.Error("templates must be put")
+	}
+
+	r.RegisterIndexTemplate("users", `{"index_patterns": ["users-*"], "composed_of": ["missing"]}`)
+	err := r.ApplyTemplates(ctx)
+	var e *Error
+	if !xerrors.As(err, &e) || e.Op != "put_index_template" || e.Type != "invalid_index_template_exception" {
+		t.Errorf("missing component must be *Error: %#+v", err)
+	}
+
+	var count int64
+	for _, tm := range tracer.Timings() {
+		count += tm.Count
+	}
+	if count != 5 {
+		t.Errorf("templates must be traced: %#+v", tracer.Timings())
+	}
+}
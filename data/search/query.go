@@ -0,0 +1,282 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// Pagination limits which are applied by Query.Page
+const (
+	// DefaultPageSize is used when size is zero or negative.
+	DefaultPageSize = 20
+	// MaxPageSize caps size of a page.
+	MaxPageSize = 100
+	// MaxResultWindow is index.max_result_window of elasticsearch, use Iterator beyond this.
+	MaxResultWindow = 10000
+)
+
+type (
+	// Query builds a bool query along with aggregations, sorting and pagination.
+	//
+	//	svc := search.NewQuery().
+	//		Analyzer("ja_search").
+	//		Match(keyword, "name^2", "description").
+	//		Filters(&form).
+	//		Terms("tags", "hr", "it").
+	//		Range("employees", 10, nil).
+	//		Facet("tags", "tags", 20).
+	//		Sort("_score", false).
+	//		Page(page, size).
+	//		Service(client, "companies")
+	//	res, err := cmd.Search(ctx, svc)
+	Query struct {
+		must, filter, should, mustNot []elastic.Query
+
+		analyzer  string
+		aggs      map[string]elastic.Aggregation
+		aggNames  []string
+		sorts     []elastic.Sorter
+		highlight *elastic.Highlight
+		suggest   []elastic.Suggester
+		from      int
+		size      int
+	}
+)
+
+// NewQuery returns an empty query which matches all of documents.
+func NewQuery() *Query {
+	return &Query{aggs: map[string]elastic.Aggregation{}, size: DefaultPageSize}
+}
+
+// Analyzer sets a search analyzer of full-text matching. e.g. kuromoji, ja_search
+func (q *Query) Analyzer(analyzer string) *Query {
+	q.analyzer = analyzer
+	return q
+}
+
+// Match adds full-text matching on fields, every word in text must match,
+// blank text is ignored. Fields accept boost. e.g. name^2
+//
+// Text is normalized for Japanese, full-width alphanumerics and spaces become half-width
+// and half-width katakana becomes full-width.
+func (q *Query) Match(text string, fields ...string) *Query {
+	text = normalizeText(text)
+	if text == "" || len(fields) == 0 {
+		return q
+	}
+
+	mq := elastic.NewMultiMatchQuery(text, fields...).Type("cross_fields").Operator("and")
+	if q.analyzer != "" {
+		mq = mq.Analyzer(q.analyzer)
+	}
+	q.must = append(q.must, mq)
+	return q
+}
+
+// Should adds queries which boost scores of matched documents.
+func (q *Query) Should(queries ...elastic.Query) *Query {
+	q.should = append(q.should, queries...)
+	return q
+}
+
+// Filter adds queries which documents must match without scoring.
+func (q *Query) Filter(queries ...elastic.Query) *Query {
+	q.filter = append(q.filter, queries...)
+	return q
+}
+
+// MustNot adds queries which documents mustn't match.
+func (q *Query) MustNot(queries ...elastic.Query) *Query {
+	q.mustNot = append(q.mustNot, queries...)
+	return q
+}
+
+// Term adds an exact value filter.
+func (q *Query) Term(field string, value interface{}) *Query {
+	return q.Filter(elastic.NewTermQuery(field, value))
+}
+
+// Terms adds a filter which matches any of values, no values is ignored.
+func (q *Query) Terms(field string, values ...interface{}) *Query {
+	if len(values) == 0 {
+		return q
+	}
+	return q.Filter(elastic.NewTermsQuery(field, values...))
+}
+
+// Range adds a filter between gte and lte, nil bound is open.
+func (q *Query) Range(field string, gte, lte interface{}) *Query {
+	if gte == nil && lte == nil {
+		return q
+	}
+
+	rq := elastic.NewRangeQuery(field)
+	if gte != nil {
+		rq = rq.Gte(gte)
+	}
+	if lte != nil {
+		rq = rq.Lte(lte)
+	}
+	return q.Filter(rq)
+}
+
+// Filters adds filters from exported fields of a struct which has search tags,
+// zero value fields are ignored, use a pointer to filter by zero value.
+//
+//	type Form struct {
+//		Keyword      string   `search:"name^2|description,match"`
+//		Tags         []string `search:"tags"`
+//		Prefecture   *int     `search:"prefecture_id"`
+//		MinEmployees int      `search:"employees,gte"`
+//		MaxEmployees int      `search:"employees,lte"`
+//		Page         int      `search:"-"`
+//	}
+//
+// Operators are term (default, terms for slices), match, gte, gt, lte and lt.
+func (q *Query) Filters(form interface{}) *Query {
+	v := reflect.Indirect(reflect.ValueOf(form))
+	if v.Kind() != reflect.Struct {
+		return q
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("search")
+		if tag == "" || tag == "-" || !sf.IsExported() {
+			continue
+		}
+
+		fv := v.Field(i)
+		if fv.IsZero() {
+			continue
+		}
+		fv = reflect.Indirect(fv)
+
+		field, op, _ := strings.Cut(tag, ",")
+		switch op {
+		case "match":
+			if fv.Kind() == reflect.String {
+				q.Match(fv.String(), strings.Split(field, "|")...)
+			}
+		case "gte":
+			q.Filter(elastic.NewRangeQuery(field).Gte(fv.Interface()))
+		case "gt":
+			q.Filter(elastic.NewRangeQuery(field).Gt(fv.Interface()))
+		case "lte":
+			q.Filter(elastic.NewRangeQuery(field).Lte(fv.Interface()))
+		case "lt":
+			q.Filter(elastic.NewRangeQuery(field).Lt(fv.Interface()))
+		default:
+			if fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array {
+				values := make([]interface{}, fv.Len())
+				for j := range values {
+					values[j] = fv.Index(j).Interface()
+				}
+				q.Terms(field, values...)
+				continue
+			}
+			q.Term(field, fv.Interface())
+		}
+	}
+
+	return q
+}
+
+// Facet adds a terms aggregation by name which counts top size values of field.
+func (q *Query) Facet(name, field string, size int) *Query {
+	return q.Aggregation(name, elastic.NewTermsAggregation().Field(field).Size(size))
+}
+
+// Aggregation adds an aggregation by name.
+func (q *Query) Aggregation(name string, agg elastic.Aggregation) *Query {
+	if _, ok := q.aggs[name]; !ok {
+		q.aggNames = append(q.aggNames, name)
+	}
+	q.aggs[name] = agg
+	return q
+}
+
+// Sort adds a sort order, use "_score" for relevance.
+func (q *Query) Sort(field string, ascending bool) *Query {
+	q.sorts = append(q.sorts, elastic.NewFieldSort(field).Order(ascending))
+	return q
+}
+
+// Highlight highlights matched words of fields.
+func (q *Query) Highlight(fields ...string) *Query {
+	hl := elastic.NewHighlight()
+	for _, f := range fields {
+		hl = hl.Field(f)
+	}
+	q.highlight = hl
+	return q
+}
+
+// Page sets a page which starts from 1, size is normalized into 1 to MaxPageSize
+// and the page is capped so that the result stays in MaxResultWindow.
+func (q *Query) Page(page, size int) *Query {
+	q.from, q.size = normalizePage(page, size)
+	return q
+}
+
+// From returns an offset of the page.
+func (q *Query) From() int {
+	return q.from
+}
+
+// Size returns a size of the page.
+func (q *Query) Size() int {
+	return q.size
+}
+
+// Build returns a bool query, or match_all query when nothing is added.
+func (q *Query) Build() elastic.Query {
+	if len(q.must)+len(q.filter)+len(q.should)+len(q.mustNot) == 0 {
+		return elastic.NewMatchAllQuery()
+	}
+
+	return elastic.NewBoolQuery().
+		Must(q.must...).
+		Filter(q.filter...).
+		Should(q.should...).
+		MustNot(q.mustNot...)
+}
+
+// Apply sets the query, aggregations, sorting, pagination and suggesters into a search service.
+func (q *Query) Apply(svc *elastic.SearchService) *elastic.SearchService {
+	svc = svc.Query(q.Build()).From(q.from).Size(q.size)
+	for _, name := range q.aggNames {
+		svc = svc.Aggregation(name, q.aggs[name])
+	}
+	if len(q.sorts) > 0 {
+		svc = svc.SortBy(q.sorts...)
+	}
+	if q.highlight != nil {
+		svc = svc.Highlight(q.highlight)
+	}
+	for _, s := range q.suggest {
+		svc = svc.Suggester(s)
+	}
+	return svc
+}
+
+// Service returns a search service on indices which is ready for Command.Search.
+func (q *Query) Service(client *elastic.Client, indices ...string) *elastic.SearchService {
+	return q.Apply(client.Search(indices...))
+}
+
+func normalizePage(page, size int) (int, int) {
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	if size > MaxPageSize {
+		size = MaxPageSize
+	}
+	// page comes from user input, it's clamped to MaxResultWindow before multiplying not to overflow
+	page = min(max(page, 1), MaxResultWindow/size)
+
+	return (page - 1) * size, size
+}
@@ -0,0 +1,119 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func querySource(t *testing.T, q elastic.Query) string {
+	t.Helper()
+
+	src, err := q.Source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(src)
+	return string(b)
+}
+
+func TestQueryFilters(t *testing.T) {
+	t.Helper()
+
+	zero := 0
+	form := struct {
+		Keyword      string   `search:"name^2|description,match"`
+		Tags         []string `search:"tags"`
+		Prefecture   *int     `search:"prefecture_id"`
+		MinEmployees int      `search:"employees,gte"`
+		MaxEmployees int      `search:"employees,lte"`
+		Listed       bool     `search:"listed"`
+		Page         int      `search:"-"`
+	}{
+		Keyword:      "ｲｲｺﾝ　ＡＩ",
+		Tags:         []string{"hr", "it"},
+		Prefecture:   &zero,
+		MinEmployees: 10,
+		Page:         3,
+	}
+
+	q := NewQuery().Analyzer("ja_search").Filters(&form)
+	got := querySource(t, q.Build())
+
+	for _, want := range []string{
+		`"query":"イイコン AI"`,
+		`"analyzer":"ja_search"`,
+		`"fields":["name^2","description"]`,
+		`{"terms":{"tags":["hr","it"]}}`,
+		`{"term":{"prefecture_id":0}}`,
+		`{"range":{"employees":{"from":10,"include_lower":true,"include_upper":true,"to":null}}}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("query must contain %s: %s", want, got)
+		}
+	}
+	if strings.Contains(got, "listed") || strings.Contains(got, `"to":0`) {
+		t.Errorf("query must ignore zero values: %s", got)
+	}
+}
+
+func TestQueryBuild(t *testing.T) {
+	t.Helper()
+
+	if got := querySource(t, NewQuery().Match("　", "name").Terms("tags").Range("age", nil, nil).Build()); got != `{"match_all":{}}` {
+		t.Errorf("empty query must match all: %s", got)
+	}
+
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"hits":{"hits":[]}}`)
+	}))
+	defer srv.Close()
+
+	client, err := elastic.NewClient(elastic.SetURL(srv.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := NewQuery().Match("eiicon", "name").Facet("tags", "tags", 10).Sort("_score", false).Page(2, 30)
+	if _, err := q.Service(client, "companies").Do(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{`"from":30`, `"size":30`, `"aggregations":{"tags":{"terms":{"field":"tags","size":10}}}`, `"sort":[{"_score":{"order":"desc"}}]`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("search source must contain %s: %s", want, got)
+		}
+	}
+}
+
+func TestNormalizePage(t *testing.T) {
+	t.Helper()
+
+	cases := []struct{ page, size, from, wantSize int }{
+		{0, 0, 0, DefaultPageSize},
+		{2, 10, 10, 10},
+		{1, 1000, 0, MaxPageSize},
+		{1000, 100, MaxResultWindow - 100, 100},
+		{-1, 30, 0, 30},
+		{math.MaxInt, 100, MaxResultWindow - 100, 100},
+		{math.MaxInt / 10, 30, (MaxResultWindow/30 - 1) * 30, 30},
+	}
+	for _, c := range cases {
+		from, size := normalizePage(c.page, c.size)
+		if from != c.from || size != c.wantSize {
+			t.Errorf("normalize page(%d, %d) = %d, %d", c.page, c.size, from, size)
+		}
+	}
+}
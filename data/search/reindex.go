@@ -0,0 +1,316 @@
+package search
+
+import (
+	"context"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/logger"
+)
+
+type (
+	// DocumentSource yields all of documents into a new index by calling add,
+	// returning an error aborts reindexing and the new index is deleted.
+	DocumentSource func(ctx context.Context, add func(id string, doc interface{}) error) error
+
+	// ReindexOptions configures a Reindexer.
+	ReindexOptions struct {
+		// Alias is a name which applications search by. e.g. "companies"
+		Alias string
+		// Body is settings and mappings of a new index.
+		Body string
+		// BatchSize is a number of documents in a bulk request, default 1000.
+		BatchSize int
+		// Replicas is a number_of_replicas which is restored after loading, nil is 1.
+		// e.g. search.Int(0) on a single node cluster
+		Replicas *int
+		// RefreshInterval is a refresh_interval which is restored after loading, default 1s.
+		RefreshInterval string
+		// Retain is a number of previous indices which are kept for rollback, nil is 1.
+		// Negative value keeps all of them.
+		Retain *int
+		// MaxFailures is a number of documents which are allowed to fail in bulk requests.
+		MaxFailures int
+		// MinRatio aborts alias swap when a new index has fewer documents than the ratio
+		// of current index. e.g. 0.9 allows 10% decrease. Zero disables the check.
+		MinRatio float64
+		// Validate is called with a new index and its document count before alias swap.
+		Validate func(ctx context.Context, index string, count int64) error
+	}
+
+	// ReindexResult reports a reindexing.
+	ReindexResult struct {
+		// Index is a new index which the alias points to.
+		Index string
+		// Previous is indices which the alias pointed to.
+		Previous []string
+		// Deleted is indices which were dropped by retention.
+		Deleted []string
+		// Indexed is a number of documents which were indexed successfully.
+		Indexed int64
+		// Documents is a number of unique documents, it's less than Indexed when
+		// the source yields an id twice.
+		Documents int64
+		// Failed is a number of documents which were failed in bulk requests.
+		Failed int64
+	}
+
+	// Reindexer builds a timestamped index, bulk loads documents, swaps an alias
+	// and drops old indices without downtime.
+	Reindexer struct {
+		cmd    Command
+		client *elastic.Client
+		opts   ReindexOptions
+	}
+)
+
+// NewReindexer returns Reindexer, the client had better be given by util.ESBulkConn.
+func NewReindexer(cmd Command, client *elastic.Client, opts ReindexOptions) *Reindexer {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.Replicas == nil {
+		opts.Replicas = Int(1)
+	}
+	if opts.RefreshInterval == "" {
+		opts.RefreshInterval = "1s"
+	}
+	if opts.Retain == nil {
+		opts.Retain = Int(1)
+	}
+
+	return &Reindexer{cmd: cmd, client: client, opts: opts}
+}
+
+// Run reindexes all of documents from source, the new index is deleted when anything fails
+// before the alias swap so that the current index keeps serving.
+func (r *Reindexer) Run(ctx context.Context, source DocumentSource) (*ReindexResult, error) {
+	alias := r.opts.Alias
+	if alias == "" {
+		return nil, xerrors.New("reindex alias is blank")
+	}
+
+	res, err := r.cmd.Aliases(ctx, r.client, alias)
+	if err != nil && !IsNotFound(err) {
+		return nil, xerrors.Errorf("failed to get alias <%s>: %w", alias, err)
+	}
+	previous := []string{}
+	if err == nil {
+		previous = res.Indices(alias)
+	}
+
+	result := &ReindexResult{Index: MakeIndexName(alias), Previous: previous}
+
+	if _, err := r.cmd.CreateIndex(ctx, r.client, result.Index, r.opts.Body); err != nil {
+		return nil, xerrors.Errorf("failed to create index <%s>: %w", result.Index, err)
+	}
+	logger.Printf("[INFO] reindex <%s> started into <%s>", alias, result.Index)
+
+	if err := r.load(ctx, result, source); err != nil {
+		return result, r.rollback(result.Index, err)
+	}
+	if err := r.validate(ctx, result); err != nil {
+		return result, r.rollback(result.Index, err)
+	}
+	if err := r.swap(ctx, result); err != nil {
+		return result, r.rollback(result.Index, err)
+	}
+
+	msg := "[INFO] reindex <%s> swapped <%s> to <%s> with %d documents"
+	logger.Printf(msg, alias, strings.Join(previous, ","), result.Index, result.Indexed)
+
+	deleted, err := r.retain(ctx, result.Index)
+	result.Deleted = deleted
+	if err != nil {
+		// the alias has been swapped already, old indices are left as they are.
+		logger.Printf("[WARN] reindex <%s> failed to drop old indices: %s", alias, err)
+	}
+
+	return result, nil
+}
+
+// load disables replicas and refresh during bulk loading and restores them afterwards.
+func (r *Reindexer) load(ctx context.Context, result *ReindexResult, source DocumentSource) error {
+	if err := r.settings(ctx, result.Index, 0, "-1"); err != nil {
+		return err
+	}
+
+	var reqs []elastic.BulkableRequest
+	flush := func() error {
+		if len(reqs) == 0 {
+			return nil
+		}
+
+		bulk := r.client.Bulk().Index(result.Index).Add(reqs...)
+		reqs = reqs[:0]
+
+		res, err := r.cmd.Bulk(ctx, bulk)
+		if err != nil {
+			return xerrors.Errorf("failed to bulk into <%s>: %w", result.Index, err)
+		}
+
+		resp, _ := res.Res.(*elastic.BulkResponse)
+		if resp == nil {
+			return nil
+		}
+		failed := resp.Failed()
+		result.Indexed += int64(len(resp.Items) - len(failed))
+		result.Failed += int64(len(failed))
+		for _, item := range resp.Indexed() {
+			if item.Result == "created" {
+				result.Documents++
+			}
+		}
+
+		if result.Failed > int64(r.opts.MaxFailures) {
+			reason := ""
+			if len(failed) > 0 && failed[0].Error != nil {
+				reason = failed[0].Error.Reason
+			}
+			return xerrors.Errorf("too many documents failed in <%s>: %d, e.g. %s", result.Index, result.Failed, reason)
+		}
+		return nil
+	}
+
+	add := func(id string, doc interface{}) error {
+		reqs = append(reqs, elastic.NewBulkIndexRequest().Id(id).Doc(doc))
+		if len(reqs) >= r.opts.BatchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	if err := source(ctx, add); err != nil {
+		return xerrors.Errorf("failed to load documents into <%s>: %w", result.Index, err)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if err := r.settings(ctx, result.Index, *r.opts.Replicas, r.opts.RefreshInterval); err != nil {
+		return err
+	}
+	if _, err := r.cmd.Refresh(ctx, r.client, result.Index); err != nil {
+		return xerrors.Errorf("failed to refresh <%s>: %w", result.Index, err)
+	}
+
+	return nil
+}
+
+func (r *Reindexer) settings(ctx context.Context, index string, replicas int, refresh string) error {
+	body := map[string]interface{}{
+		"index": map[string]interface{}{
+			"number_of_replicas": replicas,
+			"refresh_interval":   refresh,
+		},
+	}
+	if _, err := r.cmd.PutSettings(ctx, r.client, index, body); err != nil {
+		return xerrors.Errorf("failed to put settings <%s>: %w", index, err)
+	}
+	return nil
+}
+
+// validate compares document counts before the alias swap.
+func (r *Reindexer) validate(ctx context.Context, result *ReindexResult) error {
+	count, err := r.cmd.Count(ctx, r.client, result.Index, nil)
+	if err != nil {
+		return xerrors.Errorf("failed to count <%s>: %w", result.Index, err)
+	}
+	if count != result.Documents {
+		return xerrors.Errorf("document count mismatch <%s>: indexed %d, counted %d", result.Index, result.Documents, count)
+	}
+
+	if r.opts.MinRatio > 0 && len(result.Previous) > 0 {
+		current, err := r.cmd.Count(ctx, r.client, strings.Join(result.Previous, ","), nil)
+		if err != nil {
+			return xerrors.Errorf("failed to count <%s>: %w", strings.Join(result.Previous, ","), err)
+		}
+		if float64(count) < float64(current)*r.opts.MinRatio {
+			return xerrors.Errorf("document count decreased <%s>: %d => %d", result.Index, current, count)
+		}
+	}
+
+	if r.opts.Validate != nil {
+		if err := r.opts.Validate(ctx, result.Index, count); err != nil {
+			return xerrors.Errorf("validation failed <%s>: %w", result.Index, err)
+		}
+	}
+
+	return nil
+}
+
+// swap points the alias to a new index atomically.
+func (r *Reindexer) swap(ctx context.Context, result *ReindexResult) error {
+	switch len(result.Previous) {
+	case 0:
+		if _, err := r.cmd.PutAlias(ctx, r.client, result.Index, r.opts.Alias); err != nil {
+			return xerrors.Errorf("failed to put alias <%s>: %w", r.opts.Alias, err)
+		}
+	case 1:
+		if _, err := r.cmd.UpdateAliases(ctx, r.client, r.opts.Alias, result.Previous[0], result.Index); err != nil {
+			return xerrors.Errorf("failed to update alias <%s>: %w", r.opts.Alias, err)
+		}
+	default:
+		if _, err := r.cmd.SwapAlias(ctx, r.client, r.opts.Alias, result.Index, result.Previous...); err != nil {
+			return xerrors.Errorf("failed to update alias <%s>: %w", r.opts.Alias, err)
+		}
+	}
+	return nil
+}
+
+// retain drops previous indices of the alias except recent ones.
+func (r *Reindexer) retain(ctx context.Context, current string) ([]string, error) {
+	if *r.opts.Retain < 0 {
+		return nil, nil
+	}
+
+	names, err := r.cmd.ListIndexNames(ctx, r.client)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	for _, ix := range expiredIndices(r.opts.Alias, current, names, *r.opts.Retain) {
+		if _, err := r.cmd.DeleteIndex(ctx, r.client, ix); err != nil {
+			return deleted, xerrors.Errorf("failed to delete index <%s>: %w", ix, err)
+		}
+		deleted = append(deleted, ix)
+	}
+
+	return deleted, nil
+}
+
+// rollback deletes a new index and returns cause.
+func (r *Reindexer) rollback(index string, cause error) error {
+	// the context may be canceled already, rollback must be done anyway.
+	if _, err := r.cmd.DeleteIndex(context.Background(), r.client, index); err != nil {
+		logger.Printf("[WARN] reindex failed to rollback <%s>: %s", index, err)
+	}
+
+	logger.Printf("[WARN] reindex <%s> rolled back: %s", index, cause)
+	return cause
+}
+
+// Int returns a pointer of n for optional settings which zero is meaningful, e.g. ReindexOptions.Replicas.
+func Int(n int) *int {
+	return &n
+}
+
+// expiredIndices returns timestamped indices of alias except current and recent retain ones.
+func expiredIndices(alias, current string, names []string, retain int) []string {
+	var expired []string
+	kept := 0
+	for _, g := range IndexGenerations(alias, names) {
+		if g.Name == current {
+			continue
+		}
+		if kept < retain {
+			kept++
+			continue
+		}
+		expired = append(expired, g.Name)
+	}
+	return expired
+}
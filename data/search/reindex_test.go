@@ -0,0 +1,174 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/eiicon-company/go-core/data/search/searchtest"
+)
+
+func TestExpiredIndices(t *testing.T) {
+	t.Helper()
+
+	names := []string{
+		"companies_1700000000300000000", "companies_1700000000100000000",
+		"companies_1700000000200000000", "companies_1700000000400000000",
+		"companies", "companies_tmp", "company_users_1700000000100000000", ".kibana",
+	}
+
+	got := expiredIndices("companies", "companies_1700000000400000000", names, 1)
+	if !reflect.DeepEqual(got, []string{"companies_1700000000200000000", "companies_1700000000100000000"}) {
+		t.Errorf("expired indices error: %#+v", got)
+	}
+
+	if got := expiredIndices("companies", "companies_1700000000400000000", names, 3); len(got) != 0 {
+		t.Errorf("expired indices must be empty: %#+v", got)
+	}
+	if got := expiredIndices("companies", "companies_1700000000400000000", names, 0); len(got) != 3 {
+		t.Errorf("expired indices must drop all previous: %#+v", got)
+	}
+}
+
+func TestReindexerRun(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	client := srv.Client()
+	cmd := newCommand(testEnv{}, nil)
+	ctx := context.Background()
+
+	source := func(n int) DocumentSource {
+		return func(ctx context.Context, add func(id string, doc interface{}) error) error {
+			for i := 1; i <= n; i++ {
+				if err := add(strconv.Itoa(i), testCompany{Name: fmt.Sprintf("company %d", i)}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	r := NewReindexer(cmd, client, ReindexOptions{Alias: "companies", BatchSize: 2, MinRatio: 0.9})
+	first, err := r.Run(ctx, source(3))
+	if err != nil {
+		t.Fatalf("reindex failed: %s", err)
+	}
+	if first.Indexed != 3 || len(first.Previous) != 0 {
+		t.Errorf("reindex result error: %#+v", first)
+	}
+
+	second, err := r.Run(ctx, source(3))
+	if err != nil {
+		t.Fatalf("reindex failed: %s", err)
+	}
+	if !reflect.DeepEqual(second.Previous, []string{first.Index}) {
+		t.Errorf("reindex previous error: %#+v", second)
+	}
+
+	// too few documents roll back and keep the alias
+	if _, err := r.Run(ctx, source(1)); err == nil {
+		t.Fatal("reindex must fail by min ratio")
+	}
+	res, err := cmd.Aliases(ctx, client, "companies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Indices("companies"); !reflect.DeepEqual(got, []string{second.Index}) {
+		t.Errorf("alias error: %v", got)
+	}
+	if got := srv.Indices(); !reflect.DeepEqual(got, []string{first.Index, second.Index}) {
+		t.Errorf("indices error: %v", got)
+	}
+}
+
+func TestReindexerOptions(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	client := srv.Client()
+	cmd := newCommand(testEnv{}, nil)
+	ctx := context.Background()
+
+	// the source yields id 1 twice
+	source := func(ctx context.Context, add func(id string, doc interface{}) error) error {
+		for _, id := range []string{"1", "2", "1"} {
+			if err := add(id, testCompany{Name: "company " + id}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	r := NewReindexer(cmd, client, ReindexOptions{Alias: "companies", Replicas: Int(0), Retain: Int(0)})
+	first, err := r.Run(ctx, source)
+	if err != nil {
+		t.Fatalf("duplicated ids must be indexed: %s", err)
+	}
+	if first.Indexed != 3 || first.Documents != 2 {
+		t.Errorf("reindex result error: %#+v", first)
+	}
+
+	settings, err := client.IndexGetSettings(first.Index).Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, _ := settings[first.Index].Settings["index"].(map[string]interface{})
+	if ix["number_of_replicas"] != "0" {
+		t.Errorf("replicas must be zero: %v", ix)
+	}
+
+	second, err := r.Run(ctx, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(second.Deleted, []string{first.Index}) || !reflect.DeepEqual(srv.Indices(), []string{second.Index}) {
+		t.Errorf("retain zero must drop previous indices: %#+v %v", second, srv.Indices())
+	}
+}
+
+func TestReindexerSwapAliases(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	client := srv.Client()
+	tracer := NewTracer(0)
+	cmd := newCommand(testEnv{}, tracer)
+	ctx := context.Background()
+
+	for _, ix := range []string{"companies_1700000000", "companies_1700000001"} {
+		if _, err := cmd.CreateIndex(ctx, client, ix, ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cmd.PutAlias(ctx, client, ix, "companies"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tracer.Reset()
+
+	source := func(ctx context.Context, add func(id string, doc interface{}) error) error {
+		return add("1", testCompany{Name: "company 1"})
+	}
+
+	r := NewReindexer(cmd, client, ReindexOptions{Alias: "companies", Retain: Int(-1)})
+	result, err := r.Run(ctx, source)
+	if err != nil {
+		t.Fatalf("reindex failed: %s", err)
+	}
+
+	res, err := cmd.Aliases(ctx, client, "companies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Indices("companies"); !reflect.DeepEqual(got, []string{result.Index}) {
+		t.Errorf("alias must point to only the new index: %v", got)
+	}
+
+	// create, settings twice, refresh and count of the new index, and aliases, swap and the check above of the alias
+	timings := tracer.Timings()
+	if timings[result.Index].Count != 5 || timings["companies"].Count != 3 {
+		t.Errorf("reindex must be traced: %#+v", timings)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -18,6 +19,11 @@ type (
 	Command interface {
 		Search(ctx context.Context, search *elastic.SearchService) (*Result, error)
 		Bulk(ctx context.Context, bulk *elastic.BulkService) (*Result, error)
+		Get(ctx context.Context, get *elastic.GetService) (*Result, error)
+		MultiGet(ctx context.Context, mget *elastic.MgetService) (*Result, error)
+		Index(ctx context.Context, index *elastic.IndexService) (*Result, error)
+		Update(ctx context.Context, update *elastic.UpdateService) (*Result, error)
+		Delete(ctx context.Context, del *elastic.DeleteService) (*Result, error)
 		PostDocument(ctx context.Context, client *elastic.Client, name string, id int, doc string) (*Result, error)
 		DeleteDocument(ctx context.Context, client *elastic.Client, name string, id int) (*Result, error)
 		UpdateByScript(ctx context.Context, client *elastic.Client, name string, id int, script string, params map[string]interface{}) (*Result, error)
@@ -28,18 +34,37 @@ type (
 		Aliases(ctx context.Context, client *elastic.Client, name string) (*Result, error)
 		PutAlias(ctx context.Context, client *elastic.Client, name, alias string) (*Result, error)
 		UpdateAliases(ctx context.Context, client *elastic.Client, name, oldIx, newIx string) (*Result, error)
+		SwapAlias(ctx context.Context, client *elastic.Client, name, newIx string, oldIxs ...string) (*Result, error)
+		PutSettings(ctx context.Context, client *elastic.Client, name string, body interface{}) (*Result, error)
+		Refresh(ctx context.Context, client *elastic.Client, indices ...string) (*Result, error)
+		GetSettings(ctx context.Context, client *elastic.Client, name string) (*Result, error)
+		GetMapping(ctx context.Context, client *elastic.Client, name string) (*Result, error)
+		PutMapping(ctx context.Context, client *elastic.Client, name string, body map[string]interface{}) (*Result, error)
+		PutComponentTemplate(ctx context.Context, client *elastic.Client, name, body string) (*Result, error)
+		PutIndexTemplate(ctx context.Context, client *elastic.Client, name, body string) (*Result, error)
+		Health(ctx context.Context, client *elastic.Client, indices ...string) (*Result, error)
+		Stats(ctx context.Context, client *elastic.Client, indices ...string) (*Result, error)
+		Count(ctx context.Context, client *elastic.Client, name string, query elastic.Query) (int64, error)
+		DeleteByQuery(ctx context.Context, client *elastic.Client, name string, query elastic.Query, opts ByQueryOptions) (*Task, error)
+		UpdateByQuery(ctx context.Context, client *elastic.Client, name string, query elastic.Query, script *elastic.Script, opts ByQueryOptions) (*Task, error)
 	}
 
 	// command defines interfaces as elasticsearch api.
 	command struct {
 		Env      util.Environment
 		ESClient *elastic.Client
+		Tracer   *Tracer
 	}
 
 	// Result has common to return a value
 	Result struct {
 		Res interface{} // ES Result Buffer
-		Err error
+	}
+
+	// Generation is a timestamped index which is made by MakeIndexName
+	Generation struct {
+		Name    string
+		Created time.Time
 	}
 )
 
@@ -53,6 +78,37 @@ func (cr *Result) Indices(alias string) []string {
 	}
 }
 
+// Status returns a cluster health status, or index health status when index is given.
+// e.g. green, yellow, red
+func (cr *Result) Status(index string) string {
+	value, ok := cr.Res.(*elastic.ClusterHealthResponse)
+	if !ok {
+		return ""
+	}
+	if index == "" {
+		return value.Status
+	}
+	if ix, ok := value.Indices[index]; ok {
+		return ix.Status
+	}
+	return ""
+}
+
+// DocCounts returns primary document counts by index of Stats
+func (cr *Result) DocCounts() map[string]int64 {
+	counts := map[string]int64{}
+	value, ok := cr.Res.(*elastic.IndicesStatsResponse)
+	if !ok {
+		return counts
+	}
+	for name, ix := range value.Indices {
+		if ix.Primaries != nil && ix.Primaries.Docs != nil {
+			counts[name] = ix.Primaries.Docs.Count
+		}
+	}
+	return counts
+}
+
 // JSON returns value as JSON
 func (cr *Result) JSON() []byte {
 	bytes, _ := json.Marshal(cr.Res)
@@ -78,150 +134,468 @@ func MakeIndexName(name string) string {
 	return fmt.Sprintf("%s_%d", name, time.Now().UnixNano())
 }
 
-// RestoreIndexName returns remove timestamp suffix
+// RestoreIndexName returns remove timestamp suffix, name is returned as is when it has no timestamp suffix.
+// e.g. user_profiles_1700000000000000000 => user_profiles
 func RestoreIndexName(name string) string {
-	return strings.Split(name, "_")[0]
+	base, _, ok := ParseIndexName(name)
+	if !ok {
+		return name
+	}
+	return base
+}
+
+// ParseIndexName splits name into base name and creation time by the last underscore,
+// the suffix must be unix time in seconds, milliseconds, microseconds or nanoseconds.
+func ParseIndexName(name string) (string, time.Time, bool) {
+	i := strings.LastIndex(name, "_")
+	if i <= 0 {
+		return "", time.Time{}, false
+	}
+
+	suffix := name[i+1:]
+	n, err := strconv.ParseInt(suffix, 10, 64)
+	if err != nil || n <= 0 || suffix[0] == '0' {
+		return "", time.Time{}, false
+	}
+
+	var ts time.Time
+	switch len(suffix) {
+	case 10:
+		ts = time.Unix(n, 0)
+	case 13:
+		ts = time.UnixMilli(n)
+	case 16:
+		ts = time.UnixMicro(n)
+	case 19:
+		ts = time.Unix(0, n)
+	default:
+		return "", time.Time{}, false
+	}
+
+	return name[:i], ts, true
 }
 
-func (c *command) do(ctx context.Context, fn func(chan *Result)) (*Result, error) {
-	rch := make(chan *Result, 1)
+// IndexGenerations returns timestamped indices of base name in names, newest first.
+func IndexGenerations(base string, names []string) []Generation {
+	var gens []Generation
+	for _, name := range names {
+		b, ts, ok := ParseIndexName(name)
+		if !ok || b != base {
+			continue
+		}
+		gens = append(gens, Generation{Name: name, Created: ts})
+	}
 
-	go fn(rch)
+	sort.SliceStable(gens, func(i, j int) bool { return gens[i].Created.After(gens[j].Created) })
+	return gens
+}
 
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case cr := <-rch:
-		return cr, cr.Err
+// ListGenerations returns timestamped indices of base name on a cluster, newest first.
+func ListGenerations(ctx context.Context, cmd Command, client *elastic.Client, base string) ([]Generation, error) {
+	names, err := cmd.ListIndexNames(ctx, client)
+	if err != nil {
+		return nil, err
 	}
+	return IndexGenerations(base, names), nil
+}
+
+// do calls fn with ctx through the tracer, an error is returned as *Error.
+func (c *command) do(ctx context.Context, op, index string, fn func(context.Context) (interface{}, error)) (*Result, error) {
+	var res interface{}
+	run := func(ctx context.Context) (err error) {
+		res, err = fn(ctx)
+		return err
+	}
+
+	var err error
+	if c.Tracer == nil {
+		err = run(ctx)
+	} else {
+		err = c.Tracer.Trace(ctx, op, index, run)
+	}
+	if err != nil {
+		return nil, newError(op, index, err)
+	}
+	return &Result{Res: res}, nil
 }
 
 func (c *command) Search(ctx context.Context, search *elastic.SearchService) (*Result, error) {
-	fn := func(rch chan *Result) {
+	fn := func(ctx context.Context) (interface{}, error) {
 		res, err := search.Pretty(c.Env.IsDebug()).Do(ctx)
-		rch <- &Result{Res: res, Err: err}
+		return res, err
 	}
 
-	return c.do(ctx, fn)
+	return c.do(ctx, "search", "", fn)
 }
 
 func (c *command) Bulk(ctx context.Context, bulk *elastic.BulkService) (*Result, error) {
-	fn := func(rch chan *Result) {
+	fn := func(ctx context.Context) (interface{}, error) {
 		res, err := bulk.Do(ctx)
-		rch <- &Result{Res: res, Err: err}
+		return res, err
+	}
+
+	return c.do(ctx, "bulk", "", fn)
+}
+
+func (c *command) Get(ctx context.Context, get *elastic.GetService) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := get.Pretty(c.Env.IsDebug()).Do(ctx)
+		return res, err
+	}
+
+	return c.do(ctx, "get", "", fn)
+}
+
+func (c *command) MultiGet(ctx context.Context, mget *elastic.MgetService) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := mget.Pretty(c.Env.IsDebug()).Do(ctx)
+		return res, err
+	}
+
+	return c.do(ctx, "mget", "", fn)
+}
+
+func (c *command) Index(ctx context.Context, index *elastic.IndexService) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := index.Pretty(c.Env.IsDebug()).Do(ctx)
+		return res, err
+	}
+
+	return c.do(ctx, "index", "", fn)
+}
+
+func (c *command) Update(ctx context.Context, update *elastic.UpdateService) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := update.Pretty(c.Env.IsDebug()).Do(ctx)
+		return res, err
 	}
 
-	return c.do(ctx, fn)
+	return c.do(ctx, "update", "", fn)
+}
+
+func (c *command) Delete(ctx context.Context, del *elastic.DeleteService) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := del.Pretty(c.Env.IsDebug()).Do(ctx)
+		return res, err
+	}
+
+	return c.do(ctx, "delete", "", fn)
 }
 
 func (c *command) PostDocument(ctx context.Context, client *elastic.Client, name string, id int, doc string) (*Result, error) {
-	fn := func(rch chan *Result) {
+	fn := func(ctx context.Context) (interface{}, error) {
 		res, err := client.Index().
 			Pretty(c.Env.IsDebug()).
 			Index(name).Id(strconv.Itoa(id)).BodyString(doc).Do(ctx)
-		rch <- &Result{Res: res, Err: err}
+		return res, err
 	}
 
-	return c.do(ctx, fn)
+	return c.do(ctx, "index", name, fn)
 }
 
 func (c *command) UpdateByScript(ctx context.Context, client *elastic.Client, name string, id int, script string, params map[string]interface{}) (*Result, error) {
-	fn := func(rch chan *Result) {
+	fn := func(ctx context.Context) (interface{}, error) {
 		script := elastic.NewScript(script).Params(params).Lang("painless")
 
 		res, err := client.Update().
 			Pretty(c.Env.IsDebug()).Index(name).Id(strconv.Itoa(id)).
 			Script(script).Do(ctx)
-		rch <- &Result{Res: res, Err: err}
+		return res, err
 	}
 
-	return c.do(ctx, fn)
+	return c.do(ctx, "update", name, fn)
 }
 
 func (c *command) UpsertByScript(ctx context.Context, client *elastic.Client, name string, id int, script string, params, upsert map[string]interface{}) (*Result, error) {
-	fn := func(rch chan *Result) {
+	fn := func(ctx context.Context) (interface{}, error) {
 		script := elastic.NewScript(script).Params(params).Lang("painless")
 
 		res, err := client.Update().
 			Pretty(c.Env.IsDebug()).Index(name).Id(strconv.Itoa(id)).
 			Script(script).ScriptedUpsert(true).Upsert(upsert).Do(ctx)
-		rch <- &Result{Res: res, Err: err}
+		return res, err
 	}
 
-	return c.do(ctx, fn)
+	return c.do(ctx, "upsert", name, fn)
 }
 
 func (c *command) DeleteDocument(ctx context.Context, client *elastic.Client, name string, id int) (*Result, error) {
-	fn := func(rch chan *Result) {
+	fn := func(ctx context.Context) (interface{}, error) {
 		res, err := client.Delete().
 			Pretty(c.Env.IsDebug()).
 			Index(name).Id(strconv.Itoa(id)).Do(ctx)
-		rch <- &Result{Res: res, Err: err}
+		return res, err
 	}
 
-	return c.do(ctx, fn)
+	return c.do(ctx, "delete", name, fn)
 }
 
-func (c *command) ListIndexNames(_ context.Context, client *elastic.Client) ([]string, error) {
-	return client.IndexNames()
+func (c *command) ListIndexNames(ctx context.Context, client *elastic.Client) ([]string, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := client.IndexGetSettings().
+			Pretty(c.Env.IsDebug()).Index("_all").Do(ctx)
+		return res, err
+	}
+
+	cr, err := c.do(ctx, "list_indices", "_all", fn)
+	if err != nil {
+		return nil, err
+	}
+
+	res, _ := cr.Res.(map[string]*elastic.IndicesGetSettingsResponse)
+	names := make([]string, 0, len(res))
+	for name := range res {
+		names = append(names, name)
+	}
+	return names, nil
 }
 
 func (c *command) CreateIndex(ctx context.Context, client *elastic.Client, name string, index string) (*Result, error) {
-	fn := func(rch chan *Result) {
+	fn := func(ctx context.Context) (interface{}, error) {
 		res, err := client.CreateIndex(name).
 			Pretty(c.Env.IsDebug()).Body(index).Do(ctx)
-		rch <- &Result{Res: res, Err: err}
+		return res, err
 	}
 
-	return c.do(ctx, fn)
+	return c.do(ctx, "create_index", name, fn)
 }
 
 func (c *command) DeleteIndex(ctx context.Context, client *elastic.Client, name string) (*Result, error) {
-	fn := func(rch chan *Result) {
+	fn := func(ctx context.Context) (interface{}, error) {
 		res, err := client.DeleteIndex(name).
 			Pretty(c.Env.IsDebug()).Do(ctx)
-		rch <- &Result{Res: res, Err: err}
+		return res, err
 	}
 
-	return c.do(ctx, fn)
+	return c.do(ctx, "delete_index", name, fn)
 }
 
 func (c *command) Aliases(ctx context.Context, client *elastic.Client, name string) (*Result, error) {
-	fn := func(rch chan *Result) {
+	fn := func(ctx context.Context) (interface{}, error) {
 		res, err := client.Aliases().
 			Pretty(c.Env.IsDebug()).Index(name).Do(ctx)
-		rch <- &Result{Res: res, Err: err}
+		return res, err
 	}
 
-	return c.do(ctx, fn)
+	return c.do(ctx, "aliases", name, fn)
 }
 
 func (c *command) PutAlias(ctx context.Context, client *elastic.Client, name, alias string) (*Result, error) {
-	fn := func(rch chan *Result) {
+	fn := func(ctx context.Context) (interface{}, error) {
 		res, err := client.Alias().
 			Pretty(c.Env.IsDebug()).Add(name, alias).Do(ctx)
-		rch <- &Result{Res: res, Err: err}
+		return res, err
 	}
 
-	return c.do(ctx, fn)
+	return c.do(ctx, "put_alias", alias, fn)
 }
 
 func (c *command) UpdateAliases(ctx context.Context, client *elastic.Client, name, oldIx, newIx string) (*Result, error) {
-	fn := func(rch chan *Result) {
+	fn := func(ctx context.Context) (interface{}, error) {
 		res, err := client.Alias().
 			Pretty(c.Env.IsDebug()).
 			Action(elastic.NewAliasRemoveAction(name).Index(oldIx)).
 			Action(elastic.NewAliasAddAction(name).Index(newIx)).
 			Do(ctx)
-		rch <- &Result{Res: res, Err: err}
+		return res, err
+	}
+
+	return c.do(ctx, "update_aliases", name, fn)
+}
+
+func (c *command) SwapAlias(ctx context.Context, client *elastic.Client, name, newIx string, oldIxs ...string) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		svc := client.Alias().Pretty(c.Env.IsDebug())
+		for _, ix := range oldIxs {
+			svc = svc.Action(elastic.NewAliasRemoveAction(name).Index(ix))
+		}
+		res, err := svc.Action(elastic.NewAliasAddAction(name).Index(newIx)).Do(ctx)
+		return res, err
+	}
+
+	return c.do(ctx, "update_aliases", name, fn)
+}
+
+func (c *command) PutSettings(ctx context.Context, client *elastic.Client, name string, body interface{}) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := client.IndexPutSettings(name).
+			Pretty(c.Env.IsDebug()).BodyJson(body).Do(ctx)
+		return res, err
+	}
+
+	return c.do(ctx, "put_settings", name, fn)
+}
+
+func (c *command) Refresh(ctx context.Context, client *elastic.Client, indices ...string) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := client.Refresh(indices...).
+			Pretty(c.Env.IsDebug()).Do(ctx)
+		return res, err
+	}
+
+	return c.do(ctx, "refresh", strings.Join(indices, ","), fn)
+}
+
+func (c *command) GetSettings(ctx context.Context, client *elastic.Client, name string) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := client.IndexGetSettings(name).
+			Pretty(c.Env.IsDebug()).Do(ctx)
+		return res, err
+	}
+
+	return c.do(ctx, "get_settings", name, fn)
+}
+
+func (c *command) GetMapping(ctx context.Context, client *elastic.Client, name string) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := client.GetMapping().
+			Pretty(c.Env.IsDebug()).Index(name).Do(ctx)
+		return res, err
+	}
+
+	return c.do(ctx, "get_mapping", name, fn)
+}
+
+func (c *command) PutMapping(ctx context.Context, client *elastic.Client, name string, body map[string]interface{}) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := client.PutMapping().
+			Pretty(c.Env.IsDebug()).Index(name).BodyJson(body).Do(ctx)
+		return res, err
+	}
+
+	return c.do(ctx, "put_mapping", name, fn)
+}
+
+func (c *command) PutComponentTemplate(ctx context.Context, client *elastic.Client, name, body string) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := client.IndexPutComponentTemplate(name).
+			Pretty(c.Env.IsDebug()).BodyString(body).Do(ctx)
+		return res, err
+	}
+
+	return c.do(ctx, "put_component_template", "", fn)
+}
+
+func (c *command) PutIndexTemplate(ctx context.Context, client *elastic.Client, name, body string) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := client.IndexPutIndexTemplate(name).
+			Pretty(c.Env.IsDebug()).BodyString(body).Do(ctx)
+		return res, err
+	}
+
+	return c.do(ctx, "put_index_template", "", fn)
+}
+
+func (c *command) Health(ctx context.Context, client *elastic.Client, indices ...string) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := client.ClusterHealth().
+			Pretty(c.Env.IsDebug()).Index(indices...).Level("indices").Do(ctx)
+		return res, err
+	}
+
+	index := strings.Join(indices, ",")
+	if index == "" {
+		index = "_all"
+	}
+	return c.do(ctx, "health", index, fn)
+}
+
+func (c *command) Stats(ctx context.Context, client *elastic.Client, indices ...string) (*Result, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		res, err := client.IndexStats(indices...).
+			Pretty(c.Env.IsDebug()).Metric("docs", "store").Do(ctx)
+		return res, err
+	}
+
+	return c.do(ctx, "stats", strings.Join(indices, ","), fn)
+}
+
+func (c *command) Count(ctx context.Context, client *elastic.Client, name string, query elastic.Query) (int64, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		svc := client.Count(name).Pretty(c.Env.IsDebug())
+		if query != nil {
+			svc = svc.Query(query)
+		}
+		res, err := svc.Do(ctx)
+		return res, err
+	}
+
+	cr, err := c.do(ctx, "count", name, fn)
+	if err != nil {
+		return 0, err
+	}
+
+	count, _ := cr.Res.(int64)
+	return count, nil
+}
+
+// DeleteByQuery submits delete_by_query as a task, nil query deletes all of documents.
+func (c *command) DeleteByQuery(ctx context.Context, client *elastic.Client, name string, query elastic.Query, opts ByQueryOptions) (*Task, error) {
+	if query == nil {
+		query = elastic.NewMatchAllQuery()
+	}
+
+	fn := func(ctx context.Context) (interface{}, error) {
+		svc := client.DeleteByQuery(name).
+			Pretty(c.Env.IsDebug()).Query(query).
+			RequestsPerSecond(throttle(opts.RequestsPerSecond)).
+			Slices(opts.slices()).Refresh(opts.refresh())
+		if opts.ScrollSize > 0 {
+			svc = svc.ScrollSize(opts.ScrollSize)
+		}
+		if opts.Proceed {
+			svc = svc.ProceedOnVersionConflict()
+		}
+		res, err := svc.DoAsync(ctx)
+		return res, err
+	}
+
+	cr, err := c.do(ctx, "delete_by_query", name, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	res, _ := cr.Res.(*elastic.StartTaskResult)
+	return c.newTask(client, "_delete_by_query", res.TaskId), nil
+}
+
+// UpdateByQuery submits update_by_query as a task, nil script reindexes documents in place
+// which picks up new mappings.
+func (c *command) UpdateByQuery(ctx context.Context, client *elastic.Client, name string, query elastic.Query, script *elastic.Script, opts ByQueryOptions) (*Task, error) {
+	fn := func(ctx context.Context) (interface{}, error) {
+		svc := client.UpdateByQuery(name).
+			Pretty(c.Env.IsDebug()).
+			RequestsPerSecond(throttle(opts.RequestsPerSecond)).
+			Slices(opts.slices()).Refresh(opts.refresh())
+		if query != nil {
+			svc = svc.Query(query)
+		}
+		if script != nil {
+			svc = svc.Script(script)
+		}
+		if opts.ScrollSize > 0 {
+			svc = svc.ScrollSize(opts.ScrollSize)
+		}
+		if opts.Proceed {
+			svc = svc.ProceedOnVersionConflict()
+		}
+		res, err := svc.DoAsync(ctx)
+		return res, err
+	}
+
+	cr, err := c.do(ctx, "update_by_query", name, fn)
+	if err != nil {
+		return nil, err
 	}
 
-	return c.do(ctx, fn)
+	res, _ := cr.Res.(*elastic.StartTaskResult)
+	return c.newTask(client, "_update_by_query", res.TaskId), nil
 }
 
-func newCommand(env util.Environment) Command {
+func newCommand(env util.Environment, tracer *Tracer) Command {
 	r := &command{
-		Env: env,
+		Env:    env,
+		Tracer: tracer,
 	}
 
 	return r
@@ -0,0 +1,56 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRestoreIndexName(t *testing.T) {
+	t.Helper()
+
+	cases := map[string]string{
+		"user_profiles_1700000000":          "user_profiles",
+		"user_profiles_1700000000123":       "user_profiles",
+		"user_profiles_1700000000123456789": "user_profiles",
+		"companies_1700000000123456":        "companies",
+		"user_profiles":                     "user_profiles",
+		"user_profiles_2024":                "user_profiles_2024",
+		"user_profiles_0700000000":          "user_profiles_0700000000",
+		"_1700000000":                       "_1700000000",
+		"companies":                         "companies",
+	}
+	for name, want := range cases {
+		if got := RestoreIndexName(name); got != want {
+			t.Errorf("restore index name %s = %s, want %s", name, got, want)
+		}
+	}
+
+	if got := RestoreIndexName(MakeIndexName("user_profiles")); got != "user_profiles" {
+		t.Errorf("restore index name must restore made name: %s", got)
+	}
+
+	_, ts, ok := ParseIndexName("user_profiles_1700000000123")
+	if !ok || !ts.Equal(time.UnixMilli(1700000000123)) {
+		t.Errorf("parse index name created error: %s", ts)
+	}
+}
+
+func TestIndexGenerations(t *testing.T) {
+	t.Helper()
+
+	names := []string{
+		"user_profiles_1700000000", "user_profiles_1700000100000000000", "user_1700000200",
+		"user_profiles", "user_profiles_tmp", "user_profiles_1699999999000",
+	}
+
+	var got []string
+	for _, g := range IndexGenerations("user_profiles", names) {
+		got = append(got, g.Name)
+	}
+
+	want := []string{"user_profiles_1700000100000000000", "user_profiles_1700000000", "user_profiles_1699999999000"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("index generations error: %#+v", got)
+	}
+}
@@ -0,0 +1,226 @@
+package searchtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+)
+
+type (
+	// Exchange is a recorded request and response.
+	Exchange struct {
+		Method   string `json:"method"`
+		Path     string `json:"path"`
+		Query    string `json:"query,omitempty"`
+		Body     string `json:"body,omitempty"`
+		Status   int    `json:"status"`
+		Response string `json:"response,omitempty"`
+	}
+
+	// Recorder is a reverse proxy which records exchanges with a real cluster into fixtures.
+	//
+	//	rec := searchtest.NewRecorder(t, "http://localhost:9200")
+	//	client := rec.Client()
+	//	...
+	//	rec.Save("testdata/companies.json")
+	Recorder struct {
+		*httptest.Server
+
+		mu        sync.Mutex
+		exchanges []Exchange
+	}
+
+	// Replayer responds recorded exchanges in order of the fixtures, a request must match
+	// a method, a path and a body of a next exchange.
+	Replayer struct {
+		*httptest.Server
+
+		t         testing.TB
+		mu        sync.Mutex
+		exchanges []Exchange
+		pos       int
+	}
+)
+
+// SaveFixture writes exchanges into a json file, parent directories are created.
+func SaveFixture(path string, exchanges []Exchange) error {
+	b, err := json.MarshalIndent(exchanges, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("failed to marshal fixture: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return xerrors.Errorf("failed to make fixture dir <%s>: %w", path, err)
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0o600); err != nil {
+		return xerrors.Errorf("failed to write fixture <%s>: %w", path, err)
+	}
+	return nil
+}
+
+// LoadFixture reads exchanges from a json file.
+func LoadFixture(path string) ([]Exchange, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read fixture <%s>: %w", path, err)
+	}
+
+	var exchanges []Exchange
+	if err := json.Unmarshal(b, &exchanges); err != nil {
+		return nil, xerrors.Errorf("failed to parse fixture <%s>: %w", path, err)
+	}
+	return exchanges, nil
+}
+
+// NewRecorder starts a proxy to target which is closed at the end of the test.
+func NewRecorder(t testing.TB, target string) *Recorder {
+	t.Helper()
+
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatalf("searchtest: invalid target <%s>: %s", target, err)
+	}
+
+	r := &Recorder{}
+	proxy := httputil.NewSingleHostReverseProxy(u)
+
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		// fixtures must be plain text
+		req.Header.Del("Accept-Encoding")
+
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+
+		r.mu.Lock()
+		r.exchanges = append(r.exchanges, Exchange{
+			Method:   req.Method,
+			Path:     req.URL.Path,
+			Query:    req.URL.RawQuery,
+			Body:     string(body),
+			Status:   rec.Code,
+			Response: rec.Body.String(),
+		})
+		r.mu.Unlock()
+
+		for k, vs := range rec.Header() {
+			w.Header()[k] = vs
+		}
+		w.WriteHeader(rec.Code)
+		_, _ = w.Write(rec.Body.Bytes())
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// Client returns a client which connects to the recorder without sniffing.
+func (r *Recorder) Client() *elastic.Client {
+	return newClient(r.URL)
+}
+
+// Exchanges returns recorded exchanges in order.
+func (r *Recorder) Exchanges() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Exchange(nil), r.exchanges...)
+}
+
+// Save writes recorded exchanges into a fixture.
+func (r *Recorder) Save(path string) error {
+	return SaveFixture(path, r.Exchanges())
+}
+
+// NewReplayer starts a server which responds exchanges, the test fails when a request
+// doesn't match or exchanges are left at the end of the test.
+func NewReplayer(t testing.TB, exchanges []Exchange) *Replayer {
+	t.Helper()
+
+	r := &Replayer{t: t, exchanges: exchanges}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(func() {
+		r.Close()
+		if n := r.Remaining(); n > 0 {
+			t.Errorf("searchtest: %d exchanges weren't requested", n)
+		}
+	})
+	return r
+}
+
+// NewFixtureReplayer starts a Replayer by a fixture file.
+func NewFixtureReplayer(t testing.TB, path string) *Replayer {
+	t.Helper()
+
+	exchanges, err := LoadFixture(path)
+	if err != nil {
+		t.Fatalf("searchtest: %s", err)
+	}
+	return NewReplayer(t, exchanges)
+}
+
+// Client returns a client which connects to the replayer without sniffing.
+func (r *Replayer) Client() *elastic.Client {
+	return newClient(r.URL)
+}
+
+// Remaining returns a number of exchanges which haven't been requested.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.exchanges) - r.pos
+}
+
+func (r *Replayer) serve(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	var ex *Exchange
+	if r.pos < len(r.exchanges) {
+		ex = &r.exchanges[r.pos]
+	}
+	ok := ex != nil && ex.Method == req.Method && ex.Path == req.URL.Path && sameBody(ex.Body, string(body))
+	if ok {
+		r.pos++
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		r.t.Errorf("searchtest: unexpected request %s %s %s, want %+v", req.Method, req.URL.Path, body, ex)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = io.WriteString(w, `{"error":{"type":"searchtest_exception","reason":"unexpected request"},"status":501}`)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(ex.Status)
+	if req.Method != http.MethodHead {
+		_, _ = io.WriteString(w, ex.Response)
+	}
+}
+
+// sameBody compares json bodies semantically, ndjson and others are compared as they are.
+func sameBody(want, got string) bool {
+	if strings.TrimSpace(want) == strings.TrimSpace(got) {
+		return true
+	}
+
+	var w, g interface{}
+	if json.Unmarshal([]byte(want), &w) != nil || json.Unmarshal([]byte(got), &g) != nil {
+		return false
+	}
+	wb, _ := json.Marshal(w)
+	gb, _ := json.Marshal(g)
+	return bytes.Equal(wb, gb)
+}
@@ -0,0 +1,535 @@
+package searchtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type (
+	searchRequest struct {
+		Query        map[string]interface{}            `json:"query"`
+		From         int                               `json:"from"`
+		Size         *int                              `json:"size"`
+		Sort         []interface{}                     `json:"sort"`
+		Aggregations map[string]map[string]interface{} `json:"aggregations"`
+		Aggs         map[string]map[string]interface{} `json:"aggs"`
+	}
+
+	hit struct {
+		index string
+		id    string
+		doc   *document
+		sort  []interface{}
+	}
+)
+
+// search runs a query on indices, it returns a count response when count is true.
+func (s *Server) search(name string, body []byte, count bool) (int, interface{}, *esError) {
+	ixs, err := s.resolve(name)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req := searchRequest{}
+	if len(body) > 0 {
+		if e := json.Unmarshal(body, &req); e != nil {
+			return 0, nil, parseError(e)
+		}
+	}
+
+	var hits []*hit
+	for _, ix := range ixs {
+		for _, id := range ix.ids {
+			doc := ix.docs[id]
+			ok, e := matches(req.Query, id, doc.source)
+			if e != nil {
+				return 0, nil, e
+			}
+			if ok {
+				hits = append(hits, &hit{index: ix.name, id: id, doc: doc})
+			}
+		}
+	}
+
+	if count {
+		return http.StatusOK, map[string]interface{}{"count": len(hits), "_shards": shards()["_shards"]}, nil
+	}
+
+	if e := sortHits(hits, req.Sort); e != nil {
+		return 0, nil, e
+	}
+
+	size := 10
+	if req.Size != nil {
+		size = *req.Size
+	}
+	from := min(max(req.From, 0), len(hits))
+	to := min(from+max(size, 0), len(hits))
+
+	page := make([]interface{}, 0, to-from)
+	for _, h := range hits[from:to] {
+		v := map[string]interface{}{"_index": h.index, "_id": h.id, "_score": 1.0, "_source": h.doc.source}
+		if len(req.Sort) > 0 {
+			v["sort"] = h.sort
+		}
+		page = append(page, v)
+	}
+
+	res := map[string]interface{}{
+		"took":      1,
+		"timed_out": false,
+		"_shards":   shards()["_shards"],
+		"hits": map[string]interface{}{
+			"total":     map[string]interface{}{"value": len(hits), "relation": "eq"},
+			"max_score": 1.0,
+			"hits":      page,
+		},
+	}
+
+	if req.Aggregations == nil {
+		req.Aggregations = req.Aggs
+	}
+	if len(req.Aggregations) > 0 {
+		aggs, e := aggregate(req.Aggregations, hits)
+		if e != nil {
+			return 0, nil, e
+		}
+		res["aggregations"] = aggs
+	}
+
+	return http.StatusOK, res, nil
+}
+
+// matches evaluates a query against a document, nil query matches all.
+func matches(query map[string]interface{}, id string, source map[string]interface{}) (bool, *esError) {
+	if len(query) == 0 {
+		return true, nil
+	}
+	if len(query) != 1 {
+		return false, queryError("query must have one clause: %v", keys(query))
+	}
+
+	for typ, v := range query {
+		body, _ := v.(map[string]interface{})
+		switch typ {
+		case "match_all":
+			return true, nil
+		case "match_none":
+			return false, nil
+		case "bool":
+			return matchBool(body, id, source)
+		case "ids":
+			for _, want := range list(body["values"]) {
+				if fmt.Sprint(want) == id {
+					return true, nil
+				}
+			}
+			return false, nil
+		case "exists":
+			return len(values(source, fmt.Sprint(body["field"]))) > 0, nil
+		case "term", "terms", "prefix", "range", "match", "match_phrase":
+			field, param, err := fieldParam(typ, body)
+			if err != nil {
+				return false, err
+			}
+			return matchField(typ, values(source, field), param)
+		case "multi_match":
+			return matchMulti(body, source), nil
+		default:
+			return false, queryError("searchtest doesn't support [%s] query", typ)
+		}
+	}
+	return false, nil
+}
+
+func matchBool(body map[string]interface{}, id string, source map[string]interface{}) (bool, *esError) {
+	clauses := func(k string) []map[string]interface{} {
+		var qs []map[string]interface{}
+		for _, v := range list(body[k]) {
+			if q, ok := v.(map[string]interface{}); ok {
+				qs = append(qs, q)
+			}
+		}
+		return qs
+	}
+
+	for _, k := range []string{"must", "filter"} {
+		for _, q := range clauses(k) {
+			ok, err := matches(q, id, source)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+	for _, q := range clauses("must_not") {
+		ok, err := matches(q, id, source)
+		if err != nil || ok {
+			return false, err
+		}
+	}
+
+	should := clauses("should")
+	least := 0
+	if len(should) > 0 && len(clauses("must"))+len(clauses("filter")) == 0 {
+		least = 1
+	}
+	if v, ok := body["minimum_should_match"].(float64); ok {
+		least = int(v)
+	}
+
+	matched := 0
+	for _, q := range should {
+		ok, err := matches(q, id, source)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			matched++
+		}
+	}
+	return matched >= least, nil
+}
+
+// fieldParam splits {"field": param} of term level and match queries.
+func fieldParam(typ string, body map[string]interface{}) (string, interface{}, *esError) {
+	for k, v := range body {
+		if k == "boost" || k == "_name" {
+			continue
+		}
+		return k, v, nil
+	}
+	return "", nil, queryError("[%s] query doesn't have a field", typ)
+}
+
+func matchField(typ string, vals []interface{}, param interface{}) (bool, *esError) {
+	obj, _ := param.(map[string]interface{})
+
+	switch typ {
+	case "term":
+		if obj != nil {
+			param = obj["value"]
+		}
+		return contains(vals, param), nil
+	case "terms":
+		for _, want := range list(param) {
+			if contains(vals, want) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "prefix":
+		if obj != nil {
+			param = obj["value"]
+		}
+		for _, v := range vals {
+			if strings.HasPrefix(fmt.Sprint(v), fmt.Sprint(param)) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "range":
+		for _, v := range vals {
+			if inRange(v, obj) {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		op := "or"
+		if obj != nil {
+			param = obj["query"]
+			if v, ok := obj["operator"].(string); ok {
+				op = strings.ToLower(v)
+			}
+		}
+		text := strings.ToLower(fmt.Sprint(param))
+		if typ == "match_phrase" {
+			return anyText(vals, func(s string) bool { return strings.Contains(s, text) }), nil
+		}
+		return matchTokens(strings.Fields(text), op, func(token string) bool {
+			return anyText(vals, func(s string) bool { return strings.Contains(s, token) })
+		}), nil
+	}
+}
+
+// matchMulti matches every or any token across fields, boost like name^2 is ignored.
+func matchMulti(body map[string]interface{}, source map[string]interface{}) bool {
+	op := "or"
+	if v, ok := body["operator"].(string); ok {
+		op = strings.ToLower(v)
+	}
+
+	var vals []interface{}
+	for _, f := range list(body["fields"]) {
+		field, _, _ := strings.Cut(fmt.Sprint(f), "^")
+		vals = append(vals, values(source, field)...)
+	}
+
+	text := strings.ToLower(fmt.Sprint(body["query"]))
+	return matchTokens(strings.Fields(text), op, func(token string) bool {
+		return anyText(vals, func(s string) bool { return strings.Contains(s, token) })
+	})
+}
+
+func matchTokens(tokens []string, op string, fn func(string) bool) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	for _, token := range tokens {
+		ok := fn(token)
+		if op == "and" && !ok {
+			return false
+		}
+		if op != "and" && ok {
+			return true
+		}
+	}
+	return op == "and"
+}
+
+func anyText(vals []interface{}, fn func(string) bool) bool {
+	for _, v := range vals {
+		if fn(strings.ToLower(fmt.Sprint(v))) {
+			return true
+		}
+	}
+	return false
+}
+
+// inRange checks gte, gt, lte and lt, or from and to with include_lower and include_upper.
+func inRange(v interface{}, bounds map[string]interface{}) bool {
+	check := func(bound interface{}, ok func(int) bool) bool {
+		if bound == nil {
+			return true
+		}
+		c, comparable := compare(v, bound)
+		return comparable && ok(c)
+	}
+
+	lower, upper := bounds["include_lower"] != false, bounds["include_upper"] != false
+	return check(bounds["gte"], func(c int) bool { return c >= 0 }) &&
+		check(bounds["gt"], func(c int) bool { return c > 0 }) &&
+		check(bounds["lte"], func(c int) bool { return c <= 0 }) &&
+		check(bounds["lt"], func(c int) bool { return c < 0 }) &&
+		check(bounds["from"], func(c int) bool { return c > 0 || (lower && c == 0) }) &&
+		check(bounds["to"], func(c int) bool { return c < 0 || (upper && c == 0) })
+}
+
+// compare compares numbers as float64, otherwise strings.
+func compare(a, b interface{}) (int, bool) {
+	fa, okA := a.(float64)
+	fb, okB := b.(float64)
+	if okA && okB {
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+	if okA != okB {
+		return 0, false
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)), true
+}
+
+func contains(vals []interface{}, want interface{}) bool {
+	for _, v := range vals {
+		if c, ok := compare(v, want); ok && c == 0 {
+			return true
+		}
+		if fmt.Sprint(v) == fmt.Sprint(want) {
+			return true
+		}
+	}
+	return false
+}
+
+// values returns flattened values of a dotted field, a .keyword sub field is its parent.
+func values(source map[string]interface{}, field string) []interface{} {
+	field = strings.TrimSuffix(field, ".keyword")
+
+	cur := []interface{}{source}
+	for _, key := range strings.Split(field, ".") {
+		var next []interface{}
+		for _, c := range cur {
+			for _, v := range list(c) {
+				if m, ok := v.(map[string]interface{}); ok {
+					if fv, ok := m[key]; ok && fv != nil {
+						next = append(next, fv)
+					}
+				}
+			}
+		}
+		cur = next
+	}
+
+	var out []interface{}
+	for _, c := range cur {
+		out = append(out, list(c)...)
+	}
+	return out
+}
+
+func sortHits(hits []*hit, sorts []interface{}) *esError {
+	type key struct {
+		field string
+		desc  bool
+	}
+
+	var ks []key
+	for _, s := range sorts {
+		switch v := s.(type) {
+		case string:
+			ks = append(ks, key{field: v, desc: v == "_score"})
+		case map[string]interface{}:
+			for field, opt := range v {
+				desc := false
+				switch o := opt.(type) {
+				case string:
+					desc = o == "desc"
+				case map[string]interface{}:
+					desc = o["order"] == "desc"
+				}
+				ks = append(ks, key{field: field, desc: desc})
+			}
+		default:
+			return queryError("invalid sort: %v", s)
+		}
+	}
+
+	for _, h := range hits {
+		h.sort = make([]interface{}, len(ks))
+		for i, k := range ks {
+			switch k.field {
+			case "_score":
+				h.sort[i] = 1.0
+			case "_id":
+				h.sort[i] = h.id
+			case "_doc", "_shard_doc":
+				h.sort[i] = h.doc.seqNo
+			default:
+				if vs := values(h.doc.source, k.field); len(vs) > 0 {
+					h.sort[i] = vs[0]
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		for n, k := range ks {
+			a, b := hits[i].sort[n], hits[j].sort[n]
+			if a == nil || b == nil {
+				// missing values are last
+				if (a == nil) != (b == nil) {
+					return b == nil
+				}
+				continue
+			}
+			c, _ := compare(a, b)
+			if c == 0 {
+				continue
+			}
+			if k.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return nil
+}
+
+// aggregate computes terms aggregations.
+func aggregate(aggs map[string]map[string]interface{}, hits []*hit) (map[string]interface{}, *esError) {
+	res := map[string]interface{}{}
+	for name, agg := range aggs {
+		terms, ok := agg["terms"].(map[string]interface{})
+		if !ok {
+			return nil, queryError("searchtest doesn't support aggregation [%s]: %v", name, keys(agg))
+		}
+
+		size := 10
+		if v, ok := terms["size"].(float64); ok {
+			size = int(v)
+		}
+
+		type bucket struct {
+			key   interface{}
+			count int
+		}
+		var buckets []*bucket
+		seen := map[string]*bucket{}
+		for _, h := range hits {
+			counted := map[string]bool{}
+			for _, v := range values(h.doc.source, fmt.Sprint(terms["field"])) {
+				k := fmt.Sprint(v)
+				if counted[k] {
+					continue
+				}
+				counted[k] = true
+				b, ok := seen[k]
+				if !ok {
+					b = &bucket{key: v}
+					seen[k] = b
+					buckets = append(buckets, b)
+				}
+				b.count++
+			}
+		}
+
+		sort.SliceStable(buckets, func(i, j int) bool {
+			if buckets[i].count != buckets[j].count {
+				return buckets[i].count > buckets[j].count
+			}
+			return fmt.Sprint(buckets[i].key) < fmt.Sprint(buckets[j].key)
+		})
+
+		other := 0
+		if len(buckets) > size {
+			for _, b := range buckets[size:] {
+				other += b.count
+			}
+			buckets = buckets[:size]
+		}
+
+		out := make([]interface{}, 0, len(buckets))
+		for _, b := range buckets {
+			out = append(out, map[string]interface{}{"key": b.key, "doc_count": b.count})
+		}
+		res[name] = map[string]interface{}{
+			"doc_count_error_upper_bound": 0,
+			"sum_other_doc_count":         other,
+			"buckets":                     out,
+		}
+	}
+	return res, nil
+}
+
+func list(v interface{}) []interface{} {
+	switch vs := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return vs
+	default:
+		return []interface{}{vs}
+	}
+}
+
+func keys(m map[string]interface{}) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+func queryError(format string, args ...interface{}) *esError {
+	return &esError{http.StatusBadRequest, "parsing_exception", fmt.Sprintf(format, args...), ""}
+}
@@ -0,0 +1,1116 @@
+// Package searchtest provides an in-process elasticsearch for tests of search.Command.
+//
+// Server speaks enough of the REST API for unit tests, documents are searchable
+// immediately without refresh.
+//
+//	srv := searchtest.NewServer(t)
+//	client := srv.Client()
+//	cmd.CreateIndex(ctx, client, "companies_1700000000000000000", body)
+//	cmd.PostDocument(ctx, client, "companies", 1, `{"name":"eiicon"}`)
+//	res, err := cmd.Search(ctx, client.Search("companies").Query(elastic.NewMatchQuery("name", "eiicon")))
+//
+// Supported endpoints are index create/delete/exists/settings/mapping/refresh, _doc, _create, _update
+// with doc, _mget, _bulk, _search, _count, _delete_by_query, _update_by_query without scripts,
+// _tasks, _alias, _aliases, _stats, _cat/indices, _cluster/health, PUT _component_template,
+// PUT _index_template and GET /.
+// Supported queries are match_all, match_none, match, multi_match, term, terms, ids, range,
+// exists, prefix and bool, aggregations are terms only.
+package searchtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// Version is a version number which the server reports.
+const Version = "7.17.9"
+
+type (
+	// Server is a fake elasticsearch on httptest.Server.
+	Server struct {
+		*httptest.Server
+
+		mu        sync.Mutex
+		indices   map[string]*index
+		exchanges []Exchange
+		seq       int
+		tasks     map[string]*task
+		holdTasks bool
+		templates map[string]map[string]interface{}
+	}
+
+	index struct {
+		name     string
+		health   string
+		created  time.Time
+		settings map[string]interface{}
+		mappings map[string]interface{}
+		aliases  map[string]bool
+		docs     map[string]*document
+		ids      []string
+	}
+
+	document struct {
+		source  map[string]interface{}
+		version int64
+		seqNo   int64
+	}
+
+	// esError is returned as {"error":{...},"status":...}
+	esError struct {
+		status int
+		typ    string
+		reason string
+		index  string
+	}
+)
+
+// NewServer starts a fake elasticsearch which is closed at the end of the test.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{indices: map[string]*index{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Client returns a client which connects to the server without sniffing.
+func (s *Server) Client() *elastic.Client {
+	return newClient(s.URL)
+}
+
+// DSN returns an es dsn of the server for util.SelectESConn.
+func (s *Server) DSN() string {
+	return "es://" + strings.TrimPrefix(s.URL, "http://") + "/?sniff=false&healthcheck=false"
+}
+
+// Indices returns index names in order.
+func (s *Server) Indices() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.indices))
+	for name := range s.indices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Source returns a document source, nil when it doesn't exist.
+func (s *Server) Source(indexName, id string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ix, err := s.single(indexName)
+	if err != nil {
+		return nil
+	}
+	if doc, ok := ix.docs[id]; ok {
+		return doc.source
+	}
+	return nil
+}
+
+// SetHealth changes a health status of an index. e.g. red
+func (s *Server) SetHealth(indexName, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ix, ok := s.indices[indexName]; ok {
+		ix.health = status
+	}
+}
+
+// Template returns a template which was put, kind is "_component_template" or "_index_template".
+// nil is returned when it doesn't exist.
+func (s *Server) Template(kind, name string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.templates[kind+"/"+name]
+}
+
+// Exchanges returns recorded requests and responses in order.
+func (s *Server) Exchanges() []Exchange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Exchange(nil), s.exchanges...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	status, res := s.route(r, body)
+
+	var out []byte
+	if res != nil {
+		out, _ = json.Marshal(res)
+	}
+
+	s.exchanges = append(s.exchanges, Exchange{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Query:    r.URL.RawQuery,
+		Body:     string(body),
+		Status:   status,
+		Response: string(out),
+	})
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(out)
+	}
+}
+
+// route dispatches a request by path segments, it's called with a lock.
+func (s *Server) route(r *http.Request, body []byte) (int, interface{}) {
+	segs := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if segs[0] == "" {
+		segs = nil
+	}
+	m := r.Method
+
+	var (
+		status int
+		res    interface{}
+		err    *esError
+	)
+
+	switch {
+	case len(segs) == 0 && (m == http.MethodGet || m == http.MethodHead):
+		status, res = http.StatusOK, s.info()
+	case len(segs) == 1 && segs[0] == "_bulk":
+		status, res, err = s.bulk("", body)
+	case len(segs) == 1 && segs[0] == "_mget":
+		status, res, err = s.mget("", body)
+	case len(segs) == 1 && segs[0] == "_aliases" && m == http.MethodPost:
+		status, res, err = s.updateAliases(body)
+	case len(segs) >= 1 && segs[0] == "_alias":
+		status, res, err = s.getAliases("", segs[1:])
+	case len(segs) >= 2 && segs[0] == "_cat" && segs[1] == "indices":
+		status, res, err = s.catIndices(segs[2:])
+	case len(segs) == 1 && (segs[0] == "_search" || segs[0] == "_count"):
+		status, res, err = s.search("_all", body, segs[0] == "_count")
+	case len(segs) >= 2 && segs[0] == "_cluster" && segs[1] == "health":
+		status, res, err = s.clusterHealth(segs[2:])
+	case len(segs) >= 1 && segs[0] == "_stats":
+		status, res, err = s.stats("_all")
+	case len(segs) == 2 && segs[0] == "_tasks" && m == http.MethodGet:
+		status, res, err = s.getTask(segs[1])
+	case len(segs) == 3 && segs[0] == "_tasks" && segs[2] == "_cancel":
+		status, res, err = s.cancelTask(segs[1])
+	case len(segs) == 3 && (segs[0] == "_delete_by_query" || segs[0] == "_update_by_query") && segs[2] == "_rethrottle":
+		status, res, err = s.rethrottleTask(segs[1], r.URL.Query())
+	case len(segs) == 2 && (segs[0] == "_component_template" || segs[0] == "_index_template") && m == http.MethodPut:
+		status, res, err = s.putTemplate(segs[0], segs[1], body)
+	case len(segs) == 1 && segs[0] == "_refresh":
+		status, res = http.StatusOK, shards()
+	case len(segs) == 1 && strings.HasPrefix(segs[0], "_") && segs[0] != "_all":
+		err = unsupported(r)
+
+	case len(segs) == 1:
+		switch m {
+		case http.MethodPut:
+			status, res, err = s.createIndex(segs[0], body)
+		case http.MethodDelete:
+			status, res, err = s.deleteIndex(segs[0])
+		case http.MethodHead:
+			status = http.StatusOK
+			if _, e := s.resolve(segs[0]); e != nil {
+				status = http.StatusNotFound
+			}
+		default:
+			err = unsupported(r)
+		}
+
+	case len(segs) >= 2:
+		name, op := segs[0], segs[1]
+		switch {
+		case op == "_doc" || op == "_create":
+			id := ""
+			if len(segs) > 2 {
+				id = segs[2]
+			}
+			status, res, err = s.doc(m, name, op, id, body)
+		case op == "_update" && len(segs) == 3:
+			status, res, err = s.update(name, segs[2], body)
+		case op == "_bulk":
+			status, res, err = s.bulk(name, body)
+		case op == "_mget":
+			status, res, err = s.mget(name, body)
+		case op == "_search" || op == "_count":
+			status, res, err = s.search(name, body, op == "_count")
+		case op == "_alias" || op == "_aliases":
+			if m == http.MethodPut || m == http.MethodPost {
+				if len(segs) != 3 {
+					err = unsupported(r)
+					break
+				}
+				status, res, err = s.putAlias(name, segs[2])
+				break
+			}
+			status, res, err = s.getAliases(name, segs[2:])
+		case op == "_stats":
+			status, res, err = s.stats(name)
+		case (op == "_delete_by_query" || op == "_update_by_query") && m == http.MethodPost:
+			status, res, err = s.byQuery(name, op, r.URL.Query(), body)
+		case op == "_settings":
+			status, res, err = s.settings(m, name, body)
+		case op == "_refresh" || op == "_flush":
+			if _, err = s.resolve(name); err == nil {
+				status, res = http.StatusOK, shards()
+			}
+		case op == "_mapping" && m == http.MethodGet:
+			status, res, err = s.getMapping(name)
+		case op == "_mapping" && (m == http.MethodPut || m == http.MethodPost):
+			status, res, err = s.putMapping(name, body)
+		default:
+			err = unsupported(r)
+		}
+
+	default:
+		err = unsupported(r)
+	}
+
+	if err != nil {
+		return err.status, err.body()
+	}
+	return status, res
+}
+
+func (s *Server) info() map[string]interface{} {
+	return map[string]interface{}{
+		"name":         "searchtest",
+		"cluster_name": "searchtest",
+		"version":      map[string]interface{}{"number": Version, "build_flavor": "default"},
+		"tagline":      "You Know, for Search",
+	}
+}
+
+func (s *Server) createIndex(name string, body []byte) (int, interface{}, *esError) {
+	if _, ok := s.indices[name]; ok {
+		return 0, nil, &esError{http.StatusBadRequest, "resource_already_exists_exception", fmt.Sprintf("index [%s] already exists", name), name}
+	}
+	if s.isAlias(name) {
+		return 0, nil, &esError{http.StatusBadRequest, "invalid_index_name_exception", fmt.Sprintf("Invalid index name [%s], already exists as alias", name), name}
+	}
+
+	var req struct {
+		Settings map[string]interface{}            `json:"settings"`
+		Mappings map[string]interface{}            `json:"mappings"`
+		Aliases  map[string]map[string]interface{} `json:"aliases"`
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return 0, nil, parseError(err)
+		}
+	}
+
+	ix := &index{
+		name:     name,
+		health:   "green",
+		created:  time.Now(),
+		settings: indexSettings(req.Settings),
+		mappings: req.Mappings,
+		aliases:  map[string]bool{},
+		docs:     map[string]*document{},
+	}
+	for alias := range req.Aliases {
+		ix.aliases[alias] = true
+	}
+	s.indices[name] = ix
+
+	return http.StatusOK, map[string]interface{}{"acknowledged": true, "shards_acknowledged": true, "index": name}, nil
+}
+
+func (s *Server) deleteIndex(name string) (int, interface{}, *esError) {
+	if s.isAlias(name) {
+		return 0, nil, &esError{http.StatusBadRequest, "illegal_argument_exception", fmt.Sprintf("The provided expression [%s] matches an alias, specify the corresponding concrete indices instead.", name), ""}
+	}
+
+	ixs, err := s.resolve(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, ix := range ixs {
+		delete(s.indices, ix.name)
+	}
+	return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+}
+
+func (s *Server) settings(method, name string, body []byte) (int, interface{}, *esError) {
+	ixs, err := s.resolve(name)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if method == http.MethodPut {
+		var req map[string]interface{}
+		if e := json.Unmarshal(body, &req); e != nil {
+			return 0, nil, parseError(e)
+		}
+		if static := staticSettings(indexSettings(req)["index"].(map[string]interface{}), ""); len(static) > 0 {
+			reason := fmt.Sprintf("Can't update non dynamic settings [[%s]] for open indices [%s]", strings.Join(static, ", "), name)
+			return 0, nil, &esError{http.StatusBadRequest, "illegal_argument_exception", reason, name}
+		}
+		for _, ix := range ixs {
+			if ix.settings == nil {
+				ix.settings = map[string]interface{}{}
+			}
+			merge(ix.settings, indexSettings(req))
+		}
+		return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+	}
+
+	res := map[string]interface{}{}
+	for _, ix := range ixs {
+		settings := map[string]interface{}{}
+		merge(settings, ix.settings)
+		if _, ok := settings["index"]; !ok {
+			settings["index"] = map[string]interface{}{}
+		}
+		settings["index"].(map[string]interface{})["creation_date"] = strconv.FormatInt(ix.created.UnixMilli(), 10)
+		res[ix.name] = map[string]interface{}{"settings": settings}
+	}
+	return http.StatusOK, res, nil
+}
+
+func (s *Server) getMapping(name string) (int, interface{}, *esError) {
+	ixs, err := s.resolve(name)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	res := map[string]interface{}{}
+	for _, ix := range ixs {
+		mappings := ix.mappings
+		if mappings == nil {
+			mappings = map[string]interface{}{}
+		}
+		res[ix.name] = map[string]interface{}{"mappings": mappings}
+	}
+	return http.StatusOK, res, nil
+}
+
+// putMapping merges new fields, changes of existing parameters aren't checked.
+// putTemplate handles PUT _component_template/{name} and PUT _index_template/{name},
+// an index template which is composed of missing component templates is rejected.
+func (s *Server) putTemplate(kind, name string, body []byte) (int, interface{}, *esError) {
+	var req map[string]interface{}
+	if e := json.Unmarshal(body, &req); e != nil {
+		return 0, nil, parseError(e)
+	}
+
+	composed, _ := req["composed_of"].([]interface{})
+	for _, c := range composed {
+		if _, ok := s.templates[fmt.Sprintf("_component_template/%v", c)]; !ok {
+			reason := fmt.Sprintf("index template [%s] specifies component templates [%v] that do not exist", name, c)
+			return 0, nil, &esError{http.StatusBadRequest, "invalid_index_template_exception", reason, ""}
+		}
+	}
+
+	if s.templates == nil {
+		s.templates = map[string]map[string]interface{}{}
+	}
+	s.templates[kind+"/"+name] = req
+	return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+}
+
+func (s *Server) putMapping(name string, body []byte) (int, interface{}, *esError) {
+	ixs, err := s.resolve(name)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var req map[string]interface{}
+	if e := json.Unmarshal(body, &req); e != nil {
+		return 0, nil, parseError(e)
+	}
+	for _, ix := range ixs {
+		if ix.mappings == nil {
+			ix.mappings = map[string]interface{}{}
+		}
+		merge(ix.mappings, req)
+	}
+	return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+}
+
+func (s *Server) doc(method, name, op, id string, body []byte) (int, interface{}, *esError) {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		ix, err := s.single(name)
+		if err != nil {
+			return 0, nil, err
+		}
+		doc, ok := ix.docs[id]
+		if !ok {
+			return http.StatusNotFound, map[string]interface{}{"_index": ix.name, "_id": id, "found": false}, nil
+		}
+		return http.StatusOK, map[string]interface{}{
+			"_index": ix.name, "_id": id, "_version": doc.version, "_seq_no": doc.seqNo,
+			"_primary_term": 1, "found": true, "_source": doc.source,
+		}, nil
+
+	case http.MethodPut, http.MethodPost:
+		var source map[string]interface{}
+		if err := json.Unmarshal(body, &source); err != nil {
+			return 0, nil, parseError(err)
+		}
+		return s.put(name, id, source, op == "_create")
+
+	case http.MethodDelete:
+		ix, err := s.single(name)
+		if err != nil {
+			return 0, nil, err
+		}
+		if _, ok := ix.docs[id]; !ok {
+			return http.StatusNotFound, s.result(ix, id, nil, "not_found"), nil
+		}
+		doc := ix.remove(id)
+		doc.version++
+		return http.StatusOK, s.result(ix, id, doc, "deleted"), nil
+	}
+
+	return 0, nil, &esError{http.StatusMethodNotAllowed, "illegal_argument_exception", "unsupported method " + method, name}
+}
+
+// put indexes a document, an index is created automatically like action.auto_create_index.
+func (s *Server) put(name, id string, source map[string]interface{}, create bool) (int, interface{}, *esError) {
+	ix, err := s.writeIndex(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	if id == "" {
+		s.seq++
+		id = fmt.Sprintf("searchtest%d", s.seq)
+	}
+
+	doc, ok := ix.docs[id]
+	if ok && create {
+		return 0, nil, &esError{http.StatusConflict, "version_conflict_engine_exception", fmt.Sprintf("[%s]: version conflict, document already exists", id), ix.name}
+	}
+	if !ok {
+		doc = &document{}
+		ix.docs[id] = doc
+		ix.ids = append(ix.ids, id)
+	}
+
+	s.seq++
+	doc.source, doc.seqNo = source, int64(s.seq)
+	doc.version++
+
+	if ok {
+		return http.StatusOK, s.result(ix, id, doc, "updated"), nil
+	}
+	return http.StatusCreated, s.result(ix, id, doc, "created"), nil
+}
+
+// update merges a partial doc, scripts aren't supported.
+func (s *Server) update(name, id string, body []byte) (int, interface{}, *esError) {
+	var req struct {
+		Doc         map[string]interface{} `json:"doc"`
+		Upsert      map[string]interface{} `json:"upsert"`
+		DocAsUpsert bool                   `json:"doc_as_upsert"`
+		Script      interface{}            `json:"script"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, nil, parseError(err)
+	}
+	if req.Script != nil {
+		return 0, nil, &esError{http.StatusBadRequest, "illegal_argument_exception", "searchtest doesn't support scripts", name}
+	}
+
+	ix, err := s.writeIndex(name)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	doc, ok := ix.docs[id]
+	if !ok {
+		switch {
+		case req.Upsert != nil:
+			return s.put(ix.name, id, req.Upsert, false)
+		case req.DocAsUpsert:
+			return s.put(ix.name, id, req.Doc, false)
+		}
+		return 0, nil, &esError{http.StatusNotFound, "document_missing_exception", fmt.Sprintf("[_doc][%s]: document missing", id), ix.name}
+	}
+
+	source := map[string]interface{}{}
+	merge(source, doc.source)
+	merge(source, req.Doc)
+	return s.put(ix.name, id, source, false)
+}
+
+func (s *Server) result(ix *index, id string, doc *document, result string) map[string]interface{} {
+	res := map[string]interface{}{
+		"_index": ix.name, "_id": id, "result": result, "_primary_term": 1,
+		"_shards": map[string]int{"total": 1, "successful": 1, "failed": 0},
+	}
+	if doc != nil {
+		res["_version"], res["_seq_no"] = doc.version, doc.seqNo
+	}
+	return res
+}
+
+func (s *Server) mget(name string, body []byte) (int, interface{}, *esError) {
+	var req struct {
+		Docs []struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		} `json:"docs"`
+		IDs []string `json:"ids"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, nil, parseError(err)
+	}
+	for _, id := range req.IDs {
+		req.Docs = append(req.Docs, struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}{name, id})
+	}
+
+	docs := make([]interface{}, 0, len(req.Docs))
+	for _, d := range req.Docs {
+		if d.Index == "" {
+			d.Index = name
+		}
+		ix, err := s.single(d.Index)
+		if err != nil {
+			docs = append(docs, map[string]interface{}{"_index": d.Index, "_id": d.ID, "error": err.body()["error"]})
+			continue
+		}
+		_, res, _ := s.doc(http.MethodGet, ix.name, "_doc", d.ID, nil)
+		docs = append(docs, res)
+	}
+
+	return http.StatusOK, map[string]interface{}{"docs": docs}, nil
+}
+
+func (s *Server) bulk(name string, body []byte) (int, interface{}, *esError) {
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	items := []interface{}{}
+	hasErrors := false
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var action map[string]struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			return 0, nil, &esError{http.StatusBadRequest, "illegal_argument_exception", "Malformed action/metadata line", name}
+		}
+
+		for op, meta := range action {
+			if meta.Index == "" {
+				meta.Index = name
+			}
+
+			var payload []byte
+			if op != "delete" {
+				if !sc.Scan() {
+					return 0, nil, &esError{http.StatusBadRequest, "illegal_argument_exception", "The bulk request must be terminated by a newline", name}
+				}
+				payload = append([]byte(nil), sc.Bytes()...)
+			}
+
+			var (
+				status int
+				res    interface{}
+				err    *esError
+			)
+			switch op {
+			case "index", "create":
+				var source map[string]interface{}
+				if e := json.Unmarshal(payload, &source); e != nil {
+					err = &esError{http.StatusBadRequest, "mapper_parsing_exception", "failed to parse", meta.Index}
+					break
+				}
+				status, res, err = s.put(meta.Index, meta.ID, source, op == "create")
+			case "update":
+				status, res, err = s.update(meta.Index, meta.ID, payload)
+			case "delete":
+				status, res, err = s.doc(http.MethodDelete, meta.Index, "_doc", meta.ID, nil)
+			default:
+				return 0, nil, &esError{http.StatusBadRequest, "illegal_argument_exception", "Malformed action/metadata line, unknown action " + op, name}
+			}
+
+			item := map[string]interface{}{}
+			if err != nil {
+				hasErrors = true
+				item = map[string]interface{}{"_index": meta.Index, "_id": meta.ID, "status": err.status, "error": err.body()["error"]}
+			} else {
+				merge(item, res.(map[string]interface{}))
+				item["status"] = status
+			}
+			items = append(items, map[string]interface{}{op: item})
+		}
+	}
+
+	return http.StatusOK, map[string]interface{}{"took": 1, "errors": hasErrors, "items": items}, nil
+}
+
+func (s *Server) putAlias(name, alias string) (int, interface{}, *esError) {
+	ixs, err := s.resolve(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, ix := range ixs {
+		ix.aliases[alias] = true
+	}
+	return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+}
+
+func (s *Server) updateAliases(body []byte) (int, interface{}, *esError) {
+	type aliasAction struct {
+		Index   string   `json:"index"`
+		Indices []string `json:"indices"`
+		Alias   string   `json:"alias"`
+		Aliases []string `json:"aliases"`
+	}
+	var req struct {
+		Actions []map[string]aliasAction `json:"actions"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, nil, parseError(err)
+	}
+
+	// actions are applied atomically, validate all of them first.
+	type change struct {
+		ix    *index
+		alias string
+		add   bool
+	}
+	var changes []change
+	for _, action := range req.Actions {
+		for op, a := range action {
+			names := append(a.Indices, a.Index)
+			aliases := append(a.Aliases, a.Alias)
+			for _, n := range names {
+				if n == "" {
+					continue
+				}
+				ixs, err := s.resolve(n)
+				if err != nil {
+					return 0, nil, err
+				}
+				for _, ix := range ixs {
+					for _, alias := range aliases {
+						if alias == "" {
+							continue
+						}
+						switch op {
+						case "add":
+							changes = append(changes, change{ix, alias, true})
+						case "remove":
+							if !ix.aliases[alias] {
+								return 0, nil, &esError{http.StatusNotFound, "aliases_not_found_exception", fmt.Sprintf("aliases [%s] missing", alias), ix.name}
+							}
+							changes = append(changes, change{ix, alias, false})
+						default:
+							return 0, nil, &esError{http.StatusBadRequest, "illegal_argument_exception", "unsupported alias action " + op, ix.name}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for _, c := range changes {
+		if c.add {
+			c.ix.aliases[c.alias] = true
+		} else {
+			delete(c.ix.aliases, c.alias)
+		}
+	}
+	return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+}
+
+func (s *Server) getAliases(name string, rest []string) (int, interface{}, *esError) {
+	var ixs []*index
+	if name == "" {
+		ixs = s.all()
+	} else {
+		var err *esError
+		if ixs, err = s.resolve(name); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	var filter []string
+	if len(rest) > 0 && rest[0] != "" {
+		filter = strings.Split(rest[0], ",")
+	}
+
+	res := map[string]interface{}{}
+	for _, ix := range ixs {
+		aliases := map[string]interface{}{}
+		for alias := range ix.aliases {
+			if len(filter) == 0 || matchAny(filter, alias) {
+				aliases[alias] = map[string]interface{}{}
+			}
+		}
+		if len(filter) > 0 && len(aliases) == 0 {
+			continue
+		}
+		res[ix.name] = map[string]interface{}{"aliases": aliases}
+	}
+
+	if len(filter) > 0 && len(res) == 0 {
+		return http.StatusNotFound, map[string]interface{}{"error": fmt.Sprintf("alias [%s] missing", rest[0]), "status": http.StatusNotFound}, nil
+	}
+	return http.StatusOK, res, nil
+}
+
+func (s *Server) clusterHealth(rest []string) (int, interface{}, *esError) {
+	ixs := s.all()
+	if len(rest) > 0 && rest[0] != "" {
+		var err *esError
+		if ixs, err = s.resolve(rest[0]); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	rank := map[string]int{"green": 0, "yellow": 1, "red": 2}
+	status := "green"
+	indices := map[string]interface{}{}
+	for _, ix := range ixs {
+		if rank[ix.health] > rank[status] {
+			status = ix.health
+		}
+		active := 1
+		if ix.health == "red" {
+			active = 0
+		}
+		indices[ix.name] = map[string]interface{}{
+			"status": ix.health, "number_of_shards": 1, "number_of_replicas": 0,
+			"active_primary_shards": active, "active_shards": active, "unassigned_shards": 1 - active,
+		}
+	}
+
+	return http.StatusOK, map[string]interface{}{
+		"cluster_name":    "searchtest",
+		"status":          status,
+		"number_of_nodes": 1, "number_of_data_nodes": 1,
+		"indices": indices,
+	}, nil
+}
+
+func (s *Server) stats(name string) (int, interface{}, *esError) {
+	ixs, err := s.resolve(name)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	total := 0
+	indices := map[string]interface{}{}
+	for _, ix := range ixs {
+		total += len(ix.docs)
+		detail := map[string]interface{}{"docs": map[string]int{"count": len(ix.docs), "deleted": 0}}
+		indices[ix.name] = map[string]interface{}{"uuid": ix.name, "primaries": detail, "total": detail}
+	}
+
+	all := map[string]interface{}{"docs": map[string]int{"count": total, "deleted": 0}}
+	return http.StatusOK, map[string]interface{}{
+		"_shards": shards()["_shards"],
+		"_all":    map[string]interface{}{"primaries": all, "total": all},
+		"indices": indices,
+	}, nil
+}
+
+func (s *Server) catIndices(rest []string) (int, interface{}, *esError) {
+	ixs := s.all()
+	if len(rest) > 0 && rest[0] != "" {
+		var err *esError
+		if ixs, err = s.resolve(rest[0]); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	rows := make([]map[string]string, 0, len(ixs))
+	for _, ix := range ixs {
+		rows = append(rows, map[string]string{
+			"health":        ix.health,
+			"status":        "open",
+			"index":         ix.name,
+			"uuid":          ix.name,
+			"pri":           "1",
+			"rep":           "0",
+			"docs.count":    strconv.Itoa(len(ix.docs)),
+			"docs.deleted":  "0",
+			"creation.date": strconv.FormatInt(ix.created.UnixMilli(), 10),
+		})
+	}
+	return http.StatusOK, rows, nil
+}
+
+// resolve returns indices by comma separated names, aliases, wildcards or _all.
+func (s *Server) resolve(names string) ([]*index, *esError) {
+	seen := map[string]bool{}
+	var ixs []*index
+	add := func(ix *index) {
+		if !seen[ix.name] {
+			seen[ix.name] = true
+			ixs = append(ixs, ix)
+		}
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		switch {
+		case name == "_all" || name == "*":
+			for _, ix := range s.all() {
+				add(ix)
+			}
+		case strings.ContainsAny(name, "*?"):
+			for _, ix := range s.all() {
+				if matchAny([]string{name}, ix.name) || ix.hasAlias(name) {
+					add(ix)
+				}
+			}
+		default:
+			if ix, ok := s.indices[name]; ok {
+				add(ix)
+				continue
+			}
+			found := false
+			for _, ix := range s.all() {
+				if ix.aliases[name] {
+					add(ix)
+					found = true
+				}
+			}
+			if !found {
+				return nil, &esError{http.StatusNotFound, "index_not_found_exception", "no such index [" + name + "]", name}
+			}
+		}
+	}
+
+	sort.Slice(ixs, func(i, j int) bool { return ixs[i].name < ixs[j].name })
+	return ixs, nil
+}
+
+// single resolves a name into one index.
+func (s *Server) single(name string) (*index, *esError) {
+	ixs, err := s.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ixs) != 1 {
+		return nil, &esError{http.StatusBadRequest, "illegal_argument_exception", fmt.Sprintf("alias [%s] has more than one index associated with it", name), name}
+	}
+	return ixs[0], nil
+}
+
+// writeIndex resolves a name into one index, an index is created when it doesn't exist.
+func (s *Server) writeIndex(name string) (*index, *esError) {
+	if _, ok := s.indices[name]; !ok && !s.isAlias(name) {
+		if _, _, err := s.createIndex(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return s.single(name)
+}
+
+func (s *Server) isAlias(name string) bool {
+	for _, ix := range s.indices {
+		if ix.aliases[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) all() []*index {
+	ixs := make([]*index, 0, len(s.indices))
+	for _, ix := range s.indices {
+		ixs = append(ixs, ix)
+	}
+	sort.Slice(ixs, func(i, j int) bool { return ixs[i].name < ixs[j].name })
+	return ixs
+}
+
+func (ix *index) hasAlias(pattern string) bool {
+	for alias := range ix.aliases {
+		if matchAny([]string{pattern}, alias) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ix *index) remove(id string) *document {
+	doc := ix.docs[id]
+	delete(ix.docs, id)
+	for i, v := range ix.ids {
+		if v == id {
+			ix.ids = append(ix.ids[:i], ix.ids[i+1:]...)
+			break
+		}
+	}
+	return doc
+}
+
+func (e *esError) body() map[string]interface{} {
+	cause := map[string]interface{}{"type": e.typ, "reason": e.reason}
+	if e.index != "" {
+		cause["index"] = e.index
+	}
+
+	detail := map[string]interface{}{"root_cause": []interface{}{cause}}
+	merge(detail, cause)
+	return map[string]interface{}{"error": detail, "status": e.status}
+}
+
+func unsupported(r *http.Request) *esError {
+	reason := fmt.Sprintf("searchtest doesn't support [%s %s]", r.Method, r.URL.Path)
+	return &esError{http.StatusBadRequest, "illegal_argument_exception", reason, ""}
+}
+
+func parseError(err error) *esError {
+	return &esError{http.StatusBadRequest, "parse_exception", err.Error(), ""}
+}
+
+func shards() map[string]interface{} {
+	return map[string]interface{}{"_shards": map[string]int{"total": 1, "successful": 1, "failed": 0}}
+}
+
+// indexSettings stores settings as elasticsearch returns, they're nested under "index"
+// with dotted keys expanded and values become strings.
+func indexSettings(settings map[string]interface{}) map[string]interface{} {
+	ix := map[string]interface{}{}
+
+	var walk func(path []string, v interface{})
+	walk = func(path []string, v interface{}) {
+		if sub, ok := v.(map[string]interface{}); ok {
+			for k, sv := range sub {
+				walk(append(path[:len(path):len(path)], strings.Split(k, ".")...), sv)
+			}
+			return
+		}
+
+		if len(path) > 0 && path[0] == "index" {
+			path = path[1:]
+		}
+		if len(path) == 0 {
+			return
+		}
+
+		m := ix
+		for _, key := range path[:len(path)-1] {
+			sub, ok := m[key].(map[string]interface{})
+			if !ok {
+				sub = map[string]interface{}{}
+				m[key] = sub
+			}
+			m = sub
+		}
+		m[path[len(path)-1]] = settingValue(v)
+	}
+	walk(nil, settings)
+
+	return map[string]interface{}{"index": ix}
+}
+
+// staticSettings returns keys of settings which can't be updated on an open index.
+func staticSettings(settings map[string]interface{}, prefix string) []string {
+	var keys []string
+	for k, v := range settings {
+		key := prefix + k
+		if sub, ok := v.(map[string]interface{}); ok {
+			keys = append(keys, staticSettings(sub, key+".")...)
+			continue
+		}
+		for _, p := range []string{"number_of_shards", "number_of_routing_shards", "codec", "routing_partition_size", "sort.", "analysis.", "similarity.", "store."} {
+			if key == p || (strings.HasSuffix(p, ".") && strings.HasPrefix(key, p)) {
+				keys = append(keys, "index."+key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func settingValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return v
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i := range v {
+			out[i] = settingValue(v[i])
+		}
+		return out
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// merge copies src into dst deeply.
+func merge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		sm, ok := v.(map[string]interface{})
+		dm, ok2 := dst[k].(map[string]interface{})
+		if ok && ok2 {
+			merge(dm, sm)
+			continue
+		}
+		if ok {
+			dm = map[string]interface{}{}
+			merge(dm, sm)
+			dst[k] = dm
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+func newClient(url string) *elastic.Client {
+	client, err := elastic.NewClient(
+		elastic.SetURL(url),
+		elastic.SetSniff(false),
+		elastic.SetHealthcheck(false),
+	)
+	if err != nil {
+		panic(fmt.Sprintf("searchtest: failed to make a client: %s", err))
+	}
+	return client
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package searchtest
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+type testCompany struct {
+	Name      string   `json:"name"`
+	Tags      []string `json:"tags"`
+	Employees int      `json:"employees"`
+}
+
+func seed(t *testing.T, client *elastic.Client) {
+	t.Helper()
+
+	ctx := context.Background()
+	if _, err := client.CreateIndex("companies_1700000000000000000").Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Alias().Add("companies_1700000000000000000", "companies").Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	bulk := client.Bulk().Index("companies").Add(
+		elastic.NewBulkIndexRequest().Id("1").Doc(testCompany{Name: "Eiicon Inc", Tags: []string{"hr", "it"}, Employees: 100}),
+		elastic.NewBulkIndexRequest().Id("2").Doc(testCompany{Name: "Acme Corp", Tags: []string{"it"}, Employees: 10}),
+		elastic.NewBulkIndexRequest().Id("3").Doc(testCompany{Name: "Eiicon Lab", Tags: []string{"lab"}, Employees: 5}),
+	)
+	res, err := bulk.Do(ctx)
+	if err != nil || res.Errors {
+		t.Fatalf("bulk failed: %v %s", res, err)
+	}
+}
+
+func TestServerDocuments(t *testing.T) {
+	t.Helper()
+
+	srv := NewServer(t)
+	client := srv.Client()
+	ctx := context.Background()
+	seed(t, client)
+
+	got, err := client.Get().Index("companies").Id("1").Do(ctx)
+	if err != nil || !got.Found {
+		t.Fatalf("get failed: %v %s", got, err)
+	}
+	if _, err := client.Get().Index("companies").Id("9").Do(ctx); !elastic.IsNotFound(err) {
+		t.Errorf("get must be not found: %s", err)
+	}
+
+	if _, err := client.Update().Index("companies").Id("2").Doc(map[string]interface{}{"employees": 20}).Do(ctx); err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+	if v := srv.Source("companies", "2")["employees"]; v != 20.0 {
+		t.Errorf("update error: %v", v)
+	}
+
+	if _, err := client.Delete().Index("companies").Id("3").Do(ctx); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	mget, err := client.MultiGet().Add(
+		elastic.NewMultiGetItem().Index("companies").Id("1"),
+		elastic.NewMultiGetItem().Index("companies").Id("3"),
+	).Do(ctx)
+	if err != nil || len(mget.Docs) != 2 || !mget.Docs[0].Found || mget.Docs[1].Found {
+		t.Fatalf("mget error: %v %s", mget, err)
+	}
+
+	bulk, err := client.Bulk().Add(
+		elastic.NewBulkCreateRequest().Index("companies").Id("1").Doc(testCompany{}),
+		elastic.NewBulkDeleteRequest().Index("companies").Id("2"),
+	).Do(ctx)
+	if err != nil || !bulk.Errors || len(bulk.Failed()) != 1 || len(bulk.Deleted()) != 1 {
+		t.Errorf("bulk error: %#+v %s", bulk, err)
+	}
+}
+
+func TestServerIndices(t *testing.T) {
+	t.Helper()
+
+	srv := NewServer(t)
+	client := srv.Client()
+	ctx := context.Background()
+	seed(t, client)
+
+	names, err := client.IndexNames()
+	if err != nil || !reflect.DeepEqual(names, []string{"companies_1700000000000000000"}) {
+		t.Errorf("index names error: %v %s", names, err)
+	}
+
+	cat, err := client.CatIndices().Do(ctx)
+	if err != nil || len(cat) != 1 || cat[0].DocsCount != 3 {
+		t.Errorf("cat indices error: %#+v %s", cat, err)
+	}
+
+	if _, err := client.CreateIndex("companies_1800000000000000000").Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Alias().
+		Action(elastic.NewAliasRemoveAction("companies").Index("companies_1700000000000000000")).
+		Action(elastic.NewAliasAddAction("companies").Index("companies_1800000000000000000")).
+		Do(ctx)
+	if err != nil {
+		t.Fatalf("update aliases failed: %s", err)
+	}
+
+	aliases, err := client.Aliases().Index("companies").Do(ctx)
+	if err != nil {
+		t.Fatalf("aliases failed: %s", err)
+	}
+	if got := aliases.IndicesByAlias("companies"); !reflect.DeepEqual(got, []string{"companies_1800000000000000000"}) {
+		t.Errorf("aliases error: %v", got)
+	}
+
+	if _, err := client.DeleteIndex("companies_1700000000000000000").Do(ctx); err != nil {
+		t.Fatalf("delete index failed: %s", err)
+	}
+	if ok, _ := client.IndexExists("companies_1700000000000000000").Do(ctx); ok {
+		t.Error("index must be deleted")
+	}
+	if _, err := client.DeleteIndex("missing").Do(ctx); !elastic.IsNotFound(err) {
+		t.Errorf("delete index must be not found: %s", err)
+	}
+}
+
+func TestServerSearch(t *testing.T) {
+	t.Helper()
+
+	srv := NewServer(t)
+	client := srv.Client()
+	ctx := context.Background()
+	seed(t, client)
+
+	for _, tc := range []struct {
+		query elastic.Query
+		ids   []string
+	}{
+		{elastic.NewMatchAllQuery(), []string{"1", "2", "3"}},
+		{elastic.NewMatchQuery("name", "eiicon"), []string{"1", "3"}},
+		{elastic.NewMultiMatchQuery("eiicon lab", "name^2", "tags").Operator("and"), []string{"3"}},
+		{elastic.NewTermQuery("tags", "it"), []string{"1", "2"}},
+		{elastic.NewTermsQuery("tags", "hr", "lab"), []string{"1", "3"}},
+		{elastic.NewRangeQuery("employees").Gte(10).Lt(100), []string{"2"}},
+		{elastic.NewIdsQuery().Ids("2", "3"), []string{"2", "3"}},
+		{elastic.NewBoolQuery().Must(elastic.NewMatchQuery("name", "eiicon")).MustNot(elastic.NewTermQuery("tags", "lab")), []string{"1"}},
+		{elastic.NewBoolQuery().Should(elastic.NewTermQuery("tags", "hr"), elastic.NewTermQuery("tags", "lab")), []string{"1", "3"}},
+	} {
+		res, err := client.Search("companies").Query(tc.query).Do(ctx)
+		if err != nil {
+			t.Fatalf("search failed %#+v: %s", tc.query, err)
+		}
+		var ids []string
+		for _, h := range res.Hits.Hits {
+			ids = append(ids, h.Id)
+		}
+		if !reflect.DeepEqual(ids, tc.ids) {
+			src, _ := tc.query.Source()
+			t.Errorf("search %v error: %v, want %v", src, ids, tc.ids)
+		}
+	}
+
+	res, err := client.Search("companies").
+		Sort("employees", true).From(1).Size(1).
+		Aggregation("tags", elastic.NewTermsAggregation().Field("tags").Size(1)).
+		Do(ctx)
+	if err != nil {
+		t.Fatalf("search failed: %s", err)
+	}
+	if res.TotalHits() != 3 || len(res.Hits.Hits) != 1 || res.Hits.Hits[0].Id != "2" {
+		t.Errorf("sort and page error: %#+v", res.Hits)
+	}
+	terms, ok := res.Aggregations.Terms("tags")
+	if !ok || len(terms.Buckets) != 1 || terms.Buckets[0].Key != "it" || terms.Buckets[0].DocCount != 2 || terms.SumOfOtherDocCount != 2 {
+		t.Errorf("aggregation error: %#+v", terms)
+	}
+
+	count, err := client.Count("companies").Query(elastic.NewTermQuery("tags", "it")).Do(ctx)
+	if err != nil || count != 2 {
+		t.Errorf("count error: %d %s", count, err)
+	}
+
+	if _, err := client.Search("companies").Query(elastic.NewFuzzyQuery("name", "eicon")).Do(ctx); err == nil {
+		t.Error("unsupported query must fail")
+	}
+}
+
+func TestFixture(t *testing.T) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "companies.json")
+	ctx := context.Background()
+
+	srv := NewServer(t)
+	seed(t, srv.Client())
+
+	rec := NewRecorder(t, srv.URL)
+	want, err := rec.Client().Search("companies").Query(elastic.NewMatchQuery("name", "eiicon")).Do(ctx)
+	if err != nil {
+		t.Fatalf("recorded search failed: %s", err)
+	}
+	if err := rec.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	rep := NewFixtureReplayer(t, path)
+	got, err := rep.Client().Search("companies").Query(elastic.NewMatchQuery("name", "eiicon")).Do(ctx)
+	if err != nil {
+		t.Fatalf("replayed search failed: %s", err)
+	}
+
+	wb, _ := json.Marshal(want.Hits)
+	gb, _ := json.Marshal(got.Hits)
+	if string(wb) != string(gb) {
+		t.Errorf("replay error: %s, want %s", gb, wb)
+	}
+	if rep.Remaining() != 0 {
+		t.Errorf("replay remaining: %d", rep.Remaining())
+	}
+}
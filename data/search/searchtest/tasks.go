@@ -0,0 +1,215 @@
+package searchtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type (
+	// task is a by-query request which is submitted with wait_for_completion=false.
+	task struct {
+		id        string
+		seq       int
+		action    string
+		name      string
+		query     map[string]interface{}
+		rps       float64
+		completed bool
+		cancelled bool
+		total     int
+		done      int
+		failures  []interface{}
+	}
+
+	byQueryRequest struct {
+		Query  map[string]interface{} `json:"query"`
+		Script interface{}            `json:"script"`
+	}
+)
+
+// HoldTasks keeps submitted tasks running while hold is true, false completes the held tasks.
+// It's used to test progress polling and cancellation.
+func (s *Server) HoldTasks(hold bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.holdTasks = hold
+	if hold {
+		return
+	}
+	for _, t := range s.tasks {
+		if !t.completed {
+			s.runTask(t)
+		}
+	}
+}
+
+// byQuery handles _delete_by_query and _update_by_query, update scripts aren't supported.
+func (s *Server) byQuery(name, action string, params url.Values, body []byte) (int, interface{}, *esError) {
+	req := byQueryRequest{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return 0, nil, parseError(err)
+		}
+	}
+	if req.Script != nil {
+		return 0, nil, &esError{http.StatusBadRequest, "illegal_argument_exception", "searchtest doesn't support scripts", name}
+	}
+
+	hits, err := s.byQueryHits(name, req.Query)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rps := -1.0
+	if v := params.Get("requests_per_second"); v != "" {
+		if f, e := strconv.ParseFloat(v, 64); e == nil {
+			rps = f
+		}
+	}
+
+	s.seq++
+	t := &task{
+		id: fmt.Sprintf("searchtest:%d", s.seq), seq: s.seq, action: action,
+		name: name, query: req.Query, rps: rps, total: len(hits),
+	}
+
+	if params.Get("wait_for_completion") != "false" {
+		s.runTask(t)
+		return http.StatusOK, t.response(), nil
+	}
+
+	if s.tasks == nil {
+		s.tasks = map[string]*task{}
+	}
+	s.tasks[t.id] = t
+	if !s.holdTasks {
+		s.runTask(t)
+	}
+	return http.StatusOK, map[string]interface{}{"task": t.id}, nil
+}
+
+// byQueryHits returns documents which match a query.
+func (s *Server) byQueryHits(name string, query map[string]interface{}) ([]*hit, *esError) {
+	ixs, err := s.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []*hit
+	for _, ix := range ixs {
+		for _, id := range ix.ids {
+			ok, e := matches(query, id, ix.docs[id].source)
+			if e != nil {
+				return nil, e
+			}
+			if ok {
+				hits = append(hits, &hit{index: ix.name, id: id, doc: ix.docs[id]})
+			}
+		}
+	}
+	return hits, nil
+}
+
+// runTask applies a task to documents, it's called with a lock.
+func (s *Server) runTask(t *task) {
+	t.completed = true
+
+	hits, err := s.byQueryHits(t.name, t.query)
+	if err != nil {
+		t.failures = append(t.failures, err.body()["error"])
+		return
+	}
+
+	t.total = len(hits)
+	for _, h := range hits {
+		if t.action == "_delete_by_query" {
+			s.doc(http.MethodDelete, h.index, "_doc", h.id, nil)
+		} else {
+			s.put(h.index, h.id, h.doc.source, false)
+		}
+		t.done++
+	}
+}
+
+// getTask handles GET _tasks/{id}
+func (s *Server) getTask(id string) (int, interface{}, *esError) {
+	t, ok := s.tasks[id]
+	if !ok {
+		return 0, nil, &esError{http.StatusNotFound, "resource_not_found_exception", "task [" + id + "] isn't running and hasn't stored its results", ""}
+	}
+
+	res := map[string]interface{}{
+		"completed": t.completed,
+		"task": map[string]interface{}{
+			"node":        "searchtest",
+			"id":          t.seq,
+			"type":        "transport",
+			"action":      "indices:data/write/" + strings.Trim(t.action, "_"),
+			"status":      t.status(),
+			"description": t.action + " [" + t.name + "]",
+			"cancellable": true,
+			"cancelled":   t.cancelled,
+		},
+	}
+	if t.completed {
+		res["response"] = t.response()
+	}
+	return http.StatusOK, res, nil
+}
+
+// cancelTask handles POST _tasks/{id}/_cancel
+func (s *Server) cancelTask(id string) (int, interface{}, *esError) {
+	t, ok := s.tasks[id]
+	if !ok {
+		return 0, nil, &esError{http.StatusNotFound, "resource_not_found_exception", "task [" + id + "] is missing", ""}
+	}
+	if !t.completed {
+		t.completed, t.cancelled = true, true
+	}
+	return http.StatusOK, map[string]interface{}{"nodes": map[string]interface{}{}}, nil
+}
+
+// rethrottleTask handles POST _delete_by_query/{id}/_rethrottle
+func (s *Server) rethrottleTask(id string, params url.Values) (int, interface{}, *esError) {
+	t, ok := s.tasks[id]
+	if !ok {
+		return 0, nil, &esError{http.StatusNotFound, "resource_not_found_exception", "task [" + id + "] is missing", ""}
+	}
+	rps, err := strconv.ParseFloat(params.Get("requests_per_second"), 64)
+	if err != nil {
+		return 0, nil, parseError(err)
+	}
+	t.rps = rps
+	return http.StatusOK, map[string]interface{}{"nodes": map[string]interface{}{}}, nil
+}
+
+func (t *task) status() map[string]interface{} {
+	status := map[string]interface{}{
+		"total": t.total, "created": 0, "updated": 0, "deleted": 0, "batches": 0,
+		"version_conflicts": 0, "noops": 0, "requests_per_second": t.rps, "throttled_millis": 0,
+	}
+	if t.done > 0 {
+		status["batches"] = 1
+	}
+	if t.action == "_delete_by_query" {
+		status["deleted"] = t.done
+	} else {
+		status["updated"] = t.done
+	}
+	return status
+}
+
+func (t *task) response() map[string]interface{} {
+	res := t.status()
+	res["took"], res["timed_out"] = 1, false
+	res["failures"] = append([]interface{}{}, t.failures...)
+	if t.cancelled {
+		res["canceled"] = "by user request"
+	}
+	return res
+}
@@ -0,0 +1,253 @@
+package search
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/text/width"
+	"golang.org/x/xerrors"
+)
+
+type (
+	// Suggestion is an option of completion, phrase and term suggesters.
+	Suggestion struct {
+		// Input is a part of the suggested text which the option is for.
+		Input string
+		// Text is a suggested text.
+		Text string
+		// Highlighted is a text with highlighted corrections of phrase suggester.
+		Highlighted string
+		// Score is _score of completion or score of phrase and term suggesters.
+		Score float64
+		// Freq is a document frequency of term suggester.
+		Freq int
+		// CollateMatch is true when a phrase matches a collate query.
+		CollateMatch bool
+		// ID and Index are a document which a completion option belongs to.
+		ID, Index string
+		// Source is a document of completion suggester.
+		Source json.RawMessage
+	}
+)
+
+// CompletionSuggester suggests texts which start with prefix from a completion field,
+// prefix is normalized as well as Query.Match. Duplicates are skipped.
+//
+//	svc := search.SuggestService(client, []string{"companies"},
+//		search.CompletionSuggester("name", "name.suggest", "えいあ", 10).
+//			FuzzyOptions(elastic.NewFuzzyCompletionSuggesterOptions().EditDistance("AUTO")))
+func CompletionSuggester(name, field, prefix string, size int) *elastic.CompletionSuggester {
+	return elastic.NewCompletionSuggester(name).
+		Field(field).
+		Prefix(normalizeText(prefix)).
+		Size(size).
+		SkipDuplicates(true)
+}
+
+// PhraseSuggester suggests corrected phrases of text for "did you mean", field had better be
+// analyzed by a shingle analyzer. e.g. name.shingle of SuggestProperty
+func PhraseSuggester(name, field, text string, size int) *elastic.PhraseSuggester {
+	return elastic.NewPhraseSuggester(name).
+		Field(field).
+		Text(normalizeText(text)).
+		Size(size).
+		GramSize(3).
+		Highlight("<em>", "</em>").
+		CandidateGenerator(elastic.NewDirectCandidateGenerator(field).SuggestMode("always"))
+}
+
+// TermSuggester suggests corrected words of text for every word which doesn't exist in field.
+func TermSuggester(name, field, text string, size int) *elastic.TermSuggester {
+	return elastic.NewTermSuggester(name).
+		Field(field).
+		Text(normalizeText(text)).
+		Size(size).
+		SuggestMode("missing").
+		Sort("score")
+}
+
+// SuggestService returns a search service which only runs suggesters, hits are omitted.
+func SuggestService(client *elastic.Client, indices []string, suggesters ...elastic.Suggester) *elastic.SearchService {
+	svc := client.Search(indices...).Size(0).TrackTotalHits(false)
+	for _, s := range suggesters {
+		svc = svc.Suggester(s)
+	}
+	return svc
+}
+
+// Suggest adds suggesters into the query, suggestions come along with hits.
+func (q *Query) Suggest(suggesters ...elastic.Suggester) *Query {
+	q.suggest = append(q.suggest, suggesters...)
+	return q
+}
+
+// Suggestions returns options of a suggester by name in order of entries and scores.
+func (cr *Result) Suggestions(name string) []Suggestion {
+	sr, _ := cr.Res.(*elastic.SearchResult)
+	return Suggestions(sr, name)
+}
+
+// DidYouMean returns a corrected text by a phrase or term suggester, blank means no correction.
+func (cr *Result) DidYouMean(name string) string {
+	sr, _ := cr.Res.(*elastic.SearchResult)
+	return DidYouMean(sr, name)
+}
+
+// Suggestions returns options of a suggester by name from a search result, e.g. Hits.Raw
+func Suggestions(sr *elastic.SearchResult, name string) []Suggestion {
+	if sr == nil {
+		return nil
+	}
+
+	var list []Suggestion
+	for _, entry := range sr.Suggest[name] {
+		for _, opt := range entry.Options {
+			score := opt.Score
+			if score == 0 {
+				score = opt.ScoreUnderscore
+			}
+			list = append(list, Suggestion{
+				Input:        entry.Text,
+				Text:         opt.Text,
+				Highlighted:  opt.Highlighted,
+				Score:        score,
+				Freq:         opt.Freq,
+				CollateMatch: opt.CollateMatch,
+				ID:           opt.Id,
+				Index:        opt.Index,
+				Source:       opt.Source,
+			})
+		}
+	}
+	return list
+}
+
+// DidYouMean returns a corrected text from a search result, a phrase suggester has an entry
+// of the whole text and a term suggester has entries of every word.
+func DidYouMean(sr *elastic.SearchResult, name string) string {
+	if sr == nil {
+		return ""
+	}
+
+	entries := sr.Suggest[name]
+	words := make([]string, 0, len(entries))
+	corrected := false
+	for _, entry := range entries {
+		if len(entry.Options) == 0 {
+			words = append(words, entry.Text)
+			continue
+		}
+		words = append(words, entry.Options[0].Text)
+		corrected = corrected || entry.Options[0].Text != entry.Text
+	}
+
+	if !corrected {
+		return ""
+	}
+	return strings.Join(words, " ")
+}
+
+// Decode unmarshals a document of a completion option.
+func (s Suggestion) Decode(v interface{}) error {
+	if len(s.Source) == 0 {
+		return xerrors.Errorf("suggestion <%s> has no source", s.Text)
+	}
+	if err := json.Unmarshal(s.Source, v); err != nil {
+		return xerrors.Errorf("failed to unmarshal suggestion <%s>: %w", s.Text, err)
+	}
+	return nil
+}
+
+// SuggestAnalysis returns index.analysis settings of analyzers for SuggestProperty,
+// it needs analysis-kuromoji plugin.
+//
+//	ja_search            kuromoji for full-text search
+//	autocomplete_index   edge n-gram for prefix search while typing
+//	autocomplete_search  whitespace tokenized input for autocomplete_index
+//	suggest_shingle      word shingles for phrase suggester
+//
+// Set it into Mapping.Settings["analysis"].
+func SuggestAnalysis() map[string]interface{} {
+	return map[string]interface{}{
+		"tokenizer": map[string]interface{}{
+			"ja_kuromoji": map[string]interface{}{
+				"type": "kuromoji_tokenizer",
+				"mode": "search",
+			},
+			"autocomplete_edge_ngram": map[string]interface{}{
+				"type":        "edge_ngram",
+				"min_gram":    1,
+				"max_gram":    20,
+				"token_chars": []string{"letter", "digit"},
+			},
+		},
+		"filter": map[string]interface{}{
+			"suggest_shingle": map[string]interface{}{
+				"type":             "shingle",
+				"min_shingle_size": 2,
+				"max_shingle_size": 3,
+			},
+		},
+		"analyzer": map[string]interface{}{
+			"ja_search": map[string]interface{}{
+				"type":      "custom",
+				"tokenizer": "ja_kuromoji",
+				"filter": []string{
+					"kuromoji_baseform", "kuromoji_part_of_speech", "cjk_width",
+					"ja_stop", "kuromoji_stemmer", "lowercase",
+				},
+			},
+			"autocomplete_index": map[string]interface{}{
+				"type":      "custom",
+				"tokenizer": "autocomplete_edge_ngram",
+				"filter":    []string{"cjk_width", "lowercase"},
+			},
+			"autocomplete_search": map[string]interface{}{
+				"type":      "custom",
+				"tokenizer": "whitespace",
+				"filter":    []string{"cjk_width", "lowercase"},
+			},
+			"suggest_shingle": map[string]interface{}{
+				"type":      "custom",
+				"tokenizer": "standard",
+				"filter":    []string{"cjk_width", "lowercase", "suggest_shingle"},
+			},
+		},
+	}
+}
+
+// SuggestProperty returns a text field mapping with sub fields of SuggestAnalysis.
+//
+//	name               ja_search, for Query.Match
+//	name.autocomplete  edge n-gram, for Query.Match while typing
+//	name.suggest       completion, for CompletionSuggester
+//	name.shingle       shingles, for PhraseSuggester and TermSuggester
+//
+// Set it into Mapping.Mappings["properties"].
+func SuggestProperty() map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "text",
+		"analyzer": "ja_search",
+		"fields": map[string]interface{}{
+			"autocomplete": map[string]interface{}{
+				"type":            "text",
+				"analyzer":        "autocomplete_index",
+				"search_analyzer": "autocomplete_search",
+			},
+			"suggest": map[string]interface{}{
+				"type":     "completion",
+				"analyzer": "autocomplete_search",
+			},
+			"shingle": map[string]interface{}{
+				"type":     "text",
+				"analyzer": "suggest_shingle",
+			},
+		},
+	}
+}
+
+// normalizeText folds widths and spaces as well as Query.Match.
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(width.Fold.String(text)), " ")
+}
@@ -0,0 +1,112 @@
+package search
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const testSuggestResponse = `{
+	"hits": {"total": {"value": 0}, "hits": []},
+	"suggest": {
+		"name": [{
+			"text": "eii", "offset": 0, "length": 3,
+			"options": [
+				{"text": "Eiicon Inc", "_index": "companies", "_id": "1", "_score": 2, "_source": {"name": "Eiicon Inc", "tags": ["hr"]}},
+				{"text": "Eiicon Lab", "_index": "companies", "_id": "3", "_score": 1, "_source": {"name": "Eiicon Lab"}}
+			]
+		}],
+		"phrase": [{
+			"text": "eicon lab", "offset": 0, "length": 9,
+			"options": [{"text": "eiicon lab", "highlighted": "<em>eiicon</em> lab", "score": 0.5}]
+		}],
+		"term": [
+			{"text": "eicon", "offset": 0, "length": 5, "options": [{"text": "eiicon", "score": 0.8, "freq": 3}]},
+			{"text": "lab", "offset": 6, "length": 3, "options": []}
+		],
+		"fine": [{"text": "eiicon", "offset": 0, "length": 6, "options": []}]
+	}
+}`
+
+func TestSuggestions(t *testing.T) {
+	t.Helper()
+
+	var sr elastic.SearchResult
+	if err := json.Unmarshal([]byte(testSuggestResponse), &sr); err != nil {
+		t.Fatal(err)
+	}
+	cr := &Result{Res: &sr}
+
+	list := cr.Suggestions("name")
+	if len(list) != 2 || list[0].Text != "Eiicon Inc" || list[0].Score != 2 || list[0].ID != "1" || list[0].Input != "eii" {
+		t.Fatalf("completion suggestions error: %#+v", list)
+	}
+	var c testCompany
+	if err := list[0].Decode(&c); err != nil || c.Name != "Eiicon Inc" || len(c.Tags) != 1 {
+		t.Errorf("decode error: %#+v %s", c, err)
+	}
+
+	phrase := cr.Suggestions("phrase")
+	if len(phrase) != 1 || phrase[0].Highlighted != "<em>eiicon</em> lab" || phrase[0].Score != 0.5 {
+		t.Errorf("phrase suggestions error: %#+v", phrase)
+	}
+	if got := cr.DidYouMean("phrase"); got != "eiicon lab" {
+		t.Errorf("phrase did you mean error: %q", got)
+	}
+
+	if term := cr.Suggestions("term"); len(term) != 1 || term[0].Freq != 3 {
+		t.Errorf("term suggestions error: %#+v", term)
+	}
+	if got := cr.DidYouMean("term"); got != "eiicon lab" {
+		t.Errorf("term did you mean error: %q", got)
+	}
+
+	if got := cr.DidYouMean("fine"); got != "" {
+		t.Errorf("did you mean must be blank: %q", got)
+	}
+	if got := (&Result{}).Suggestions("name"); got != nil {
+		t.Errorf("suggestions must be nil: %#+v", got)
+	}
+}
+
+func TestCompletionSuggester(t *testing.T) {
+	t.Helper()
+
+	src, err := CompletionSuggester("name", "name.suggest", "ｅｉｉ　ｺﾝ", 5).Source(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(src)
+	for _, want := range []string{`"prefix":"eii コン"`, `"field":"name.suggest"`, `"skip_duplicates":true`, `"size":5`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("completion suggester %s doesn't contain %s", b, want)
+		}
+	}
+}
+
+func TestSuggestMapping(t *testing.T) {
+	t.Helper()
+
+	m := &Mapping{
+		Settings: map[string]interface{}{"analysis": SuggestAnalysis()},
+		Mappings: map[string]interface{}{"properties": map[string]interface{}{"name": SuggestProperty()}},
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(m.Body()), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	analyzers := body["settings"].(map[string]interface{})["analysis"].(map[string]interface{})["analyzer"].(map[string]interface{})
+	fields := body["mappings"].(map[string]interface{})["properties"].(map[string]interface{})["name"].(map[string]interface{})["fields"].(map[string]interface{})
+	for _, f := range fields {
+		f := f.(map[string]interface{})
+		for _, k := range []string{"analyzer", "search_analyzer"} {
+			if name, ok := f[k].(string); ok && analyzers[name] == nil {
+				t.Errorf("analyzer %s isn't defined", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,618 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	radix "github.com/mediocregopher/radix/v3"
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/logger"
+)
+
+// syncKey is a default redis key of change events
+const syncKey = "search:sync"
+
+// ChangeOp is an operation of a row
+type ChangeOp string
+
+// Change operations
+const (
+	// ChangeUpsert loads a row and indexes it, the document is deleted when the row is missing.
+	ChangeUpsert ChangeOp = "upsert"
+	// ChangeDelete deletes a document.
+	ChangeDelete ChangeOp = "delete"
+)
+
+// popScript pops at most ARGV[1] items from a list atomically
+var popScript = radix.NewEvalScript(1, `
+local items = redis.call('LRANGE', KEYS[1], 0, tonumber(ARGV[1]) - 1)
+if #items > 0 then
+	redis.call('LTRIM', KEYS[1], #items, -1)
+end
+return items
+`)
+
+type (
+	// Change is an event of a row which was written by a repository.
+	Change struct {
+		Table string   `json:"table"`
+		ID    string   `json:"id"`
+		Op    ChangeOp `json:"op"`
+		// Attempt is a number of failed syncs.
+		Attempt int `json:"attempt,omitempty"`
+	}
+
+	// ChangeQueue carries changes from repositories to a Syncer.
+	ChangeQueue interface {
+		// Push enqueues changes.
+		Push(ctx context.Context, changes ...Change) error
+		// Pop dequeues at most max changes, it waits up to wait for the first change.
+		// A redis queue waits in whole seconds, or polls before and after a wait under a second.
+		Pop(ctx context.Context, max int, wait time.Duration) ([]Change, error)
+	}
+
+	// redisChangeQueue stores changes into a redis list.
+	redisChangeQueue struct {
+		pool *radix.Pool
+		key  string
+	}
+
+	// memoryChangeQueue stores changes into a buffered channel.
+	memoryChangeQueue struct {
+		ch chan Change
+	}
+
+	// DocumentLoader loads documents of rows by ids, missing ids are deleted from an index.
+	DocumentLoader func(ctx context.Context, ids []string) (map[string]interface{}, error)
+
+	// SyncOptions configures a Syncer.
+	SyncOptions struct {
+		// Name is shown in logs.
+		Name string
+		// Window coalesces duplicated changes of a row in this duration, default 1s.
+		Window time.Duration
+		// BatchSize is a max number of changes in a window, default 500.
+		BatchSize int
+		// MaxAttempts drops a change after this many failures, default 8.
+		MaxAttempts int
+		// Backoff delays the first retry of a failed change, it doubles by attempts, default 2s.
+		Backoff time.Duration
+		// MaxBackoff is a max delay of a retry, default 5m.
+		MaxBackoff time.Duration
+		// OnFailure is called with a change which was dropped, failures are logged when it's nil.
+		// It's called from a goroutine of a retry too.
+		OnFailure func(change Change, err error)
+	}
+
+	// SyncStats is counters of a Syncer.
+	SyncStats struct {
+		// Indexed and Deleted are documents which were applied.
+		Indexed, Deleted int64
+		// Coalesced is duplicated changes which were merged.
+		Coalesced int64
+		// Retried is changes which were pushed again after a failure.
+		Retried int64
+		// Dropped is changes which exceeded MaxAttempts.
+		Dropped int64
+	}
+
+	// Syncer keeps indices in sync with tables by changes, it loads documents by a loader
+	// of each table and applies them with bulk requests.
+	//
+	//	queue := search.NewRedisChangeQueue(pool, "")
+	//	syncer := search.NewSyncer(cmd, client, queue, search.SyncOptions{})
+	//	syncer.Register("companies", "companies", loadCompanies)
+	//	go syncer.Run(ctx)
+	//
+	//	// after a repository writes
+	//	queue.Push(ctx, search.Change{Table: "companies", ID: "1", Op: search.ChangeUpsert})
+	//
+	// Changes are delivered at least once while a process is alive, changes which
+	// are popped but not applied, or wait for a retry, are lost when the process crashes.
+	Syncer struct {
+		cmd     Command
+		client  *elastic.Client
+		queue   ChangeQueue
+		opts    SyncOptions
+		targets map[string]syncTarget
+		mu      sync.RWMutex
+		stats   SyncStats
+
+		retryMu sync.Mutex
+		retries map[*time.Timer]Change
+		retryWG sync.WaitGroup
+	}
+
+	syncTarget struct {
+		index string
+		load  DocumentLoader
+	}
+)
+
+// NewRedisChangeQueue returns a queue on a redis list, the pool is given by util.RedisConn,
+// key is search:sync when it's blank.
+func NewRedisChangeQueue(pool *radix.Pool, key string) ChangeQueue {
+	if key == "" {
+		key = syncKey
+	}
+	return &redisChangeQueue{pool: pool, key: key}
+}
+
+// NewMemoryChangeQueue returns a queue in memory which holds size changes, Push blocks when it's full.
+func NewMemoryChangeQueue(size int) ChangeQueue {
+	if size <= 0 {
+		size = 10000
+	}
+	return &memoryChangeQueue{ch: make(chan Change, size)}
+}
+
+func (q *redisChangeQueue) Push(_ context.Context, changes ...Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	args := make([]string, 0, len(changes)+1)
+	args = append(args, q.key)
+	for _, c := range changes {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return xerrors.Errorf("failed to marshal change <%s/%s>: %w", c.Table, c.ID, err)
+		}
+		args = append(args, string(b))
+	}
+
+	if err := q.pool.Do(radix.Cmd(nil, "RPUSH", args...)); err != nil {
+		return xerrors.Errorf("failed to push changes <%s>: %w", q.key, err)
+	}
+	return nil
+}
+
+func (q *redisChangeQueue) Pop(ctx context.Context, max int, wait time.Duration) ([]Change, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var items []string
+	if wait < time.Second {
+		// BLPOP can't wait under a second, so the list is polled before and after the wait
+		// without blocking. A change pushed during the wait is popped when it ends.
+		if err := q.pool.Do(popScript.Cmd(&items, q.key, strconv.Itoa(max))); err != nil {
+			return nil, xerrors.Errorf("failed to pop changes <%s>: %w", q.key, err)
+		}
+		if len(items) > 0 || wait <= 0 {
+			return q.decode(items), nil
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if err := q.pool.Do(popScript.Cmd(&items, q.key, strconv.Itoa(max))); err != nil {
+			return nil, xerrors.Errorf("failed to pop changes <%s>: %w", q.key, err)
+		}
+		return q.decode(items), nil
+	}
+
+	// BLPOP waits in whole seconds, a connection has a read timeout of util.RedisConn
+	sec := int(wait / time.Second)
+	if sec > 5 {
+		sec = 5
+	}
+
+	var first []string
+	if err := q.pool.Do(radix.Cmd(&first, "BLPOP", q.key, strconv.Itoa(sec))); err != nil {
+		return nil, xerrors.Errorf("failed to pop changes <%s>: %w", q.key, err)
+	}
+	if len(first) != 2 {
+		return nil, nil
+	}
+
+	items = []string{first[1]}
+	if max > 1 {
+		var rest []string
+		if err := q.pool.Do(popScript.Cmd(&rest, q.key, strconv.Itoa(max-1))); err != nil {
+			return nil, xerrors.Errorf("failed to pop changes <%s>: %w", q.key, err)
+		}
+		items = append(items, rest...)
+	}
+	return q.decode(items), nil
+}
+
+// decode unmarshals popped items, an invalid item is dropped with a warning.
+func (q *redisChangeQueue) decode(items []string) []Change {
+	changes := make([]Change, 0, len(items))
+	for _, item := range items {
+		var c Change
+		if err := json.Unmarshal([]byte(item), &c); err != nil {
+			logger.Printf("[WARN] invalid change is dropped <%s>: %s", item, err)
+			continue
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func (q *memoryChangeQueue) Push(ctx context.Context, changes ...Change) error {
+	for _, c := range changes {
+		select {
+		case q.ch <- c:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (q *memoryChangeQueue) Pop(ctx context.Context, max int, wait time.Duration) ([]Change, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	var changes []Change
+	select {
+	case c := <-q.ch:
+		changes = append(changes, c)
+	case <-timer.C:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	for len(changes) < max {
+		select {
+		case c := <-q.ch:
+			changes = append(changes, c)
+		default:
+			return changes, nil
+		}
+	}
+	return changes, nil
+}
+
+// NewSyncer returns Syncer, the client had better be given by util.ESBulkConn.
+func NewSyncer(cmd Command, client *elastic.Client, queue ChangeQueue, opts SyncOptions) *Syncer {
+	if opts.Name == "" {
+		opts.Name = "syncer"
+	}
+	if opts.Window <= 0 {
+		opts.Window = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 2 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+
+	return &Syncer{
+		cmd:     cmd,
+		client:  client,
+		queue:   queue,
+		opts:    opts,
+		targets: map[string]syncTarget{},
+		retries: map[*time.Timer]Change{},
+	}
+}
+
+// Register syncs changes of table into index by load, index is usually an alias.
+func (s *Syncer) Register(table, index string, load DocumentLoader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.targets[table] = syncTarget{index: index, load: load}
+}
+
+// Stats returns counters.
+func (s *Syncer) Stats() SyncStats {
+	return SyncStats{
+		Indexed:   atomic.LoadInt64(&s.stats.Indexed),
+		Deleted:   atomic.LoadInt64(&s.stats.Deleted),
+		Coalesced: atomic.LoadInt64(&s.stats.Coalesced),
+		Retried:   atomic.LoadInt64(&s.stats.Retried),
+		Dropped:   atomic.LoadInt64(&s.stats.Dropped),
+	}
+}
+
+// Run pops changes window by window and applies them until ctx is done,
+// changes which wait for a retry are pushed back to the queue when it stops.
+func (s *Syncer) Run(ctx context.Context) error {
+	logger.Printf("[INFO] syncer <%s> started", s.opts.Name)
+
+	for {
+		changes, err := s.collect(ctx)
+		if len(changes) > 0 {
+			// pending changes are applied even if ctx is done
+			if e := s.Sync(context.WithoutCancel(ctx), changes); e != nil {
+				logger.Printf("[WARN] syncer <%s>: %s", s.opts.Name, e)
+			}
+		}
+
+		if ctx.Err() != nil {
+			s.flushRetries()
+			logger.Printf("[INFO] syncer <%s> stopped: %+v", s.opts.Name, s.Stats())
+			return nil
+		}
+		if err != nil {
+			logger.Printf("[WARN] syncer <%s> failed to pop changes: %s", s.opts.Name, err)
+			select {
+			case <-time.After(s.opts.Window):
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// collect pops changes during a window after the first change.
+func (s *Syncer) collect(ctx context.Context) ([]Change, error) {
+	changes, err := s.queue.Pop(ctx, s.opts.BatchSize, s.opts.Window)
+	if err != nil || len(changes) == 0 {
+		return changes, err
+	}
+
+	deadline := time.Now().Add(s.opts.Window)
+	for len(changes) < s.opts.BatchSize {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			break
+		}
+		more, err := s.queue.Pop(ctx, s.opts.BatchSize-len(changes), wait)
+		changes = append(changes, more...)
+		if err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// Sync coalesces changes and applies them with a bulk request, failed changes are pushed
+// again after a backoff until MaxAttempts. It returns an error when changes are dropped.
+func (s *Syncer) Sync(ctx context.Context, changes []Change) error {
+	changes = s.coalesce(changes)
+
+	var (
+		reqs    []elastic.BulkableRequest
+		applied []Change
+		failed  []Change
+		errs    []error
+	)
+
+	byTable := map[string][]Change{}
+	var tables []string
+	for _, c := range changes {
+		if _, ok := byTable[c.Table]; !ok {
+			tables = append(tables, c.Table)
+		}
+		byTable[c.Table] = append(byTable[c.Table], c)
+	}
+
+	for _, table := range tables {
+		s.mu.RLock()
+		target, ok := s.targets[table]
+		s.mu.RUnlock()
+		if !ok {
+			err := xerrors.Errorf("table <%s> isn't registered", table)
+			for _, c := range byTable[table] {
+				// it never succeeds, drop it without retries
+				c.Attempt = s.opts.MaxAttempts
+				failed, errs = append(failed, c), append(errs, err)
+			}
+			continue
+		}
+
+		// a retried delete may run after a newer upsert, so the row is checked again
+		var ids []string
+		for _, c := range byTable[table] {
+			if c.Op != ChangeDelete || c.Attempt > 0 {
+				ids = append(ids, c.ID)
+			}
+		}
+
+		var docs map[string]interface{}
+		if len(ids) > 0 {
+			var err error
+			if docs, err = target.load(ctx, ids); err != nil {
+				err = xerrors.Errorf("failed to load <%s>: %w", table, err)
+				for _, c := range byTable[table] {
+					failed, errs = append(failed, c), append(errs, err)
+				}
+				continue
+			}
+		}
+
+		for _, c := range byTable[table] {
+			if doc, ok := docs[c.ID]; ok && (c.Op != ChangeDelete || c.Attempt > 0) {
+				reqs = append(reqs, elastic.NewBulkIndexRequest().Index(target.index).Id(c.ID).Doc(doc))
+			} else {
+				reqs = append(reqs, elastic.NewBulkDeleteRequest().Index(target.index).Id(c.ID))
+			}
+			applied = append(applied, c)
+		}
+	}
+
+	if len(reqs) > 0 {
+		f, e := s.bulk(ctx, reqs, applied)
+		failed, errs = append(failed, f...), append(errs, e...)
+	}
+
+	return s.retry(failed, errs)
+}
+
+// coalesce merges changes of the same row, the last operation wins.
+func (s *Syncer) coalesce(changes []Change) []Change {
+	type key struct{ table, id string }
+
+	index := map[key]int{}
+	merged := make([]Change, 0, len(changes))
+	for _, c := range changes {
+		k := key{c.Table, c.ID}
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(merged)
+			merged = append(merged, c)
+			continue
+		}
+
+		atomic.AddInt64(&s.stats.Coalesced, 1)
+		attempt := max(merged[i].Attempt, c.Attempt)
+		merged[i] = c
+		merged[i].Attempt = attempt
+	}
+	return merged
+}
+
+// bulk applies requests and returns changes which failed.
+func (s *Syncer) bulk(ctx context.Context, reqs []elastic.BulkableRequest, changes []Change) ([]Change, []error) {
+	res, err := s.cmd.Bulk(ctx, s.client.Bulk().Add(reqs...))
+	if err != nil {
+		err = xerrors.Errorf("failed to bulk: %w", err)
+		errs := make([]error, len(changes))
+		for i := range errs {
+			errs[i] = err
+		}
+		return changes, errs
+	}
+
+	resp, _ := res.Res.(*elastic.BulkResponse)
+	if resp == nil {
+		return nil, nil
+	}
+
+	var (
+		failed []Change
+		errs   []error
+	)
+	for i, items := range resp.Items {
+		if i >= len(changes) {
+			break
+		}
+		for op, item := range items {
+			switch {
+			case item.Status >= 200 && item.Status <= 299:
+			case item.Status == http.StatusNotFound && op == "delete":
+				// a missing document on deleting is fine
+			default:
+				reason := ""
+				if item.Error != nil {
+					reason = item.Error.Type + ": " + item.Error.Reason
+				}
+				failed = append(failed, changes[i])
+				errs = append(errs, xerrors.Errorf("bulk item <%s/%s> failed %d: %s", item.Index, item.Id, item.Status, reason))
+				continue
+			}
+
+			if op == "delete" {
+				atomic.AddInt64(&s.stats.Deleted, 1)
+			} else {
+				atomic.AddInt64(&s.stats.Indexed, 1)
+			}
+		}
+	}
+	return failed, errs
+}
+
+// retry schedules failed changes, changes which exceeded MaxAttempts are dropped.
+func (s *Syncer) retry(failed []Change, errs []error) error {
+	var (
+		dropped int
+		cause   error
+	)
+	for i, c := range failed {
+		c.Attempt++
+		if c.Attempt >= s.opts.MaxAttempts {
+			s.drop(c, errs[i])
+			if dropped == 0 {
+				cause = errs[i]
+			}
+			dropped++
+			continue
+		}
+		s.schedule(c)
+	}
+
+	if dropped > 0 {
+		return xerrors.Errorf("%d changes were dropped, e.g. %w", dropped, cause)
+	}
+	return nil
+}
+
+// schedule pushes a change again after a backoff, it doesn't block a consumer of the queue.
+func (s *Syncer) schedule(c Change) {
+	s.retryMu.Lock()
+	defer s.retryMu.Unlock()
+
+	var t *time.Timer
+	s.retryWG.Add(1)
+	t = time.AfterFunc(s.backoff(c.Attempt), func() {
+		defer s.retryWG.Done()
+
+		s.retryMu.Lock()
+		delete(s.retries, t)
+		s.retryMu.Unlock()
+
+		s.requeue(c)
+	})
+	s.retries[t] = c
+}
+
+// flushRetries pushes changes which wait for a backoff immediately.
+func (s *Syncer) flushRetries() {
+	s.retryMu.Lock()
+	var pending []Change
+	for t, c := range s.retries {
+		if t.Stop() {
+			pending = append(pending, c)
+			s.retryWG.Done()
+		}
+		delete(s.retries, t)
+	}
+	s.retryMu.Unlock()
+
+	for _, c := range pending {
+		s.requeue(c)
+	}
+	s.retryWG.Wait()
+}
+
+// requeue pushes a change within a window, it's dropped when the queue stays full.
+func (s *Syncer) requeue(c Change) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.Window)
+	defer cancel()
+
+	if err := s.queue.Push(ctx, c); err != nil {
+		s.drop(c, xerrors.Errorf("failed to retry: %w", err))
+		return
+	}
+	atomic.AddInt64(&s.stats.Retried, 1)
+}
+
+// backoff returns a delay of a retry by attempts.
+func (s *Syncer) backoff(attempt int) time.Duration {
+	d := s.opts.Backoff
+	for i := 1; i < attempt && d < s.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, s.opts.MaxBackoff)
+}
+
+func (s *Syncer) drop(c Change, err error) {
+	atomic.AddInt64(&s.stats.Dropped, 1)
+
+	if s.opts.OnFailure != nil {
+		s.opts.OnFailure(c, err)
+		return
+	}
+
+	logger.Printf("[WARN] syncer <%s> dropped <%s/%s %s>: %s", s.opts.Name, c.Table, c.ID, c.Op, err)
+}
@@ -0,0 +1,222 @@
+package search
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/data/search/searchtest"
+)
+
+func TestSyncer(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	client := srv.Client()
+	ctx := context.Background()
+
+	if _, err := client.Index().Index("companies").Id("3").BodyJson(testCompany{Name: "gone"}).Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu    sync.Mutex
+		loads [][]string
+	)
+	rows := map[string]interface{}{
+		"1": testCompany{Name: "eiicon"},
+		"2": testCompany{Name: "acme"},
+	}
+	load := func(_ context.Context, ids []string) (map[string]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		loads = append(loads, ids)
+
+		docs := map[string]interface{}{}
+		for _, id := range ids {
+			if doc, ok := rows[id]; ok {
+				docs[id] = doc
+			}
+		}
+		return docs, nil
+	}
+
+	queue := NewMemoryChangeQueue(100)
+	syncer := NewSyncer(newCommand(testEnv{}, nil), client, queue, SyncOptions{Window: 50 * time.Millisecond})
+	syncer.Register("companies", "companies", load)
+
+	err := queue.Push(ctx,
+		Change{Table: "companies", ID: "1", Op: ChangeUpsert},
+		Change{Table: "companies", ID: "2", Op: ChangeUpsert},
+		Change{Table: "companies", ID: "1", Op: ChangeUpsert},
+		Change{Table: "companies", ID: "3", Op: ChangeUpsert},
+		Change{Table: "companies", ID: "4", Op: ChangeDelete},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- syncer.Run(runCtx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.Source("companies", "2") == nil || srv.Source("companies", "3") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("syncer didn't apply changes")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if srv.Source("companies", "1")["name"] != "eiicon" {
+		t.Errorf("document error: %v", srv.Source("companies", "1"))
+	}
+
+	mu.Lock()
+	if len(loads) != 1 || len(loads[0]) != 3 {
+		t.Errorf("loads must be coalesced: %v", loads)
+	}
+	mu.Unlock()
+
+	stats := syncer.Stats()
+	if stats.Indexed != 2 || stats.Deleted != 2 || stats.Coalesced != 1 || stats.Dropped != 0 {
+		t.Errorf("stats error: %+v", stats)
+	}
+}
+
+func TestSyncerRetry(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	ctx := context.Background()
+
+	calls := 0
+	load := func(_ context.Context, ids []string) (map[string]interface{}, error) {
+		calls++
+		if calls < 2 {
+			return nil, xerrors.New("db is down")
+		}
+		return map[string]interface{}{"1": testCompany{Name: "eiicon"}}, nil
+	}
+
+	var dropped []Change
+	queue := NewMemoryChangeQueue(10)
+	syncer := NewSyncer(newCommand(testEnv{}, nil), srv.Client(), queue, SyncOptions{
+		MaxAttempts: 2,
+		Backoff:     time.Millisecond,
+		OnFailure:   func(c Change, _ error) { dropped = append(dropped, c) },
+	})
+	syncer.Register("companies", "companies", load)
+
+	if err := syncer.Sync(ctx, []Change{{Table: "companies", ID: "1", Op: ChangeUpsert}}); err != nil {
+		t.Fatalf("first failure must be retried: %s", err)
+	}
+	retried, err := queue.Pop(ctx, 10, time.Second)
+	if err != nil || len(retried) != 1 || retried[0].Attempt != 1 {
+		t.Fatalf("retry error: %v %s", retried, err)
+	}
+	if err := syncer.Sync(ctx, retried); err != nil {
+		t.Fatalf("retry failed: %s", err)
+	}
+	if srv.Source("companies", "1") == nil {
+		t.Error("document must be indexed by retry")
+	}
+
+	// unknown tables are dropped without retries
+	if err := syncer.Sync(ctx, []Change{{Table: "users", ID: "1", Op: ChangeUpsert}}); err == nil {
+		t.Error("unknown table must fail")
+	}
+	if len(dropped) != 1 || dropped[0].Table != "users" {
+		t.Errorf("dropped error: %v", dropped)
+	}
+	if stats := syncer.Stats(); stats.Retried != 1 || stats.Dropped != 1 || stats.Indexed != 1 {
+		t.Errorf("stats error: %+v", stats)
+	}
+}
+
+func TestSyncerRetryFullQueue(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	ctx := context.Background()
+
+	rows := map[string]interface{}{}
+	failing := true
+	var mu sync.Mutex
+	load := func(_ context.Context, ids []string) (map[string]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing {
+			return nil, xerrors.New("db is down")
+		}
+		docs := map[string]interface{}{}
+		for _, id := range ids {
+			if doc, ok := rows[id]; ok {
+				docs[id] = doc
+			}
+		}
+		return docs, nil
+	}
+
+	dropped := make(chan Change, 10)
+	queue := NewMemoryChangeQueue(1)
+	syncer := NewSyncer(newCommand(testEnv{}, nil), srv.Client(), queue, SyncOptions{
+		Window:    50 * time.Millisecond,
+		Backoff:   time.Millisecond,
+		OnFailure: func(c Change, _ error) { dropped <- c },
+	})
+	syncer.Register("companies", "companies", load)
+
+	// the queue is full, a retry must not block the consumer
+	if err := queue.Push(ctx, Change{Table: "companies", ID: "9", Op: ChangeUpsert}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- syncer.Sync(ctx, []Change{{Table: "companies", ID: "1", Op: ChangeUpsert}}) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("failure must be retried: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("sync blocked on a full queue")
+	}
+	select {
+	case c := <-dropped:
+		if c.ID != "1" || c.Attempt != 1 {
+			t.Errorf("dropped error: %+v", c)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("change must be dropped when the queue stays full")
+	}
+
+	// a retried delete indexes a row which was created again
+	mu.Lock()
+	failing, rows["2"] = false, testCompany{Name: "eiicon"}
+	mu.Unlock()
+	if err := syncer.Sync(ctx, []Change{{Table: "companies", ID: "2", Op: ChangeDelete, Attempt: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Source("companies", "2") == nil {
+		t.Error("retried delete must check the row again")
+	}
+}
+
+func TestSyncerBackoff(t *testing.T) {
+	t.Helper()
+
+	syncer := NewSyncer(nil, nil, NewMemoryChangeQueue(1), SyncOptions{Backoff: time.Second, MaxBackoff: 10 * time.Second})
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 100: 10 * time.Second} {
+		if got := syncer.backoff(attempt); got != want {
+			t.Errorf("backoff %d = %s, want %s", attempt, got, want)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/util/logger"
+)
+
+// DefaultPollInterval is an interval which Task.Wait polls a task by.
+const DefaultPollInterval = time.Second
+
+type (
+	// ByQueryOptions configures delete_by_query and update_by_query.
+	ByQueryOptions struct {
+		// RequestsPerSecond throttles batches of the task, zero is unlimited.
+		RequestsPerSecond int
+		// Slices splits the task into parallel slices, zero is "auto".
+		Slices int
+		// ScrollSize is a number of documents in a batch, default 1000 by elasticsearch.
+		ScrollSize int
+		// Proceed counts version conflicts instead of aborting the task.
+		Proceed bool
+		// Refresh refreshes all of shards after the task completes.
+		Refresh bool
+	}
+
+	// TaskStatus is a progress of delete_by_query, update_by_query or reindex.
+	TaskStatus struct {
+		ID                string   `json:"-"`
+		Completed         bool     `json:"-"`
+		Cancelled         bool     `json:"-"`
+		Total             int64    `json:"total"`
+		Created           int64    `json:"created"`
+		Updated           int64    `json:"updated"`
+		Deleted           int64    `json:"deleted"`
+		Batches           int64    `json:"batches"`
+		VersionConflicts  int64    `json:"version_conflicts"`
+		Noops             int64    `json:"noops"`
+		RequestsPerSecond float64  `json:"requests_per_second"`
+		ThrottledMillis   int64    `json:"throttled_millis"`
+		Failures          []string `json:"-"`
+	}
+
+	// Task is a background task which is submitted to a cluster.
+	//
+	//	task, err := cmd.DeleteByQuery(ctx, client, "companies", query, search.ByQueryOptions{RequestsPerSecond: 500})
+	//	status, err := task.Wait(ctx, 0, func(s *search.TaskStatus) { log.Printf("%.0f%%", s.Progress()*100) })
+	Task struct {
+		ID     string
+		action string
+		client *elastic.Client
+		cmd    *command
+	}
+
+	// taskResponse is a response of GET _tasks/{id}
+	taskResponse struct {
+		Completed bool `json:"completed"`
+		Task      struct {
+			Status    json.RawMessage `json:"status"`
+			Cancelled bool            `json:"cancelled"`
+		} `json:"task"`
+		Response *struct {
+			Canceled string            `json:"canceled"`
+			Failures []json.RawMessage `json:"failures"`
+		} `json:"response"`
+		Error *elastic.ErrorDetails `json:"error"`
+	}
+)
+
+// Progress returns a ratio of processed documents, it's zero until the total is known.
+func (s *TaskStatus) Progress() float64 {
+	if s == nil || s.Total == 0 {
+		return 0
+	}
+	done := s.Created + s.Updated + s.Deleted + s.VersionConflicts + s.Noops
+	return min(float64(done)/float64(s.Total), 1)
+}
+
+// NewTask returns a task which was submitted already, action is "_delete_by_query",
+// "_update_by_query" or "_reindex" which is used by Rethrottle.
+func NewTask(client *elastic.Client, action, id string) *Task {
+	return &Task{ID: id, action: action, client: client}
+}
+
+// newTask returns a task which requests are traced by the command.
+func (c *command) newTask(client *elastic.Client, action, id string) *Task {
+	t := NewTask(client, action, id)
+	t.cmd = c
+	return t
+}
+
+// do calls fn through the command which submitted the task, an error is returned as *Error.
+func (t *Task) do(ctx context.Context, op string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	if t.cmd == nil {
+		res, err := fn(ctx)
+		return res, newError(op, "", err)
+	}
+
+	res, err := t.cmd.do(ctx, op, "", fn)
+	if err != nil {
+		return nil, err
+	}
+	return res.Res, nil
+}
+
+// Status returns a current progress of the task.
+func (t *Task) Status(ctx context.Context) (*TaskStatus, error) {
+	res, err := t.do(ctx, "task_status", func(ctx context.Context) (interface{}, error) {
+		return t.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+			Method: http.MethodGet,
+			Path:   "/_tasks/" + url.PathEscape(t.ID),
+		})
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get task <%s>: %w", t.ID, err)
+	}
+	body := res.(*elastic.Response).Body
+
+	var tr taskResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return nil, xerrors.Errorf("failed to decode task <%s>: %w", t.ID, err)
+	}
+
+	status := &TaskStatus{}
+	if len(tr.Task.Status) > 0 {
+		if err := json.Unmarshal(tr.Task.Status, status); err != nil {
+			return nil, xerrors.Errorf("failed to decode status of task <%s>: %w", t.ID, err)
+		}
+	}
+	status.ID, status.Completed, status.Cancelled = t.ID, tr.Completed, tr.Task.Cancelled
+
+	if tr.Error != nil {
+		status.Failures = append(status.Failures, tr.Error.Type+": "+tr.Error.Reason)
+	}
+	if tr.Response != nil {
+		if tr.Response.Canceled != "" {
+			status.Cancelled = true
+		}
+		for _, f := range tr.Response.Failures {
+			status.Failures = append(status.Failures, string(f))
+		}
+	}
+	return status, nil
+}
+
+// Wait polls the task until it completes and calls progress on each poll, interval is
+// DefaultPollInterval when it's zero. The task is cancelled when ctx is done.
+func (t *Task) Wait(ctx context.Context, interval time.Duration, progress func(*TaskStatus)) (*TaskStatus, error) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last *TaskStatus
+	for {
+		status, err := t.Status(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return last, t.abort(ctx.Err())
+		case err != nil:
+			return last, err
+		}
+
+		last = status
+		if progress != nil {
+			progress(status)
+		}
+
+		if status.Completed {
+			switch {
+			case status.Cancelled:
+				return status, xerrors.Errorf("task <%s> was cancelled", t.ID)
+			case len(status.Failures) > 0:
+				return status, xerrors.Errorf("task <%s> completed with %d failures: %s", t.ID, len(status.Failures), status.Failures[0])
+			}
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return last, t.abort(ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// abort cancels the task after ctx is done, it doesn't wait for the cancellation.
+func (t *Task) abort(cause error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := t.Cancel(ctx); err != nil {
+		logger.Printf("[WARN] es task %s wasn't cancelled: %s", t.ID, err)
+	}
+	return xerrors.Errorf("task <%s> was aborted: %w", t.ID, cause)
+}
+
+// Cancel requests cancellation of the task.
+func (t *Task) Cancel(ctx context.Context) error {
+	_, err := t.do(ctx, "task_cancel", func(ctx context.Context) (interface{}, error) {
+		return t.client.TasksCancel().TaskId(t.ID).Do(ctx)
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to cancel task <%s>: %w", t.ID, err)
+	}
+	return nil
+}
+
+// Rethrottle changes requests_per_second of the running task, zero is unlimited.
+func (t *Task) Rethrottle(ctx context.Context, requestsPerSecond int) error {
+	if t.action == "" {
+		return xerrors.Errorf("task <%s> has no action to rethrottle", t.ID)
+	}
+
+	_, err := t.do(ctx, "task_rethrottle", func(ctx context.Context) (interface{}, error) {
+		return t.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+			Method: http.MethodPost,
+			Path:   fmt.Sprintf("/%s/%s/_rethrottle", t.action, url.PathEscape(t.ID)),
+			Params: url.Values{"requests_per_second": []string{strconv.Itoa(throttle(requestsPerSecond))}},
+		})
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to rethrottle task <%s>: %w", t.ID, err)
+	}
+	return nil
+}
+
+// throttle returns requests_per_second, -1 is unlimited on elasticsearch.
+func throttle(rps int) int {
+	if rps <= 0 {
+		return -1
+	}
+	return rps
+}
+
+// slices returns slices of ByQueryOptions.
+func (o ByQueryOptions) slices() interface{} {
+	if o.Slices > 0 {
+		return o.Slices
+	}
+	return "auto"
+}
+
+// refresh returns refresh of ByQueryOptions.
+func (o ByQueryOptions) refresh() string {
+	return strconv.FormatBool(o.Refresh)
+}
@@ -0,0 +1,153 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"golang.org/x/xerrors"
+
+	"github.com/eiicon-company/go-core/data/search/searchtest"
+)
+
+func seedTasks(t *testing.T, cmd Command, client *elastic.Client) {
+	t.Helper()
+
+	ctx := context.Background()
+	for i, tags := range [][]string{{"hr"}, {"it"}, {"hr", "it"}} {
+		doc, _ := json.Marshal(testCompany{Tags: tags})
+		if _, err := cmd.PostDocument(ctx, client, "companies", i+1, string(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestByQuery(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	client := srv.Client()
+	cmd := newCommand(testEnv{}, nil)
+	ctx := context.Background()
+	seedTasks(t, cmd, client)
+
+	task, err := cmd.UpdateByQuery(ctx, client, "companies", elastic.NewTermQuery("tags", "it"), nil, ByQueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := task.Wait(ctx, 10*time.Millisecond, nil)
+	if err != nil || !status.Completed || status.Updated != 2 || status.Progress() != 1 {
+		t.Errorf("update by query error: %+v %s", status, err)
+	}
+
+	var polls []*TaskStatus
+	task, err = cmd.DeleteByQuery(ctx, client, "companies", elastic.NewTermQuery("tags", "hr"), ByQueryOptions{RequestsPerSecond: 100, Proceed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err = task.Wait(ctx, 10*time.Millisecond, func(s *TaskStatus) { polls = append(polls, s) })
+	if err != nil || status.Deleted != 2 || status.RequestsPerSecond != 100 || len(polls) != 1 {
+		t.Errorf("delete by query error: %+v %d %s", status, len(polls), err)
+	}
+	if srv.Source("companies", "1") != nil || srv.Source("companies", "2") == nil {
+		t.Error("documents must be deleted by query")
+	}
+
+	if _, err := cmd.DeleteByQuery(ctx, client, "users", nil, ByQueryOptions{}); err == nil {
+		t.Error("missing index must fail")
+	}
+}
+
+func TestTaskCancel(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	client := srv.Client()
+	cmd := newCommand(testEnv{}, nil)
+	seedTasks(t, cmd, client)
+	srv.HoldTasks(true)
+
+	task, err := cmd.DeleteByQuery(context.Background(), client, "companies", nil, ByQueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Rethrottle(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var polls []*TaskStatus
+	status, err := task.Wait(ctx, 10*time.Millisecond, func(s *TaskStatus) {
+		polls = append(polls, s)
+		if len(polls) == 2 {
+			cancel()
+		}
+	})
+	if !xerrors.Is(err, context.Canceled) {
+		t.Fatalf("wait must be aborted: %s", err)
+	}
+	if status == nil || status.Completed || status.Total != 3 || status.RequestsPerSecond != 10 {
+		t.Errorf("running status error: %+v", status)
+	}
+
+	status, err = task.Status(context.Background())
+	if err != nil || !status.Completed || !status.Cancelled {
+		t.Errorf("task must be cancelled: %+v %s", status, err)
+	}
+
+	srv.HoldTasks(false)
+	if srv.Source("companies", "1") == nil {
+		t.Error("cancelled task must not delete documents")
+	}
+}
+
+func TestTaskError(t *testing.T) {
+	t.Helper()
+
+	srv := searchtest.NewServer(t)
+	client := srv.Client()
+	tracer := NewTracer(0)
+	cmd := newCommand(testEnv{}, tracer)
+	ctx := context.Background()
+	seedTasks(t, cmd, client)
+	srv.HoldTasks(true)
+
+	task, err := cmd.DeleteByQuery(ctx, client, "companies", nil, ByQueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer.Reset()
+	if _, err := task.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Rethrottle(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Cancel(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	for _, tm := range tracer.Timings() {
+		count += tm.Count
+	}
+	if count != 3 {
+		t.Errorf("task requests must be traced: %#+v", tracer.Timings())
+	}
+
+	var e *Error
+	for _, task := range []*Task{NewTask(client, "_delete_by_query", "searchtest:999"), cmd.(*command).newTask(client, "_delete_by_query", "searchtest:999")} {
+		_, err := task.Status(ctx)
+		if !xerrors.As(err, &e) || e.Op != "task_status" || !IsNotFound(err) {
+			t.Errorf("missing task status must be *Error: %#+v", err)
+		}
+		if err := task.Rethrottle(ctx, 10); !xerrors.As(err, &e) || e.Op != "task_rethrottle" {
+			t.Errorf("missing task rethrottle must be *Error: %#+v", err)
+		}
+		if err := task.Cancel(ctx); !xerrors.As(err, &e) || e.Op != "task_cancel" {
+			t.Errorf("missing task cancel must be *Error: %#+v", err)
+		}
+	}
+}
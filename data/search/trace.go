@@ -0,0 +1,181 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+
+	"github.com/eiicon-company/go-core/util"
+	"github.com/eiicon-company/go-core/util/logger"
+)
+
+// DefaultSlowQuery is a threshold of slow query logging when ESSLOWQUERY is blank.
+const DefaultSlowQuery = time.Second
+
+type (
+	// Timing is counters of commands on an index.
+	Timing struct {
+		// Count is a number of commands.
+		Count int64
+		// Errors is a number of commands which returned an error.
+		Errors int64
+		// Slow is a number of commands which took longer than the slow query threshold.
+		Slow int64
+		// Total is a sum of durations.
+		Total time.Duration
+		// Max is the longest duration.
+		Max time.Duration
+	}
+
+	// Tracer instruments Command with sentry spans, slow query logging and timing per index.
+	//
+	// Commands make a child span when a context has a sentry span, or a span like
+	// util.DBSlowQuery when a command is slower than SlowQuery. Request bodies are
+	// available when a client is given by util.ESConn or util.ESBulkConn.
+	Tracer struct {
+		// SlowQuery is a threshold of slow query logging, zero or negative disables it.
+		SlowQuery time.Duration
+
+		mu      sync.Mutex
+		timings map[string]*Timing
+	}
+)
+
+// Average returns a mean duration of commands.
+func (t Timing) Average() time.Duration {
+	if t.Count == 0 {
+		return 0
+	}
+	return t.Total / time.Duration(t.Count)
+}
+
+// NewTracer returns Tracer which logs commands slower than slow.
+func NewTracer(slow time.Duration) *Tracer {
+	return &Tracer{SlowQuery: slow, timings: map[string]*Timing{}}
+}
+
+// Timings returns a snapshot of counters by index, "_all" is for commands without index.
+func (t *Tracer) Timings() map[string]Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m := make(map[string]Timing, len(t.timings))
+	for ix, tm := range t.timings {
+		m[ix] = *tm
+	}
+	return m
+}
+
+// Reset clears counters, e.g. after metrics are sent.
+func (t *Tracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timings = map[string]*Timing{}
+}
+
+// Trace runs fn as an op on index, index is taken from a request path when it's blank.
+func (t *Tracer) Trace(ctx context.Context, op, index string, fn func(ctx context.Context) error) error {
+	// a body is recorded only when it may be shown by a slow query log or a span
+	ctx, req := util.WithESRequest(ctx, t.SlowQuery > 0 || sentry.SpanFromContext(ctx) != nil)
+
+	start := time.Now()
+	err := fn(ctx)
+	took := time.Since(start)
+
+	if index == "" {
+		index = requestIndex(req.Path())
+	}
+	slow := t.SlowQuery > 0 && took > t.SlowQuery
+
+	t.record(index, took, err != nil, slow)
+
+	if slow {
+		msg := "[WARN] es slow query %s <%s> took %s: %s %s %s"
+		logger.Printf(msg, op, index, took, req.Method(), req.Path(), req.Body())
+	}
+	if slow || sentry.SpanFromContext(ctx) != nil {
+		t.span(ctx, op, index, req, start, took, err, slow)
+	}
+
+	return err
+}
+
+func (t *Tracer) record(index string, took time.Duration, failed, slow bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tm, ok := t.timings[index]
+	if !ok {
+		tm = &Timing{}
+		t.timings[index] = tm
+	}
+
+	tm.Count++
+	tm.Total += took
+	if took > tm.Max {
+		tm.Max = took
+	}
+	if failed {
+		tm.Errors++
+	}
+	if slow {
+		tm.Slow++
+	}
+}
+
+// span applies it with sentry span
+//
+// https://develop.sentry.dev/sdk/performance/span-operations/#database
+func (t *Tracer) span(ctx context.Context, op, index string, req *util.ESRequest, start time.Time, took time.Duration, err error, slow bool) {
+	name := "db.elasticsearch"
+	if slow {
+		name += ".slow"
+	}
+
+	span := sentry.StartSpan(ctx, name, func(s *sentry.Span) {
+		s.StartTime = start
+		s.EndTime = start.Add(took)
+		s.Description = op + " " + index
+		s.Status = sentry.SpanStatusOK
+		if err != nil {
+			s.Status = sentry.SpanStatusInternalError
+		}
+	})
+	span.SetData("db.system", "elasticsearch")
+	span.SetData("db.operation", op)
+	span.SetData("db.name", index)
+	if req.Path() != "" {
+		span.SetData("http.method", req.Method())
+		span.SetData("url.path", req.Path())
+	}
+	if req.Body() != "" {
+		span.SetData("db.statement", req.Body())
+	}
+	span.Finish()
+}
+
+// requestIndex returns an index of a request path. e.g. /companies/_search => companies
+func requestIndex(path string) string {
+	ix, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if ix == "" || strings.HasPrefix(ix, "_") {
+		return "_all"
+	}
+	return ix
+}
+
+func newTracer(env util.Environment) *Tracer {
+	slow := DefaultSlowQuery
+	if v := env.EnvString("ESSLOWQUERY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			logger.Printf("[WARN] invalid ESSLOWQUERY <%s>, %s is used: %s", v, slow, err)
+		} else {
+			slow = d
+		}
+	}
+
+	return NewTracer(slow)
+}
@@ -0,0 +1,162 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+
+	"github.com/eiicon-company/go-core/util"
+)
+
+type testEnv struct {
+	util.Environment
+}
+
+func (testEnv) IsDebug() bool { return false }
+
+func TestTracer(t *testing.T) {
+	t.Helper()
+
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/":
+			fmt.Fprint(w, `{"version":{"number":"7.17.9"}}`)
+		case strings.HasSuffix(r.URL.Path, "/_search"):
+			fmt.Fprint(w, `{"took":1,"hits":{"total":{"value":0},"hits":[]}}`)
+		case strings.HasSuffix(r.URL.Path, "/_settings"):
+			fmt.Fprint(w, `{"companies_1700000000000000000":{"settings":{}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"type":"index_not_found_exception"},"status":404}`)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := util.SelectESConn("es://"+strings.TrimPrefix(srv.URL, "http://")+"/?sniff=false&healthcheck=false", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracer := NewTracer(time.Nanosecond)
+	cmd := newCommand(testEnv{}, tracer)
+	ctx := context.Background()
+
+	q := NewQuery().Term("tags", "hr")
+	if _, err := cmd.Search(ctx, q.Service(client, "companies")); err != nil {
+		t.Fatalf("search failed: %s", err)
+	}
+	names, err := cmd.ListIndexNames(ctx, client)
+	if err != nil || len(names) != 1 {
+		t.Fatalf("list failed: %v %s", names, err)
+	}
+	if _, err := cmd.DeleteIndex(ctx, client, "missing"); err == nil {
+		t.Fatal("delete must fail")
+	}
+
+	timings := tracer.Timings()
+	if tm := timings["companies"]; tm.Count != 1 || tm.Slow != 1 || tm.Errors != 0 || tm.Max <= 0 {
+		t.Errorf("companies timing error: %#+v", tm)
+	}
+	if tm := timings["_all"]; tm.Count != 1 {
+		t.Errorf("_all timing error: %#+v", tm)
+	}
+	if tm := timings["missing"]; tm.Count != 1 || tm.Errors != 1 {
+		t.Errorf("missing timing error: %#+v", tm)
+	}
+
+	// the body is still sent after recording
+	mu.Lock()
+	found := false
+	for _, b := range bodies {
+		found = found || strings.Contains(b, `"tags":"hr"`)
+	}
+	mu.Unlock()
+	if !found {
+		t.Errorf("search body wasn't sent: %v", bodies)
+	}
+
+	tracer.Reset()
+	if len(tracer.Timings()) != 0 {
+		t.Error("reset error")
+	}
+}
+
+func TestTracerRequestBody(t *testing.T) {
+	t.Helper()
+
+	var (
+		mu   sync.Mutex
+		sent int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		sent = len(b)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"took":1,"errors":false,"items":[]}`)
+	}))
+	defer srv.Close()
+
+	client, err := util.SelectESConn("es://"+strings.TrimPrefix(srv.URL, "http://")+"/?sniff=false&healthcheck=false", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := strings.Repeat(`{"index":{"_index":"companies"}}`+"\n"+`{"name":"eiicon"}`+"\n", 1000)
+	for _, withBody := range []bool{true, false} {
+		ctx, req := util.WithESRequest(context.Background(), withBody)
+		if _, err := client.PerformRequest(ctx, elastic.PerformRequestOptions{Method: "POST", Path: "/_bulk", Body: body}); err != nil {
+			t.Fatalf("bulk failed: %s", err)
+		}
+
+		// only a head of the body is recorded, and the whole of it is still sent
+		mu.Lock()
+		if sent != len(body) {
+			t.Errorf("bulk body wasn't sent entirely: %d/%d", sent, len(body))
+		}
+		mu.Unlock()
+		if req.Path() != "/_bulk" {
+			t.Errorf("request path error: %s", req.Path())
+		}
+		if want := map[bool]int{true: util.ESRequestBodyLimit, false: 0}[withBody]; len(req.Body()) != want {
+			t.Errorf("request body error with %v: %d", withBody, len(req.Body()))
+		}
+	}
+}
+
+func TestRequestIndex(t *testing.T) {
+	t.Helper()
+
+	for path, want := range map[string]string{
+		"/companies/_search":      "companies",
+		"/companies/_doc/1":       "companies",
+		"/_bulk":                  "_all",
+		"/_all/_settings":         "_all",
+		"":                        "_all",
+		"/companies,users/_count": "companies,users",
+	} {
+		if got := requestIndex(path); got != want {
+			t.Errorf("requestIndex(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package util
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
@@ -148,59 +150,108 @@ func DBSlowQuery(dialect string, period time.Duration) {
 	}))
 }
 
-// ESConn returns established connection
+// ESConn returns established connection, ESURL is a dsn.ES uri.
 func ESConn(env Environment) (*elastic.Client, error) {
-	var op []elastic.ClientOptionFunc
-	op = append(op, elastic.SetHttpClient(&http.Client{Timeout: 30 * time.Second}))
-	op = append(op, elastic.SetURL(env.EnvString("ESURL")))
-	op = append(op, elastic.SetSniff(true))
-	op = append(op, elastic.SetHealthcheck(true))
-	op = append(op, elastic.SetErrorLog(&logger.SentryErrorLogger{}))
-	// 8 retries with fixed delay of 100ms, 200ms, 300ms, 400ms, 500ms, 600ms, 700ms, and 800ms.
-	op = append(op, elastic.SetRetrier(elastic.NewBackoffRetrier(elastic.NewSimpleBackoff(100, 200, 300, 400, 600, 700, 800))))
+	return SelectESConn(env.EnvString("ESURL"), env.IsDebug())
+}
 
-	if env.IsDebug() {
-		op = append(op, elastic.SetTraceLog(log.New(os.Stderr, "[[ELASTIC]] ", log.LstdFlags)))
-		op = append(op, elastic.SetInfoLog(log.New(os.Stdout, "[ELASTIC] ", log.LstdFlags)))
-	}
+// ESBulkConn returns established connection which has longer timeout for bulk requests
+func ESBulkConn(env Environment) (*elastic.Client, error) {
+	return SelectESBulkConn(env.EnvString("ESURL"), env.IsDebug())
+}
 
-	return esConn(env, op...)
+// SelectESConn can choose es connection
+func SelectESConn(uri string, debug bool) (*elastic.Client, error) {
+	d, err := dsn.ES(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid es uri <%s>: %s", uri, err)
+	}
+	return esConn(d, d.Timeout, debug)
 }
 
-// ESBulkConn returns established connection
-func ESBulkConn(env Environment) (*elastic.Client, error) {
-	var op []elastic.ClientOptionFunc
-	op = append(op, elastic.SetHttpClient(&http.Client{Timeout: 360 * time.Second}))
-	op = append(op, elastic.SetURL(env.EnvString("ESURL")))
-	op = append(op, elastic.SetSniff(true))
-	op = append(op, elastic.SetHealthcheck(true))
-	op = append(op, elastic.SetErrorLog(&logger.SentryErrorLogger{}))
-	// 8 retries with fixed delay of 100ms, 200ms, 300ms, 400ms, 500ms, 600ms, 700ms, and 800ms.
-	op = append(op, elastic.SetRetrier(elastic.NewBackoffRetrier(elastic.NewSimpleBackoff(100, 200, 300, 400, 600, 700, 800))))
+// SelectESBulkConn can choose es connection for bulk requests
+func SelectESBulkConn(uri string, debug bool) (*elastic.Client, error) {
+	d, err := dsn.ES(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid es uri <%s>: %s", uri, err)
+	}
+	return esConn(d, d.BulkTimeout, debug)
+}
 
-	if env.IsDebug() {
+func esConn(d *dsn.ESDSN, timeout time.Duration, debug bool) (*elastic.Client, error) {
+	op, err := esOptions(d, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if debug {
 		op = append(op, elastic.SetTraceLog(log.New(os.Stderr, "[[ELASTIC]] ", log.LstdFlags)))
 		op = append(op, elastic.SetInfoLog(log.New(os.Stdout, "[ELASTIC] ", log.LstdFlags)))
 	}
 
-	return esConn(env, op...)
-}
-
-func esConn(env Environment, op ...elastic.ClientOptionFunc) (*elastic.Client, error) {
 	es, err := elastic.NewClient(op...)
 	if err != nil {
-		return nil, fmt.Errorf("uninitialized es client <%s>: %s", env.EnvString("ESURL"), err)
+		return nil, fmt.Errorf("uninitialized es client <%s>: %s", d.URL(), err)
 	}
-	ver, err := es.ElasticsearchVersion(env.EnvString("ESURL"))
+	ver, err := es.ElasticsearchVersion(d.URL())
 	if err != nil {
-		return nil, fmt.Errorf("error got es version <%s>: %s", env.EnvString("ESURL"), err)
+		return nil, fmt.Errorf("error got es version <%s>: %s", d.URL(), err)
 	}
 
-	msg := "[INFO] the elasticsearch connection established <%s>, version %s"
-	logger.Printf(msg, env.EnvString("ESURL"), ver)
+	product := "elasticsearch"
+	if d.OpenSearch {
+		product = "opensearch"
+	}
+
+	msg := "[INFO] the %s connection established <%s>, version %s"
+	logger.Printf(msg, product, strings.Join(d.URLs, ","), ver)
 	return es, nil
 }
 
+func esOptions(d *dsn.ESDSN, timeout time.Duration) ([]elastic.ClientOptionFunc, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if d.CACert != "" || d.Insecure {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if d.CACert != "" {
+			pem, err := os.ReadFile(d.CACert)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read es ca <%s>: %s", d.CACert, err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("invalid es ca <%s>", d.CACert)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		tlsConfig.InsecureSkipVerify = d.Insecure //#nosec G402
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	var rt http.RoundTripper = transport
+	if d.SigV4 != "" {
+		rt = newSigV4Transport(transport, d.Sess, d.SigV4)
+	}
+	rt = &esRequestTransport{base: rt}
+
+	var op []elastic.ClientOptionFunc
+	op = append(op, elastic.SetHttpClient(&http.Client{Timeout: timeout, Transport: rt}))
+	op = append(op, elastic.SetURL(d.URLs...))
+	op = append(op, elastic.SetSniff(d.Sniff))
+	op = append(op, elastic.SetHealthcheck(d.Healthcheck))
+	op = append(op, elastic.SetGzip(d.Gzip))
+	op = append(op, elastic.SetErrorLog(&logger.SentryErrorLogger{}))
+	// 8 retries with fixed delay of 100ms, 200ms, 300ms, 400ms, 500ms, 600ms, 700ms, and 800ms.
+	op = append(op, elastic.SetRetrier(elastic.NewBackoffRetrier(elastic.NewSimpleBackoff(100, 200, 300, 400, 600, 700, 800))))
+
+	switch {
+	case d.APIKey != "":
+		op = append(op, elastic.SetHeaders(http.Header{"Authorization": []string{"ApiKey " + d.APIKey}}))
+	case d.User != "":
+		op = append(op, elastic.SetBasicAuth(d.User, d.Password))
+	}
+
+	return op, nil
+}
+
 // RedisConn returns established connection
 func RedisConn(env Environment) (*radix.Pool, error) {
 	return SelectRedisConn(env.EnvString("RedisURI"))
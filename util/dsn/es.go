@@ -0,0 +1,172 @@
+package dsn
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"golang.org/x/xerrors"
+)
+
+// ESDSN es://user:pass@host1:9200,host2:9200/?sniff=false&timeout=30s
+// or http://localhost:9200 which is a legacy ESURL
+//
+// Options
+//
+//	tls=true uses https, tls=skip-verify uses https without certificate verification
+//	ca=%2Fpath%2Fto%2Fca.pem verifies server certificate by the CA (url escaped)
+//	apikey=<base64 id:key> authenticates by API key instead of basic auth
+//	sniff=false doesn't discover nodes, turn it off behind load balancers and on managed clusters (default: true)
+//	healthcheck=false doesn't check nodes periodically (default: true)
+//	timeout=30s is a request timeout of ESConn (default: 30s)
+//	bulktimeout=360s is a request timeout of ESBulkConn (default: 360s)
+//	gzip=true compresses request bodies
+//	opensearch=true connects to OpenSearch, sniff is off by default
+//	sigv4=es|aoss signs requests by AWS credentials of awsSession for Amazon OpenSearch, aoss is Serverless
+//	region=ap-northeast-1 is a region of sigv4, default is a region of awsSession
+type ESDSN struct {
+	// URLs are nodes. e.g. http://host1:9200
+	URLs []string
+	// Auth
+	User, Password, APIKey string
+	// TLS
+	CACert   string
+	Insecure bool
+	// Option
+	Sniff, Healthcheck, Gzip bool
+	Timeout, BulkTimeout     time.Duration
+
+	// OpenSearch is true when a cluster is OpenSearch
+	OpenSearch bool
+	// SigV4 is a service name of AWS request signing, blank means no signing
+	SigV4 string
+	// Sess is used by sigv4
+	Sess *session.Session
+}
+
+// URL returns the first node which is used to get a version.
+func (dsn *ESDSN) URL() string {
+	return dsn.URLs[0]
+}
+
+// ES parses es://user:pass@host1:9200,host2:9200/?sniff=false&timeout=30s
+func ES(uri string) (*ESDSN, error) {
+	if uri == "" {
+		return nil, ef("invalid es dsn")
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid es dsn: %w", err)
+	}
+	if u.Host == "" {
+		return nil, ef("invalid es hasn't hosts: %s", uri)
+	}
+
+	q := u.Query()
+	dsn := &ESDSN{
+		APIKey:      q.Get("apikey"),
+		CACert:      q.Get("ca"),
+		Sniff:       true,
+		Healthcheck: true,
+		Timeout:     30 * time.Second,
+		BulkTimeout: 360 * time.Second,
+	}
+	if u.User != nil {
+		dsn.User = u.User.Username()
+		dsn.Password, _ = u.User.Password()
+	}
+
+	scheme := "http"
+	switch u.Scheme {
+	case "es":
+		switch q.Get("tls") {
+		case "", "false":
+		case "true":
+			scheme = "https"
+		case "skip-verify":
+			scheme = "https"
+			dsn.Insecure = true
+		default:
+			return nil, ef("invalid es tls: %s", q.Get("tls"))
+		}
+	case "http", "https":
+		scheme = u.Scheme
+	default:
+		return nil, ef("invalid es scheme: %s", u.Scheme)
+	}
+
+	for _, host := range strings.Split(u.Host, ",") {
+		if host == "" {
+			return nil, ef("invalid es host: %s", u.Host)
+		}
+		dsn.URLs = append(dsn.URLs, scheme+"://"+host+strings.TrimSuffix(u.Path, "/"))
+	}
+
+	if v := q.Get("opensearch"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, ef("invalid es opensearch: %s", v)
+		}
+		dsn.OpenSearch = b
+	}
+	if err := esSigV4(dsn, q.Get("sigv4"), q.Get("region")); err != nil {
+		return nil, err
+	}
+	// nodes aren't reachable directly behind managed endpoints.
+	if dsn.OpenSearch {
+		dsn.Sniff = false
+	}
+
+	bools := map[string]*bool{"sniff": &dsn.Sniff, "healthcheck": &dsn.Healthcheck, "gzip": &dsn.Gzip}
+	for k, p := range bools {
+		if v := q.Get(k); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, ef("invalid es %s: %s", k, v)
+			}
+			*p = b
+		}
+	}
+
+	durations := map[string]*time.Duration{"timeout": &dsn.Timeout, "bulktimeout": &dsn.BulkTimeout}
+	for k, p := range durations {
+		if v := q.Get(k); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return nil, ef("invalid es %s: %s", k, v)
+			}
+			*p = d
+		}
+	}
+
+	return dsn, nil
+}
+
+func esSigV4(dsn *ESDSN, service, region string) error {
+	switch service {
+	case "":
+		return nil
+	case "es", "aoss":
+	default:
+		return ef("invalid es sigv4 service: %s", service)
+	}
+
+	sess, err := awsSession()
+	if err != nil {
+		msg := "invalid es sigv4 environment variables: %w"
+		return xerrors.Errorf(msg, err)
+	}
+
+	cfg := &aws.Config{}
+	if region != "" {
+		cfg.Region = aws.String(region)
+	}
+
+	dsn.SigV4 = service
+	dsn.OpenSearch = true
+	dsn.Sess = sess.Copy(cfg)
+	return nil
+}
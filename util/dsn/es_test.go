@@ -0,0 +1,88 @@
+package dsn
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestES(t *testing.T) {
+	t.Helper()
+
+	f, err := ES("es://elastic:secret@host1:9200,host2:9200/?sniff=false&healthcheck=false&timeout=10s&bulktimeout=5m&tls=true&ca=%2Fetc%2Fes%2Fca.pem&gzip=true")
+	if err != nil {
+		t.Fatalf("Unknown Scheme: file=%#+v err=%v", f, err)
+	}
+
+	if !reflect.DeepEqual(f.URLs, []string{"https://host1:9200", "https://host2:9200"}) {
+		t.Errorf("es urls error: %#+v", f.URLs)
+	}
+	if f.User != "elastic" || f.Password != "secret" {
+		t.Error("es auth field error")
+	}
+	if f.Sniff || f.Healthcheck || !f.Gzip || f.Insecure {
+		t.Errorf("es option field error: %#+v", f)
+	}
+	if f.Timeout != 10*time.Second || f.BulkTimeout != 5*time.Minute {
+		t.Errorf("es timeout field error: %#+v", f)
+	}
+	if f.CACert != "/etc/es/ca.pem" {
+		t.Errorf("es ca field error: %s", f.CACert)
+	}
+}
+
+func TestESLegacy(t *testing.T) {
+	t.Helper()
+
+	f, err := ES("http://localhost:9200")
+	if err != nil {
+		t.Fatalf("Unknown Scheme: file=%#+v err=%v", f, err)
+	}
+	if f.URL() != "http://localhost:9200" || !f.Sniff || !f.Healthcheck {
+		t.Errorf("es legacy field error: %#+v", f)
+	}
+	if f.Timeout != 30*time.Second || f.BulkTimeout != 360*time.Second {
+		t.Errorf("es default timeout error: %#+v", f)
+	}
+
+	f, err = ES("es://es.example.com:443/?tls=skip-verify&apikey=aWQ6a2V5")
+	if err != nil {
+		t.Fatalf("Unknown Scheme: file=%#+v err=%v", f, err)
+	}
+	if f.URL() != "https://es.example.com:443" || !f.Insecure || f.APIKey != "aWQ6a2V5" {
+		t.Errorf("es api key field error: %#+v", f)
+	}
+
+	for _, uri := range []string{"", "redis://localhost:6379", "es://", "es://host1,/", "es://host?sniff=maybe", "es://host?timeout=-1s"} {
+		if _, err := ES(uri); err == nil {
+			t.Errorf("es dsn must be error: %s", uri)
+		}
+	}
+}
+
+func TestESOpenSearch(t *testing.T) {
+	t.Helper()
+
+	f, err := ES("es://search-domain.ap-northeast-1.es.amazonaws.com:443/?tls=true&sigv4=es&region=us-west-2")
+	if err != nil {
+		t.Fatalf("Unknown Scheme: file=%#+v err=%v", f, err)
+	}
+	if f.SigV4 != "es" || !f.OpenSearch || f.Sniff {
+		t.Errorf("es sigv4 field error: %#+v", f)
+	}
+	if f.Sess == nil || *f.Sess.Config.Region != "us-west-2" {
+		t.Errorf("es sigv4 session error: %#+v", f.Sess)
+	}
+
+	f, err = ES("es://localhost:9200/?opensearch=true")
+	if err != nil {
+		t.Fatalf("Unknown Scheme: file=%#+v err=%v", f, err)
+	}
+	if !f.OpenSearch || f.Sniff || f.Sess != nil {
+		t.Errorf("es opensearch field error: %#+v", f)
+	}
+
+	if _, err := ES("es://localhost:9200/?sigv4=s3"); err == nil {
+		t.Error("es sigv4 unknown service must be error")
+	}
+}
@@ -1,12 +1,61 @@
 package dsn
 
 import (
+	"net/url"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/go-sql-driver/mysql"
+	"golang.org/x/xerrors"
 )
 
+// TLS modes for SMTP connection
+const (
+	// MailTLSNone never encrypts a connection even if server advertises STARTTLS.
+	MailTLSNone = "none"
+	// MailTLSOpportunistic upgrades a connection by STARTTLS only when server advertises it.
+	MailTLSOpportunistic = "opportunistic"
+	// MailTLSStartTLS requires STARTTLS upgrading.
+	MailTLSStartTLS = "starttls"
+	// MailTLSImplicit connects with TLS from the beginning. e.g. smtps port 465
+	MailTLSImplicit = "tls"
+)
+
+// Auth mechanisms for SMTP connection
+const (
+	// MailAuthNone uses no authentication for relay servers.
+	MailAuthNone = "none"
+	// MailAuthPlain uses AUTH PLAIN.
+	MailAuthPlain = "plain"
+	// MailAuthLogin uses AUTH LOGIN.
+	MailAuthLogin = "login"
+	// MailAuthCRAMMD5 uses AUTH CRAM-MD5.
+	MailAuthCRAMMD5 = "cram-md5"
+	// MailAuthXOAUTH2 uses AUTH XOAUTH2, password is treated as an access token.
+	MailAuthXOAUTH2 = "xoauth2"
+)
+
+// MailPoolMinIdleTimeout is the minimum idletimeout of SMTP connection pool.
+const MailPoolMinIdleTimeout = time.Second
+
 // MailDSN stdout:// or smtp://username@gmail.com:password@smtp.gmail.com(smtp.gmail.com:587)/?tls=false
+// or HTTP API providers ses://, sendgrid:// and mailgun://
+// or file://./tmp/mails/ which writes .eml files into the folder
+//
+// Options
+//
+//	tlsmode=none|opportunistic|starttls|tls (default: opportunistic, tls=true is same as tlsmode=tls)
+//	insecure=true skips certificate verification (tls=skip-verify is same as tlsmode=tls&insecure=true)
+//	auth=none|plain|login|cram-md5|xoauth2 (default: plain, or none when user is blank)
+//	pool=true reuses authenticated connections across sends
+//	maxconns=4 limits connections which are opened at the same time in pool
+//	idletimeout=30s closes connections which have been idle longer than this in pool, 1s at least
+//	maxsends=100 reconnects after sending this many messages in one connection in pool
+//	dkimdomain=example.com&dkimselector=s1&dkimkey=%2Fpath%2Fto%2Fprivate.pem signs mail by DKIM, RSA or Ed25519 key (url escaped)
+//	preview=127.0.0.1:1080 serves captured mails in a browser, only for stdout:// and file://
 type MailDSN struct {
 	// Auth
 	User, Password, Host string
@@ -14,31 +63,61 @@ type MailDSN struct {
 	Addr, TLSServer string
 	// Option
 	TLS, StdOut bool
+	// TLSMode is one of MailTLS* constants
+	TLSMode string
+	// Insecure skips certificate verification
+	Insecure bool
+	// Auth is one of MailAuth* constants
+	Auth string
+	// Pool options
+	Pool            bool
+	PoolMaxConns    int
+	PoolMaxSends    int
+	PoolIdleTimeout time.Duration
+
+	// Provider is one of MailProvider* constants, blank means SMTP
+	Provider string
+	// HTTP API options
+	APIKey, Domain, Region, Endpoint, ConfigSet string
+	// Sess is used by ses
+	Sess *session.Session
+
+	// DKIM options, DKIMKey is a PEM file path or PEM encoded private key
+	DKIMDomain, DKIMSelector, DKIMKey string
+
+	// Folder is an absolute path which file:// writes mails into
+	Folder string
+	// Preview is a listen address of preview server
+	Preview string
+}
+
+// HasDKIM returns true when DKIM signing is configured.
+func (dsn *MailDSN) HasDKIM() bool {
+	return dsn.DKIMKey != ""
 }
 
 // Mail stdout:// or smtp://username@gmail.com:password@smtp.gmail.com(smtp.gmail.com:587)/?tls=false
 func Mail(uri string) (*MailDSN, error) {
-	if strings.HasPrefix(uri, "stdout://") {
-		return &MailDSN{StdOut: true}, nil
+	if strings.HasPrefix(uri, "stdout://") || strings.HasPrefix(uri, "file://") {
+		return mailLocal(uri)
+	}
+	for _, p := range []string{MailProviderSES, MailProviderSendGrid, MailProviderMailgun} {
+		if strings.HasPrefix(uri, p+"://") {
+			return mailProvider(uri)
+		}
 	}
 
 	if uri == "" {
 		return nil, ef("invalid mail dsn")
 	}
 	if !strings.HasPrefix(uri, "smtp://") {
-		return nil, ef("invalid mail scheme. e.g. smtp://")
+		return nil, ef("invalid mail scheme. e.g. smtp://, ses://, sendgrid://, mailgun://")
 	}
 
 	m, err := mysql.ParseDSN(strings.TrimPrefix(uri, "smtp://"))
 	if err != nil {
 		return nil, err
 	}
-	if m.User == "" {
-		return nil, ef("invalid mail hasn't auth user: %s", m.User)
-	}
-	if m.Passwd == "" {
-		return nil, ef("invalid mail hasn't auth password")
-	}
 	if m.Net == "" {
 		return nil, ef("invalid mail hasn't auth host: %s", m.Net)
 	}
@@ -52,9 +131,146 @@ func Mail(uri string) (*MailDSN, error) {
 		Password:  m.Passwd,
 		Host:      m.Net,
 		Addr:      m.Addr,
-		TLS:       m.TLSConfig == "true",
 		TLSServer: hp[0],
+		TLSMode:   MailTLSOpportunistic,
+		Auth:      MailAuthPlain,
+	}
+
+	switch m.TLSConfig {
+	case "true":
+		dsn.TLSMode = MailTLSImplicit
+	case "skip-verify":
+		dsn.TLSMode = MailTLSImplicit
+		dsn.Insecure = true
+	}
+	if mode, ok := m.Params["tlsmode"]; ok {
+		switch mode {
+		case MailTLSNone, MailTLSOpportunistic, MailTLSStartTLS, MailTLSImplicit:
+			dsn.TLSMode = mode
+		default:
+			return nil, ef("invalid mail tlsmode: %s", mode)
+		}
+	}
+	dsn.TLS = dsn.TLSMode == MailTLSImplicit
+
+	if insecure, ok := m.Params["insecure"]; ok {
+		b, err := strconv.ParseBool(insecure)
+		if err != nil {
+			return nil, ef("invalid mail insecure: %s", insecure)
+		}
+		dsn.Insecure = b
+	}
+
+	if m.User == "" {
+		dsn.Auth = MailAuthNone
+	}
+	if auth, ok := m.Params["auth"]; ok {
+		switch strings.ToLower(auth) {
+		case MailAuthNone, MailAuthPlain, MailAuthLogin, MailAuthCRAMMD5, MailAuthXOAUTH2:
+			dsn.Auth = strings.ToLower(auth)
+		default:
+			return nil, ef("invalid mail auth: %s", auth)
+		}
+	}
+
+	if err := mailPool(dsn, m.Params); err != nil {
+		return nil, err
+	}
+	if err := mailDKIM(dsn, func(k string) string { return m.Params[k] }); err != nil {
+		return nil, err
+	}
+
+	if dsn.Auth != MailAuthNone {
+		if m.User == "" {
+			return nil, ef("invalid mail hasn't auth user: %s", m.User)
+		}
+		if m.Passwd == "" {
+			return nil, ef("invalid mail hasn't auth password")
+		}
+	}
+
+	return dsn, nil
+}
+
+// mailLocal parses stdout:// or file://./tmp/mails/ which never sends mails.
+func mailLocal(uri string) (*MailDSN, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid mail dsn: %w", err)
+	}
+
+	dsn := &MailDSN{Preview: u.Query().Get("preview")}
+	if dsn.Preview != "" && !strings.Contains(dsn.Preview, ":") {
+		return nil, ef("invalid mail preview host:port: %s", dsn.Preview)
+	}
+
+	if u.Scheme == "stdout" {
+		dsn.StdOut = true
+		return dsn, nil
+	}
+
+	if u.Host != "" && u.Host != "." && u.Host != ".." {
+		msg := "invalid mail file path prefix. that must be dotslach(./) or slash(/) char set."
+		return nil, ef(msg)
+	}
+	if u.Host+u.Path == "" {
+		return nil, ef("invalid mail file path is blank")
+	}
+	if dsn.Folder, err = filepath.Abs(u.Host + u.Path); err != nil {
+		return nil, xerrors.Errorf("invalid mail dsn: %w", err)
 	}
 
 	return dsn, nil
 }
+
+func mailPool(dsn *MailDSN, params map[string]string) error {
+	dsn.PoolMaxConns = 4
+	dsn.PoolMaxSends = 100
+	dsn.PoolIdleTimeout = 30 * time.Second
+
+	if v, ok := params["pool"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return ef("invalid mail pool: %s", v)
+		}
+		dsn.Pool = b
+	}
+	if v, ok := params["maxconns"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return ef("invalid mail maxconns: %s", v)
+		}
+		dsn.PoolMaxConns = n
+	}
+	if v, ok := params["maxsends"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return ef("invalid mail maxsends: %s", v)
+		}
+		dsn.PoolMaxSends = n
+	}
+	if v, ok := params["idletimeout"]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < MailPoolMinIdleTimeout {
+			return ef("invalid mail idletimeout: %s", v)
+		}
+		dsn.PoolIdleTimeout = d
+	}
+
+	return nil
+}
+
+func mailDKIM(dsn *MailDSN, get func(string) string) error {
+	dsn.DKIMDomain = get("dkimdomain")
+	dsn.DKIMSelector = get("dkimselector")
+	dsn.DKIMKey = get("dkimkey")
+
+	if dsn.DKIMKey == "" && (dsn.DKIMDomain != "" || dsn.DKIMSelector != "") {
+		return ef("invalid mail dkim hasn't key")
+	}
+	if dsn.DKIMKey != "" && (dsn.DKIMDomain == "" || dsn.DKIMSelector == "") {
+		return ef("invalid mail dkim hasn't domain or selector")
+	}
+
+	return nil
+}
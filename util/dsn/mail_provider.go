@@ -0,0 +1,111 @@
+package dsn
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"golang.org/x/xerrors"
+)
+
+// HTTP API providers for mail
+const (
+	// MailProviderSES sends mail through Amazon SES API.
+	MailProviderSES = "ses"
+	// MailProviderSendGrid sends mail through SendGrid v3 API.
+	MailProviderSendGrid = "sendgrid"
+	// MailProviderMailgun sends mail through Mailgun v3 API.
+	MailProviderMailgun = "mailgun"
+)
+
+// mailProvider parses HTTP API provider uri.
+//
+//	ses://ap-northeast-1/?configset=default&endpoint=https://email.ap-northeast-1.amazonaws.com
+//	sendgrid://<apikey>@api.sendgrid.com/?endpoint=https://api.sendgrid.com
+//	mailgun://<apikey>@<sending domain>/?region=eu&endpoint=https://api.mailgun.net
+//
+// ses and mailgun accept dkim options as well as smtp.
+func mailProvider(uri string) (*MailDSN, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid mail dsn: %w", err)
+	}
+
+	q := u.Query()
+	dsn := &MailDSN{
+		Provider: u.Scheme,
+		Endpoint: strings.TrimSuffix(q.Get("endpoint"), "/"),
+	}
+	if dsn.Endpoint != "" {
+		eu, err := url.Parse(dsn.Endpoint)
+		if err != nil || eu.Scheme == "" || eu.Host == "" {
+			return nil, ef("invalid mail endpoint: %s", dsn.Endpoint)
+		}
+	}
+
+	switch u.Scheme {
+	case MailProviderSES:
+		dsn.Region = u.Host
+		dsn.ConfigSet = q.Get("configset")
+
+		sess, err := awsSession()
+		if err != nil {
+			msg := "invalid ses environment variables: %w"
+			return nil, xerrors.Errorf(msg, err)
+		}
+
+		cfg := &aws.Config{}
+		if dsn.Region != "" {
+			cfg.Region = aws.String(dsn.Region)
+		}
+		if dsn.Endpoint != "" {
+			cfg.Endpoint = aws.String(dsn.Endpoint)
+		}
+		dsn.Sess = sess.Copy(cfg)
+
+	case MailProviderSendGrid:
+		if u.User == nil || u.User.Username() == "" {
+			return nil, ef("invalid sendgrid hasn't api key")
+		}
+		dsn.APIKey = u.User.Username()
+
+		if dsn.Endpoint == "" {
+			host := u.Host
+			if host == "" {
+				host = "api.sendgrid.com"
+			}
+			dsn.Endpoint = "https://" + host
+		}
+
+	case MailProviderMailgun:
+		if u.User == nil || u.User.Username() == "" {
+			return nil, ef("invalid mailgun hasn't api key")
+		}
+		if u.Host == "" {
+			return nil, ef("invalid mailgun hasn't sending domain")
+		}
+		dsn.APIKey = u.User.Username()
+		dsn.Domain = u.Host
+		dsn.Region = q.Get("region")
+
+		if dsn.Endpoint == "" {
+			switch dsn.Region {
+			case "", "us":
+				dsn.Endpoint = "https://api.mailgun.net"
+			case "eu":
+				dsn.Endpoint = "https://api.eu.mailgun.net"
+			default:
+				return nil, ef("invalid mailgun region: %s", dsn.Region)
+			}
+		}
+
+	default:
+		return nil, ef("invalid mail scheme: %s", u.Scheme)
+	}
+
+	if err := mailDKIM(dsn, q.Get); err != nil {
+		return nil, err
+	}
+
+	return dsn, nil
+}
@@ -0,0 +1,80 @@
+package dsn
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestMailSES(t *testing.T) {
+	t.Helper()
+
+	f, err := Mail("ses://us-west-2/?configset=tracking&endpoint=http://127.0.0.1:8080")
+	if err != nil {
+		t.Fatalf("Unknown Scheme: file=%#+v err=%v", f, err)
+	}
+	if f.Provider != MailProviderSES {
+		t.Errorf("mail provider error: %s", f.Provider)
+	}
+	if f.ConfigSet != "tracking" {
+		t.Errorf("mail configset error: %s", f.ConfigSet)
+	}
+	if aws.StringValue(f.Sess.Config.Region) != "us-west-2" {
+		t.Errorf("mail region error: %s", aws.StringValue(f.Sess.Config.Region))
+	}
+	if aws.StringValue(f.Sess.Config.Endpoint) != "http://127.0.0.1:8080" {
+		t.Errorf("mail endpoint error: %s", aws.StringValue(f.Sess.Config.Endpoint))
+	}
+}
+
+func TestMailSendGrid(t *testing.T) {
+	t.Helper()
+
+	f, err := Mail("sendgrid://SG.key.secret@api.sendgrid.com/")
+	if err != nil {
+		t.Fatalf("Unknown Scheme: file=%#+v err=%v", f, err)
+	}
+	if f.Provider != MailProviderSendGrid {
+		t.Errorf("mail provider error: %s", f.Provider)
+	}
+	if f.APIKey != "SG.key.secret" {
+		t.Errorf("mail apikey error: %s", f.APIKey)
+	}
+	if f.Endpoint != "https://api.sendgrid.com" {
+		t.Errorf("mail endpoint error: %s", f.Endpoint)
+	}
+
+	if _, err := Mail("sendgrid://api.sendgrid.com/"); err == nil {
+		t.Error("sendgrid blank api key must be error")
+	}
+}
+
+func TestMailMailgun(t *testing.T) {
+	t.Helper()
+
+	f, err := Mail("mailgun://key-xxx@mg.example.com/?region=eu")
+	if err != nil {
+		t.Fatalf("Unknown Scheme: file=%#+v err=%v", f, err)
+	}
+	if f.Provider != MailProviderMailgun {
+		t.Errorf("mail provider error: %s", f.Provider)
+	}
+	if f.APIKey != "key-xxx" || f.Domain != "mg.example.com" {
+		t.Errorf("mail field error: %#+v", f)
+	}
+	if f.Endpoint != "https://api.eu.mailgun.net" {
+		t.Errorf("mail endpoint error: %s", f.Endpoint)
+	}
+
+	f, err = Mail("mailgun://key-xxx@mg.example.com/?endpoint=http://127.0.0.1:8080/")
+	if err != nil {
+		t.Fatalf("Unknown Scheme: file=%#+v err=%v", f, err)
+	}
+	if f.Endpoint != "http://127.0.0.1:8080" {
+		t.Errorf("mail endpoint error: %s", f.Endpoint)
+	}
+
+	if _, err := Mail("mailgun://key-xxx@mg.example.com/?region=ap"); err == nil {
+		t.Error("mailgun invalid region must be error")
+	}
+}
@@ -0,0 +1,113 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ESRequestBodyLimit is a max length of a request body which is recorded into ESRequest.
+const ESRequestBodyLimit = 4096
+
+type esRequestKey struct{}
+
+// ESRequest is filled by connections of ESConn and ESBulkConn with the last request
+// which was sent under a context given by WithESRequest.
+type ESRequest struct {
+	mu       sync.Mutex
+	method   string
+	path     string
+	body     []byte
+	withBody bool
+}
+
+// WithESRequest returns a context which records an es request into ESRequest,
+// a head of the request body is recorded only when withBody is true.
+func WithESRequest(ctx context.Context, withBody bool) (context.Context, *ESRequest) {
+	r := &ESRequest{withBody: withBody}
+	return context.WithValue(ctx, esRequestKey{}, r), r
+}
+
+// Method returns a http method of the request. e.g. POST
+func (r *ESRequest) Method() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.method
+}
+
+// Path returns a url path of the request. e.g. /companies/_search
+func (r *ESRequest) Path() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.path
+}
+
+// Body returns a request body which is truncated into ESRequestBodyLimit.
+func (r *ESRequest) Body() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return string(r.body)
+}
+
+// esRequestTransport records requests into ESRequest in a context.
+type esRequestTransport struct {
+	base http.RoundTripper
+}
+
+func (t *esRequestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r, _ := req.Context().Value(esRequestKey{}).(*ESRequest)
+	if r == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	var body []byte
+	if r.withBody && req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, req, err = headBody(req); err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.Lock()
+	r.method, r.path, r.body = req.Method, req.URL.Path, body
+	r.mu.Unlock()
+
+	return t.base.RoundTrip(req)
+}
+
+// headBody returns at most ESRequestBodyLimit bytes of a request body without reading
+// the whole of it, e.g. multi-MB bulk bodies. The body is read again from GetBody when
+// it's given, otherwise the request is cloned with the head and the rest of the body.
+func headBody(req *http.Request) ([]byte, *http.Request, error) {
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read es request body: %s", err)
+		}
+		defer rc.Close()
+
+		head, err := io.ReadAll(io.LimitReader(rc, ESRequestBodyLimit))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read es request body: %s", err)
+		}
+		return head, req, nil
+	}
+
+	head, err := io.ReadAll(io.LimitReader(req.Body, ESRequestBodyLimit))
+	if err != nil {
+		_ = req.Body.Close()
+		return nil, nil, fmt.Errorf("failed to read es request body: %s", err)
+	}
+
+	// a request mustn't be modified by RoundTripper
+	rest := req.Body
+	req = req.Clone(req.Context())
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), rest), rest}
+	return head, req, nil
+}
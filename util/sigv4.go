@@ -0,0 +1,62 @@
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// sigV4Transport signs requests to Amazon OpenSearch by AWS Signature Version 4.
+type sigV4Transport struct {
+	base    http.RoundTripper
+	signer  *v4.Signer
+	service string
+	region  string
+}
+
+func newSigV4Transport(base http.RoundTripper, sess *session.Session, service string) *sigV4Transport {
+	return &sigV4Transport{
+		base:    base,
+		signer:  v4.NewSigner(sess.Config.Credentials),
+		service: service,
+		region:  aws.StringValue(sess.Config.Region),
+	}
+}
+
+func (t *sigV4Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a request mustn't be modified by RoundTripper
+	req = req.Clone(req.Context())
+
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read es request body: %s", err)
+		}
+		body = b
+	}
+
+	// OpenSearch Serverless requires a payload hash header
+	sum := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+
+	// nil body keeps a request without body, empty reader makes it chunked
+	var seeker io.ReadSeeker
+	if len(body) > 0 {
+		seeker = bytes.NewReader(body)
+	}
+	if _, err := t.signer.Sign(req, seeker, t.service, t.region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign es request: %s", err)
+	}
+
+	return t.base.RoundTrip(req)
+}